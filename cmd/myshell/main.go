@@ -1,218 +1,110 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/chzyer/readline"
-	"github.com/codecrafters-io/shell-starter-go/internal/completer"
-	"github.com/codecrafters-io/shell-starter-go/internal/parser"
-	"github.com/codecrafters-io/shell-starter-go/internal/redirect"
+	"github.com/codecrafters-io/shell-starter-go/shell"
 )
 
-// builtinNames lists all shell builtin command names.
-var builtinNames = []string{"echo", "exit", "type", "pwd", "cd"}
+// usage is printed when the command line cannot be parsed.
+const usage = "usage: myshell [-l] [--login] [--norc] [--noprofile] [--rcfile file] [--posix] [-c command [name [arg ...]]] [script [arg ...]]"
 
+// main runs the shell. "myshell -c command" runs command, "myshell script
+// args" runs the script with the given positional parameters, and without
+// arguments commands are read from standard input: interactively when it
+// is a terminal and as a script otherwise. The startup files are read
+// first: the profiles for login shells, started with -l or with a name
+// beginning with '-', and ~/.myshellrc for interactive shells.
 func main() {
-	comp := &completer.Completer{
-		Builtins: builtinNames,
-	}
-
-	config := &readline.Config{
-		Prompt:       "$ ",
-		AutoComplete: comp,
-	}
-
-	rl, err := readline.NewEx(config)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize readline: %v\n", err)
-		os.Exit(1)
-	}
-	defer rl.Close()
-
-	for {
-		input, err := rl.Readline()
-		if err != nil {
-			if err == io.EOF || err == readline.ErrInterrupt {
-				os.Exit(0)
+	sh := &shell.Shell{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Name:   os.Args[0],
+	}
+	args := os.Args[1:]
+
+	// A shell started as "sh" behaves as a POSIX shell.
+	startup := shell.Startup{
+		Login: strings.HasPrefix(sh.Name, "-"),
+		POSIX: filepath.Base(strings.TrimPrefix(sh.Name, "-")) == "sh",
+	}
+options:
+	for len(args) > 0 {
+		switch args[0] {
+		case "-l", "--login":
+			startup.Login = true
+		case "--norc":
+			startup.NoRC = true
+		case "--noprofile":
+			startup.NoProfile = true
+		case "--posix":
+			startup.POSIX = true
+		case "--rcfile", "--init-file":
+			if len(args) < 2 {
+				fmt.Fprintf(os.Stderr, "%s: %s: option requires an argument\n%s\n", sh.Name, args[0], usage)
+				os.Exit(2)
 			}
-			os.Exit(1)
-		}
-
-		input = strings.TrimSpace(input)
-		inputParts := parser.ParseInput(input)
-		redir := redirect.Parse(inputParts)
-
-		if len(redir.CommandParts) == 0 {
-			continue
-		}
-
-		command := strings.ToLower(redir.CommandParts[0])
-
-		switch command {
-		case "exit":
-			handleExit(redir.CommandParts)
-		case "echo":
-			handleEcho(redir)
-		case "type":
-			handleType(redir.CommandParts)
-		case "pwd":
-			handlePwd()
-		case "cd":
-			handleCd(redir.CommandParts)
+			startup.RCFile = args[1]
+			args = args[1:]
 		default:
-			executeExternal(redir)
+			break options
 		}
+		args = args[1:]
 	}
-}
 
-// handleExit exits the shell. Supports "exit" and "exit 0".
-func handleExit(parts []string) {
-	if len(parts) == 1 || (len(parts) > 1 && parts[1] == "0") {
-		os.Exit(0)
-	}
-}
-
-// handleEcho writes the arguments to stdout or to a redirected output file.
-// Also creates an empty error file if stderr redirection is specified.
-func handleEcho(redir redirect.Redirect) {
-	if len(redir.CommandParts) < 2 {
-		fmt.Println("echo: missing argument")
-		return
-	}
-
-	output := strings.Join(redir.CommandParts[1:], " ")
-
-	if redir.HasOutput() {
-		file, err := redir.OpenOutputFile()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating file: %v\n", err)
-			return
+	switch {
+	case len(args) > 0 && args[0] == "-c":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "%s: -c: option requires an argument\n%s\n", sh.Name, usage)
+			os.Exit(2)
 		}
-		fmt.Fprintln(file, output)
-		file.Close()
-	} else {
-		fmt.Println(output)
-	}
-
-	// Create empty error file for echo (codecrafters requirement)
-	if redir.HasError() {
-		file, err := os.Create(redir.ErrorFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating file: %v\n", err)
-			return
+		if len(args) > 2 {
+			sh.Name, sh.Args = args[2], args[3:]
 		}
-		file.Close()
-	}
-}
-
-// handleType reports whether a command is a builtin or an external executable.
-func handleType(parts []string) {
-	if len(parts) < 2 {
-		return
-	}
-
-	target := parts[1]
-
-	// Check if it's a builtin
-	for _, name := range builtinNames {
-		if target == name {
-			fmt.Printf("%s is a shell builtin\n", target)
-			return
-		}
-	}
-
-	// Search PATH for the executable
-	pathEnv := os.Getenv("PATH")
-	if pathEnv != "" {
-		for _, dir := range strings.Split(pathEnv, ":") {
-			execPath := filepath.Join(dir, target)
-			info, err := os.Stat(execPath)
-			if err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
-				fmt.Printf("%s is %s\n", target, execPath)
-				return
+		os.Exit(run(sh, startup, strings.NewReader(args[1])))
+	case len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-":
+		fmt.Fprintf(os.Stderr, "%s: %s: invalid option\n%s\n", sh.Name, args[0], usage)
+		os.Exit(2)
+	case len(args) > 0 && args[0] != "-":
+		file, err := os.Open(args[0])
+		if err != nil {
+			var pathErr *os.PathError
+			if errors.As(err, &pathErr) {
+				err = pathErr.Err
 			}
+			fmt.Fprintf(os.Stderr, "%s: %s: %v\n", sh.Name, args[0], err)
+			os.Exit(127)
 		}
+		sh.Name, sh.Args = args[0], args[1:]
+		os.Exit(run(sh, startup, bufio.NewReader(file)))
+	case len(args) > 0:
+		sh.Args = args[1:]
 	}
 
-	fmt.Printf("%s: not found\n", target)
-}
-
-// handlePwd prints the current working directory.
-func handlePwd() {
-	wd, err := os.Getwd()
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	fmt.Println(wd)
-}
-
-// handleCd changes the current working directory.
-// Supports absolute paths, relative paths, ~ and ~/... for home directory.
-func handleCd(parts []string) {
-	if len(parts) < 2 {
-		fmt.Println("cd: missing argument")
-		return
-	}
-
-	dir := parts[1]
-
-	// Expand home directory
-	if dir == "~" {
-		dir = os.Getenv("HOME")
-	} else if strings.HasPrefix(dir, "~/") {
-		dir = filepath.Join(os.Getenv("HOME"), dir[2:])
-	}
-
-	if err := os.Chdir(dir); err != nil {
-		fmt.Printf("cd: %s: No such file or directory\n", dir)
+	if !readline.IsTerminal(int(os.Stdin.Fd())) {
+		os.Exit(run(sh, startup, os.Stdin))
 	}
+	startup.Interactive = true
+	sh.RunStartupFiles(context.Background(), startup)
+	os.Exit(sh.Interact())
 }
 
-// executeExternal runs an external command found in PATH, with I/O redirection support.
-func executeExternal(redir redirect.Redirect) {
-	commandName := redir.CommandParts[0]
-
-	executable, err := exec.LookPath(commandName)
+// run reads the startup files and then runs the commands read from r as a
+// script, and returns the status the shell exits with.
+func run(sh *shell.Shell, startup shell.Startup, r io.Reader) int {
+	sh.RunStartupFiles(context.Background(), startup)
+	status, err := sh.RunReader(context.Background(), r)
 	if err != nil {
-		fmt.Printf("%s: command not found\n", commandName)
-		return
-	}
-
-	cmd := exec.Command(executable, redir.CommandParts[1:]...)
-	cmd.Args[0] = commandName // Use original name, not full path
-	cmd.Stdin = os.Stdin
-
-	// Setup stdout
-	if redir.HasOutput() {
-		file, err := redir.OpenOutputFile()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating file: %v\n", err)
-			return
-		}
-		defer file.Close()
-		cmd.Stdout = file
-	} else {
-		cmd.Stdout = os.Stdout
+		fmt.Fprintf(os.Stderr, "%s: %v\n", sh.Name, err)
 	}
-
-	// Setup stderr
-	if redir.HasError() {
-		file, err := redir.OpenErrorFile()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating file: %v\n", err)
-			return
-		}
-		defer file.Close()
-		cmd.Stderr = file
-	} else {
-		cmd.Stderr = os.Stderr
-	}
-
-	cmd.Run()
+	return status
 }
@@ -6,13 +6,40 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/pathcache"
 )
 
 // Completer implements readline.AutoCompleter for shell tab completion.
-// It completes builtin commands and PATH executables, supports longest
-// common prefix (LCP) completion, and displays all matches on double-TAB.
+// It completes aliases, builtin commands, functions and PATH executables
+// in command position, and arguments as the command's Spec says or else as file
+// names. It supports longest common prefix (LCP) completion and displays
+// all matches on double-TAB.
 type Completer struct {
-	Builtins    []string
+	Builtins []string
+	// Getenv looks up shell variables such as PATH and HOME. If nil,
+	// os.Getenv is used.
+	Getenv func(name string) string
+	// Dir returns the directory relative paths are completed in. If nil,
+	// the process's working directory is used.
+	Dir func() string
+	// Variables, Functions and Aliases return the names of the shell's
+	// variables, functions and aliases.
+	Variables func() []string
+	Functions func() []string
+	Aliases   func() []string
+	// Generate returns the matches from a Spec's word list, function and
+	// command, which the shell expands and runs. Word list matches must
+	// start with the word being completed.
+	Generate func(spec *Spec, req Request) []string
+	// Hash caches the executables in PATH. If nil, the completer keeps a
+	// cache of its own.
+	Hash *pathcache.Cache
+	// Prompt is the prompt shown with the line, which is drawn again
+	// after the matches are listed. If empty, "$ " is used.
+	Prompt string
+
+	specs       map[string]*Spec
 	lastLine    string
 	lastMatches []string
 	tabCount    int
@@ -31,7 +58,7 @@ func (c *Completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 		c.lastLine = lineStr
 	}
 
-	matches := c.FindMatches(lineStr)
+	completion, matches := c.complete(lineStr)
 	c.lastMatches = matches
 
 	// No matches: ring the bell
@@ -41,18 +68,9 @@ func (c *Completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 		return nil, len(lineStr)
 	}
 
-	// Single match: complete with trailing space
-	if len(matches) == 1 {
-		c.tabCount = 0
-		completion := matches[0][len(lineStr):] + " "
-		return [][]rune{[]rune(completion)}, len(lineStr)
-	}
-
-	// Multiple matches: try LCP completion
-	lcp := FindLongestCommonPrefix(matches)
-	if len(lcp) > len(lineStr) {
+	// A single match, or a longer common prefix: insert the rest
+	if completion != "" {
 		c.tabCount = 0
-		completion := lcp[len(lineStr):]
 		return [][]rune{[]rune(completion)}, len(lineStr)
 	}
 
@@ -62,9 +80,18 @@ func (c *Completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 		fmt.Print("\x07")
 		return nil, len(lineStr)
 	} else if c.tabCount >= 2 {
-		// Second TAB: display all matches sorted
-		sort.Strings(matches)
-		os.Stdout.WriteString("\n" + strings.Join(matches, "  ") + "\n$ " + lineStr)
+		// Second TAB: display all matches sorted, files without their
+		// directory
+		names := make([]string, len(matches))
+		for i, m := range matches {
+			names[i] = m[strings.LastIndexByte(strings.TrimSuffix(m, "/"), '/')+1:]
+		}
+		sort.Strings(names)
+		prompt := c.Prompt
+		if prompt == "" {
+			prompt = "$ "
+		}
+		os.Stdout.WriteString("\n" + strings.Join(names, "  ") + "\n" + prompt + lineStr)
 		os.Stdout.Sync()
 		c.tabCount = 0
 		return nil, len(lineStr)
@@ -73,42 +100,115 @@ func (c *Completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 	return nil, len(lineStr)
 }
 
-// FindMatches collects matching builtins and PATH executables for the given prefix.
+// complete finds the matches for the word ending line and returns the text
+// to insert after it: the rest of a single match followed by a space or,
+// for a directory, nothing, or else the rest of the matches' longest
+// common prefix. The text is escaped to suit the quoting the word is in.
+func (c *Completer) complete(line string) (string, []string) {
+	w := currentWord(line)
+	var matches []string
+	var options Option
+	if w.command && !strings.Contains(w.raw, "/") {
+		matches = c.FindMatches(w.raw)
+	} else if spec, ok := c.specFor(w.words); ok {
+		options = spec.Options
+		matches = c.specMatches(spec, Request{Line: line, Words: append(w.words, w.raw)})
+	} else {
+		matches = c.FindFiles(w.raw)
+	}
+
+	switch {
+	case len(matches) == 1:
+		rest := escape(matches[0][len(w.raw):], w.quote)
+		if strings.HasSuffix(matches[0], "/") || options&OptionNoSpace != 0 {
+			return rest, matches
+		}
+		if w.quote != 0 {
+			rest += string(w.quote)
+		}
+		return rest + " ", matches
+	case len(matches) > 1:
+		lcp := FindLongestCommonPrefix(matches)
+		return escape(lcp[len(w.raw):], w.quote), matches
+	}
+	return "", nil
+}
+
+// specFor returns the spec for the command whose words are given, looked
+// up by its name and then by the last element of its path.
+func (c *Completer) specFor(words []string) (*Spec, bool) {
+	if len(words) == 0 {
+		return nil, false
+	}
+	if spec, ok := c.LookupSpec(words[0]); ok {
+		return spec, true
+	}
+	return c.LookupSpec(filepath.Base(words[0]))
+}
+
+// specMatches returns the distinct candidates spec generates for req that
+// can be completed from the word typed so far. With the filenames option,
+// directories get a trailing "/".
+func (c *Completer) specMatches(spec *Spec, req Request) []string {
+	seen := make(map[string]bool)
+	var matches []string
+	for _, m := range c.Candidates(spec, req) {
+		if spec.Options&OptionFileNames != 0 && !strings.HasSuffix(m, "/") {
+			if info, err := os.Stat(c.resolve(m)); err == nil && info.IsDir() {
+				m += "/"
+			}
+		}
+		if strings.HasPrefix(m, req.Word()) && !seen[m] {
+			matches = append(matches, m)
+			seen[m] = true
+		}
+	}
+	return matches
+}
+
+// hash returns the cache of PATH executables.
+func (c *Completer) hash() *pathcache.Cache {
+	if c.Hash == nil {
+		c.Hash = pathcache.New()
+	}
+	return c.Hash
+}
+
+// getenv returns the value of the variable name.
+func (c *Completer) getenv(name string) string {
+	if c.Getenv == nil {
+		return os.Getenv(name)
+	}
+	return c.Getenv(name)
+}
+
+// FindMatches collects matching aliases, builtins, functions and PATH
+// executables for the given prefix.
 func (c *Completer) FindMatches(prefix string) []string {
 	seen := make(map[string]bool)
 	var matches []string
 
-	// Match builtins
-	for _, builtin := range c.Builtins {
-		if strings.HasPrefix(builtin, prefix) {
-			matches = append(matches, builtin)
-			seen[builtin] = true
+	// Match aliases, builtins and functions
+	var names []string
+	if c.Aliases != nil {
+		names = append(names, c.Aliases()...)
+	}
+	names = append(names, c.Builtins...)
+	if c.Functions != nil {
+		names = append(names, c.Functions()...)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			matches = append(matches, name)
+			seen[name] = true
 		}
 	}
 
 	// Match PATH executables
-	pathEnv := os.Getenv("PATH")
-	if pathEnv != "" {
-		for _, dir := range strings.Split(pathEnv, ":") {
-			entries, err := os.ReadDir(dir)
-			if err != nil {
-				continue
-			}
-			for _, entry := range entries {
-				name := entry.Name()
-				if !strings.HasPrefix(name, prefix) || seen[name] {
-					continue
-				}
-				fullPath := filepath.Join(dir, name)
-				info, err := os.Stat(fullPath)
-				if err != nil {
-					continue
-				}
-				if !info.IsDir() && info.Mode()&0111 != 0 {
-					matches = append(matches, name)
-					seen[name] = true
-				}
-			}
+	for _, name := range c.hash().Executables(c.getenv("PATH"), c.dir()) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			matches = append(matches, name)
+			seen[name] = true
 		}
 	}
 
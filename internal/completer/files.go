@@ -0,0 +1,164 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// word describes the word being completed at the end of a line.
+type word struct {
+	raw     string // text typed so far, with quotes and escapes removed
+	quote   byte   // quote left open, or 0
+	command bool   // whether the word is in command position
+	// words holds the unquoted words of the command before this one.
+	words []string
+}
+
+// commandPrefixes are words after which a command name is expected.
+var commandPrefixes = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "while": true,
+	"until": true, "do": true, "!": true, "{": true,
+}
+
+// currentWord finds the word at the end of line, reading quotes and
+// backslashes the way the parser does.
+func currentWord(line string) word {
+	var w word
+	var raw strings.Builder
+	inWord := false
+	command := true
+	redirect := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case w.quote == '\'':
+			if c == '\'' {
+				w.quote = 0
+			} else {
+				raw.WriteByte(c)
+			}
+		case w.quote == '"':
+			if c == '"' {
+				w.quote = 0
+			} else if c == '\\' && i+1 < len(line) && strings.IndexByte("$`\"\\", line[i+1]) >= 0 {
+				i++
+				raw.WriteByte(line[i])
+			} else {
+				raw.WriteByte(c)
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(line) {
+				i++
+				raw.WriteByte(line[i])
+			}
+		case c == '\'' || c == '"':
+			inWord = true
+			w.quote = c
+		case strings.IndexByte(" \t\n|&;<>()", c) >= 0:
+			if inWord {
+				if !redirect && !(command && commandPrefixes[raw.String()]) {
+					command = false
+					w.words = append(w.words, raw.String())
+				}
+				redirect = false
+			}
+			raw.Reset()
+			inWord = false
+			switch c {
+			case '|', '&', ';', '(', '\n':
+				command, redirect = true, false
+				w.words = nil
+			case '<', '>':
+				redirect = true
+			}
+		default:
+			inWord = true
+			raw.WriteByte(c)
+		}
+	}
+	w.raw = raw.String()
+	w.command = command && !redirect
+	return w
+}
+
+// FindFiles returns the paths starting with prefix, with a "/" appended to
+// directories. A leading "~/" stands for the home directory and is kept in
+// the results. Hidden files are only matched when the name being completed
+// starts with a dot.
+func (c *Completer) FindFiles(prefix string) []string {
+	dirPart, base := "", prefix
+	if i := strings.LastIndexByte(prefix, '/'); i >= 0 {
+		dirPart, base = prefix[:i+1], prefix[i+1:]
+	}
+
+	dir := c.resolve(dirPart)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		match := dirPart + name
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+			match += "/"
+		}
+		matches = append(matches, match)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// resolve returns the file path name stands for, expanding a leading "~/"
+// and making it absolute.
+func (c *Completer) resolve(name string) string {
+	if strings.HasPrefix(name, "~/") {
+		name = filepath.Join(c.getenv("HOME"), name[2:])
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(c.dir(), name)
+	}
+	return name
+}
+
+// dir returns the directory relative paths are completed in.
+func (c *Completer) dir() string {
+	if c.Dir != nil {
+		return c.Dir()
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// escape quotes s for insertion inside the given open quote, or with
+// backslashes when quote is 0, so that the parser reads it back as s.
+func escape(s string, quote byte) string {
+	switch quote {
+	case '\'':
+		return strings.ReplaceAll(s, "'", `'\''`)
+	case '"':
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if strings.IndexByte("$`\"\\", s[i]) >= 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(s[i])
+		}
+		return b.String()
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(" \t\n|&;<>()'\"\\$`*?[]!{}#~", s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCurrentWord(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected word
+	}{
+		{line: "", expected: word{command: true}},
+		{line: "ec", expected: word{raw: "ec", command: true}},
+		{line: "cat internal/re", expected: word{raw: "internal/re", words: []string{"cat"}}},
+		{line: "cat ", expected: word{words: []string{"cat"}}},
+		{line: `cat my\ fi`, expected: word{raw: "my fi", words: []string{"cat"}}},
+		{line: `cat "my fi`, expected: word{raw: "my fi", quote: '"', words: []string{"cat"}}},
+		{line: `cat 'it''s`, expected: word{raw: "its", quote: '\'', words: []string{"cat"}}},
+		{line: `cat "a\"b`, expected: word{raw: `a"b`, quote: '"', words: []string{"cat"}}},
+		{line: `git "commit" -m x`, expected: word{raw: "x", words: []string{"git", "commit", "-m"}}},
+		{line: "ls | gr", expected: word{raw: "gr", command: true}},
+		{line: "true && ec", expected: word{raw: "ec", command: true}},
+		{line: "if tr", expected: word{raw: "tr", command: true}},
+		{line: "echo hi >ou", expected: word{raw: "ou", words: []string{"echo", "hi"}}},
+		{line: "echo if th", expected: word{raw: "th", words: []string{"echo", "if"}}},
+		{line: "< in ca", expected: word{raw: "ca", command: true}},
+	}
+
+	for _, tt := range tests {
+		if got := currentWord(tt.line); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("currentWord(%q) = %+v, want %+v", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		input    string
+		quote    byte
+		expected string
+	}{
+		{input: "plain.txt", expected: "plain.txt"},
+		{input: "my file (1).txt", expected: `my\ file\ \(1\).txt`},
+		{input: "a$b&c", expected: `a\$b\&c`},
+		{input: `say "hi" $x`, quote: '"', expected: `say \"hi\" \$x`},
+		{input: "it's", quote: '\'', expected: `it'\''s`},
+	}
+
+	for _, tt := range tests {
+		if got := escape(tt.input, tt.quote); got != tt.expected {
+			t.Errorf("escape(%q, %q) = %q, want %q", tt.input, tt.quote, got, tt.expected)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"internal/redirect", "internal/parser", "docs", "home/notes"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"README.md", "my file.txt", ".hidden", "home/notes/todo.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &Completer{
+		Builtins: []string{"echo", "cd"},
+		Getenv: func(name string) string {
+			if name == "HOME" {
+				return filepath.Join(dir, "home")
+			}
+			return ""
+		},
+		Dir:     func() string { return dir },
+		Aliases: func() []string { return []string{"ll"} },
+	}
+
+	tests := []struct {
+		name       string
+		line       string
+		completion string
+		matches    []string
+	}{
+		{name: "command", line: "ec", completion: "ho ", matches: []string{"echo"}},
+		{name: "alias", line: "l", completion: "l ", matches: []string{"ll"}},
+		{name: "file", line: "cat RE", completion: "ADME.md ", matches: []string{"README.md"}},
+		{name: "directory", line: "cd do", completion: "cs/", matches: []string{"docs/"}},
+		{name: "common prefix", line: "cat internal/", completion: "", matches: []string{"internal/parser/", "internal/redirect/"}},
+		{name: "nested", line: "cat internal/re", completion: "direct/", matches: []string{"internal/redirect/"}},
+		{name: "escaped", line: "cat my", completion: `\ file.txt `, matches: []string{"my file.txt"}},
+		{name: "open quote", line: `cat "my`, completion: ` file.txt" `, matches: []string{"my file.txt"}},
+		{name: "hidden", line: "cat .h", completion: "idden ", matches: []string{".hidden"}},
+		{name: "home", line: "cat ~/notes/t", completion: "odo.txt ", matches: []string{"~/notes/todo.txt"}},
+		{name: "relative path as command", line: "./do", completion: "cs/", matches: []string{"./docs/"}},
+		{name: "no match", line: "cat zz", completion: "", matches: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completion, matches := c.complete(tt.line)
+			if completion != tt.completion || !reflect.DeepEqual(matches, tt.matches) {
+				t.Errorf("complete(%q) = %q, %q; want %q, %q", tt.line, completion, matches, tt.completion, tt.matches)
+			}
+		})
+	}
+}
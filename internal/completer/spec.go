@@ -0,0 +1,204 @@
+package completer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/expand"
+)
+
+// Action is a set of kinds of names a Spec completes.
+type Action int
+
+const (
+	ActionFile      Action = 1 << iota // file names (complete -f)
+	ActionDirectory                    // directory names (complete -d)
+	ActionCommand                      // command names (complete -c)
+	ActionBuiltin                      // builtin names (complete -b)
+	ActionVariable                     // variable names (complete -v)
+	ActionFunction                     // function names (complete -A function)
+	ActionAlias                        // alias names (complete -a)
+)
+
+// ActionNames maps the names complete -A accepts to their actions.
+var ActionNames = map[string]Action{
+	"file":      ActionFile,
+	"directory": ActionDirectory,
+	"command":   ActionCommand,
+	"builtin":   ActionBuiltin,
+	"variable":  ActionVariable,
+	"function":  ActionFunction,
+	"alias":     ActionAlias,
+}
+
+// Option is a set of the settings complete -o accepts.
+type Option int
+
+const (
+	OptionDefault   Option = 1 << iota // complete file names if nothing matched
+	OptionDirNames                     // complete directory names if nothing matched
+	OptionFileNames                    // treat the matches as file names
+	OptionNoSpace                      // add no space after a single match
+	OptionPlusDirs                     // add directory names to the matches
+)
+
+// OptionNames maps the names complete -o accepts to their options.
+// "bashdefault" is taken as "default".
+var OptionNames = map[string]Option{
+	"default":     OptionDefault,
+	"bashdefault": OptionDefault,
+	"dirnames":    OptionDirNames,
+	"filenames":   OptionFileNames,
+	"nospace":     OptionNoSpace,
+	"plusdirs":    OptionPlusDirs,
+}
+
+// Spec describes how the arguments of a command are completed, as set up
+// by the complete builtin.
+type Spec struct {
+	Actions  Action
+	Options  Option
+	WordList string // -W: expanded and split when completing
+	Function string // -F: shell function setting the array COMPREPLY
+	Command  string // -C: command printing one match per line
+	Filter   string // -X: pattern removing matches; '!' keeps them instead
+	Prefix   string // -P: added to each match
+	Suffix   string // -S: added to each match
+}
+
+// Request is the command line a Spec is asked to complete.
+type Request struct {
+	Line  string   // the line up to the cursor
+	Words []string // the command's words, the last being completed
+}
+
+// Word returns the word being completed.
+func (r Request) Word() string {
+	if len(r.Words) == 0 {
+		return ""
+	}
+	return r.Words[len(r.Words)-1]
+}
+
+// SetSpec makes spec complete the arguments of the command name.
+func (c *Completer) SetSpec(name string, spec *Spec) {
+	if c.specs == nil {
+		c.specs = make(map[string]*Spec)
+	}
+	c.specs[name] = spec
+}
+
+// LookupSpec returns the spec for the command name.
+func (c *Completer) LookupSpec(name string) (*Spec, bool) {
+	spec, ok := c.specs[name]
+	return spec, ok
+}
+
+// RemoveSpec removes the spec for the command name and reports whether
+// there was one.
+func (c *Completer) RemoveSpec(name string) bool {
+	_, ok := c.specs[name]
+	delete(c.specs, name)
+	return ok
+}
+
+// SpecNames returns the names of the commands with a spec, sorted.
+func (c *Completer) SpecNames() []string {
+	names := make([]string, 0, len(c.specs))
+	for name := range c.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Candidates returns the matches spec generates for req, in the order
+// generated. Directories found by the file and directory actions end in
+// "/".
+func (c *Completer) Candidates(spec *Spec, req Request) []string {
+	word := req.Word()
+	var matches []string
+	if spec.Actions&ActionFile != 0 {
+		matches = append(matches, c.FindFiles(word)...)
+	} else if spec.Actions&ActionDirectory != 0 {
+		matches = append(matches, c.findDirs(word)...)
+	}
+	if spec.Actions&ActionCommand != 0 {
+		matches = append(matches, c.FindMatches(word)...)
+	}
+	if spec.Actions&ActionBuiltin != 0 {
+		matches = append(matches, withPrefix(c.Builtins, word)...)
+	}
+	if spec.Actions&ActionVariable != 0 && c.Variables != nil {
+		matches = append(matches, withPrefix(c.Variables(), word)...)
+	}
+	if spec.Actions&ActionFunction != 0 && c.Functions != nil {
+		matches = append(matches, withPrefix(c.Functions(), word)...)
+	}
+	if spec.Actions&ActionAlias != 0 && c.Aliases != nil {
+		matches = append(matches, withPrefix(c.Aliases(), word)...)
+	}
+	if c.Generate != nil && (spec.WordList != "" || spec.Function != "" || spec.Command != "") {
+		matches = append(matches, c.Generate(spec, req)...)
+	}
+
+	if spec.Filter != "" {
+		matches = filter(matches, spec.Filter, word)
+	}
+	if spec.Prefix != "" || spec.Suffix != "" {
+		for i, m := range matches {
+			matches[i] = spec.Prefix + m + spec.Suffix
+		}
+	}
+
+	if spec.Options&OptionPlusDirs != 0 {
+		matches = append(matches, c.findDirs(word)...)
+	}
+	if len(matches) == 0 && spec.Options&OptionDefault != 0 {
+		matches = c.FindFiles(word)
+	} else if len(matches) == 0 && spec.Options&OptionDirNames != 0 {
+		matches = c.findDirs(word)
+	}
+	return matches
+}
+
+// findDirs returns the directories starting with prefix, each ending in
+// "/".
+func (c *Completer) findDirs(prefix string) []string {
+	var dirs []string
+	for _, m := range c.FindFiles(prefix) {
+		if strings.HasSuffix(m, "/") {
+			dirs = append(dirs, m)
+		}
+	}
+	return dirs
+}
+
+// filter removes the matches that match pattern, in which '&' stands for
+// word. A leading '!' removes those that do not match instead.
+func filter(matches []string, pattern, word string) []string {
+	keep := false
+	if strings.HasPrefix(pattern, "!") {
+		keep, pattern = true, pattern[1:]
+	}
+	pattern = strings.ReplaceAll(pattern, "&", expand.QuoteMeta(word))
+
+	var kept []string
+	for _, m := range matches {
+		if expand.Match(pattern, m) == keep {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// withPrefix returns the names starting with prefix.
+func withPrefix(names []string, prefix string) []string {
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
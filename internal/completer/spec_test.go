@@ -0,0 +1,122 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCandidates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "setup.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Completer{
+		Builtins:  []string{"set", "shopt"},
+		Dir:       func() string { return dir },
+		Getenv:    func(string) string { return "" },
+		Variables: func() []string { return []string{"HOME", "SHELL"} },
+		Aliases:   func() []string { return []string{"la", "ll"} },
+		Generate: func(spec *Spec, req Request) []string {
+			var matches []string
+			for _, w := range strings.Fields(spec.WordList) {
+				if strings.HasPrefix(w, req.Word()) {
+					matches = append(matches, w)
+				}
+			}
+			return matches
+		},
+	}
+
+	tests := []struct {
+		name     string
+		spec     Spec
+		word     string
+		expected []string
+	}{
+		{name: "files", spec: Spec{Actions: ActionFile}, word: "s", expected: []string{"setup.go", "src/"}},
+		{name: "directories", spec: Spec{Actions: ActionDirectory}, word: "s", expected: []string{"src/"}},
+		{name: "builtins and variables", spec: Spec{Actions: ActionBuiltin | ActionVariable}, word: "S", expected: []string{"SHELL"}},
+		{name: "aliases", spec: Spec{Actions: ActionAlias}, word: "l", expected: []string{"la", "ll"}},
+		{name: "word list", spec: Spec{WordList: "start stop status"}, word: "sta", expected: []string{"start", "status"}},
+		{name: "filter", spec: Spec{WordList: "a.go b.txt", Filter: "*.go"}, expected: []string{"b.txt"}},
+		{name: "negated filter", spec: Spec{WordList: "a.go b.txt", Filter: "!*.go"}, expected: []string{"a.go"}},
+		{name: "filter with word", spec: Spec{WordList: "x xy", Filter: "&"}, word: "x", expected: []string{"xy"}},
+		{name: "prefix and suffix", spec: Spec{WordList: "a", Prefix: "<", Suffix: ">"}, expected: []string{"<a>"}},
+		{name: "default", spec: Spec{WordList: "zz", Options: OptionDefault}, word: "se", expected: []string{"setup.go"}},
+		{name: "dirnames", spec: Spec{WordList: "zz", Options: OptionDirNames}, word: "s", expected: []string{"src/"}},
+		{name: "plusdirs", spec: Spec{WordList: "stop", Options: OptionPlusDirs}, word: "s", expected: []string{"stop", "src/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.Candidates(&tt.spec, Request{Words: []string{"cmd", tt.word}})
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Candidates(%+v, %q) = %q, want %q", tt.spec, tt.word, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompleteWithSpec(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "deploy.sh"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Request
+	c := &Completer{
+		Dir:    func() string { return dir },
+		Getenv: func(string) string { return "" },
+		Generate: func(spec *Spec, req Request) []string {
+			got = req
+			return strings.Fields(spec.WordList)
+		},
+	}
+	c.SetSpec("git", &Spec{WordList: "commit checkout clone"})
+	c.SetSpec("cd", &Spec{Actions: ActionDirectory})
+	c.SetSpec("mk", &Spec{WordList: "build", Options: OptionNoSpace})
+	c.SetSpec("run", &Spec{WordList: "docs deploy.sh", Options: OptionFileNames})
+
+	tests := []struct {
+		line       string
+		completion string
+		matches    []string
+	}{
+		{line: "git cl", completion: "one ", matches: []string{"clone"}},
+		{line: "git c", completion: "", matches: []string{"commit", "checkout", "clone"}},
+		{line: "/usr/bin/git ch", completion: "eckout ", matches: []string{"checkout"}},
+		{line: "cd d", completion: "ocs/", matches: []string{"docs/"}},
+		{line: "mk b", completion: "uild", matches: []string{"build"}},
+		{line: "run do", completion: "cs/", matches: []string{"docs/"}},
+		{line: "cat d", completion: "", matches: []string{"deploy.sh", "docs/"}},
+	}
+
+	for _, tt := range tests {
+		completion, matches := c.complete(tt.line)
+		if completion != tt.completion || !reflect.DeepEqual(matches, tt.matches) {
+			t.Errorf("complete(%q) = %q, %q; want %q, %q", tt.line, completion, matches, tt.completion, tt.matches)
+		}
+	}
+
+	c.complete("git commit -m x")
+	if want := []string{"git", "commit", "-m", "x"}; got.Line != "git commit -m x" || !reflect.DeepEqual(got.Words, want) {
+		t.Errorf("request = %+v, want words %q", got, want)
+	}
+
+	if !c.RemoveSpec("git") || c.RemoveSpec("git") {
+		t.Error("RemoveSpec(git) should succeed once")
+	}
+	if names := c.SpecNames(); !reflect.DeepEqual(names, []string{"cd", "mk", "run"}) {
+		t.Errorf("SpecNames() = %q", names)
+	}
+}
@@ -0,0 +1,542 @@
+package expand
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/vars"
+)
+
+// defaultIFS is used for field splitting when IFS is unset.
+const defaultIFS = " \t\n"
+
+// Env gives the expander access to shell parameters.
+type Env interface {
+	// Get returns the value of a variable or special parameter and whether
+	// it is set.
+	Get(name string) (string, bool)
+	// Set assigns a variable, as done by ${NAME:=word}.
+	Set(name, value string) error
+}
+
+// Expander performs word expansion against an Env.
+type Expander struct {
+	Env Env
+	// CmdSubst runs the body of a command substitution and returns what it
+	// wrote to standard output.
+	CmdSubst func(body *parser.List) (string, error)
+	// Positional returns the positional parameters $1, $2, ... so that
+	// "$@" can expand to one field per parameter. When it is nil, $@ and $*
+	// are looked up in Env like any other parameter.
+	Positional func() []string
+	// Array returns the elements of an indexed array variable and whether
+	// it is set, for ${NAME[index]} and "${NAME[@]}". When it is nil,
+	// every variable is an array of its one value.
+	Array func(name string) ([]string, bool)
+	Glob  GlobOptions
+}
+
+// Error is an expansion error such as the one raised by ${NAME:?message}.
+type Error struct {
+	Msg string
+	// Fatal is set for errors that end a non-interactive shell.
+	Fatal bool
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Fields expands words into command arguments: parameters are expanded,
+// unquoted results are split on IFS, fields with unquoted pattern
+// characters are replaced by the matching path names, and quotes are
+// removed. Words that expand to nothing unquoted produce no field.
+func (e *Expander) Fields(words []*parser.Word) ([]string, error) {
+	var fields []string
+	for _, word := range words {
+		b := &fieldBuilder{ifs: e.ifs()}
+		if err := e.expandParts(word.Parts, b, false); err != nil {
+			return nil, err
+		}
+		for _, f := range b.finish() {
+			if e.Glob.NoGlob || !HasMeta(f.pattern) {
+				fields = append(fields, f.value)
+				continue
+			}
+			matches := Glob(f.pattern, e.Glob)
+			switch {
+			case len(matches) > 0:
+				fields = append(fields, matches...)
+			case e.Glob.FailGlob:
+				return nil, &Error{Msg: "no match: " + f.value}
+			case !e.Glob.NullGlob:
+				fields = append(fields, f.value)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// Word expands a single word without field splitting, as done for
+// assignment values and redirection targets.
+func (e *Expander) Word(word *parser.Word) (string, error) {
+	b := &fieldBuilder{}
+	if err := e.expandParts(word.Parts, b, true); err != nil {
+		return "", err
+	}
+	var value string
+	for _, f := range b.finish() {
+		value += f.value
+	}
+	return value, nil
+}
+
+// Pattern expands word into a shell pattern for Match. Characters that
+// were quoted in the source are escaped so they only match literally.
+func (e *Expander) Pattern(word *parser.Word) (string, error) {
+	var b strings.Builder
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *parser.Lit:
+			if part.Quote == parser.Unquoted {
+				b.WriteString(part.Value)
+			} else {
+				b.WriteString(QuoteMeta(part.Value))
+			}
+		default:
+			value, quoted, err := e.expansion(part)
+			if err != nil {
+				return "", err
+			}
+			if quoted {
+				value = QuoteMeta(value)
+			}
+			b.WriteString(value)
+		}
+	}
+	return b.String(), nil
+}
+
+func (e *Expander) ifs() string {
+	if ifs, ok := e.Env.Get("IFS"); ok {
+		return ifs
+	}
+	return defaultIFS
+}
+
+// expandParts appends the expansion of parts to b. When quoted is set the
+// parts are treated as if they appeared inside double quotes.
+func (e *Expander) expandParts(parts []parser.WordPart, b *fieldBuilder, quoted bool) error {
+	for i, part := range parts {
+		if !quoted && e.isList(part) {
+			e.writeList(part.(*parser.ParamExp), b)
+			continue
+		}
+
+		switch part := part.(type) {
+		case *parser.Lit:
+			// The empty literal opening "$@" must not create a field when
+			// there are no positional parameters, nor that opening
+			// "${NAME[@]}" when the array is empty.
+			if part.Value == "" && part.Quote == parser.DoubleQuoted && i+1 < len(parts) && !quoted {
+				if param, ok := parts[i+1].(*parser.ParamExp); ok && param.Quoted && isAll(param) && e.isList(param) {
+					continue
+				}
+			}
+			if part.Quote == parser.Unquoted && !quoted {
+				b.writePattern(part.Value)
+			} else {
+				b.writeLiteral(part.Value)
+			}
+		default:
+			value, partQuoted, err := e.expansion(part)
+			if err != nil {
+				return err
+			}
+			if partQuoted || quoted {
+				b.writeLiteral(value)
+			} else {
+				b.writeSplit(value)
+			}
+		}
+	}
+	return nil
+}
+
+// isList reports whether part is a plain $@ or $* to be expanded from
+// e.Positional, or a plain ${NAME[@]} or ${NAME[*]}.
+func (e *Expander) isList(part parser.WordPart) bool {
+	param, ok := part.(*parser.ParamExp)
+	if !ok || param.Op != "" || param.Length {
+		return false
+	}
+	if param.Index != "" {
+		return param.Index == "@" || param.Index == "*"
+	}
+	return e.Positional != nil && (param.Name == "@" || param.Name == "*")
+}
+
+// isAll reports whether param is $@ or ${NAME[@]}, as opposed to $* or
+// ${NAME[*]}.
+func isAll(param *parser.ParamExp) bool {
+	return param.Index == "@" || param.Index == "" && param.Name == "@"
+}
+
+// writeList expands $@, $*, ${NAME[@]} or ${NAME[*]} in a context where
+// fields are split. Unquoted, each parameter or element is split on its
+// own. "$@" gives one field per parameter, the first and last joining the
+// text around them, and "$*" joins the parameters with the first
+// character of IFS; the array forms do the same with the elements.
+func (e *Expander) writeList(param *parser.ParamExp, b *fieldBuilder) {
+	var params []string
+	if param.Index != "" {
+		params, _ = e.elements(param.Name)
+	} else {
+		params = e.Positional()
+	}
+	switch {
+	case !param.Quoted:
+		for i, p := range params {
+			if i > 0 && b.has {
+				b.endField()
+			}
+			b.writeSplit(p)
+		}
+	case isAll(param):
+		for i, p := range params {
+			if i > 0 {
+				b.endField()
+			}
+			b.writeLiteral(p)
+		}
+	default:
+		sep := ""
+		if ifs := b.ifs; ifs != "" {
+			sep = ifs[:1]
+		}
+		b.writeLiteral(strings.Join(params, sep))
+	}
+}
+
+// expansion evaluates a parameter expansion or command substitution and
+// reports whether it appeared inside double quotes.
+func (e *Expander) expansion(part parser.WordPart) (string, bool, error) {
+	switch part := part.(type) {
+	case *parser.ParamExp:
+		value, err := e.param(part)
+		return value, part.Quoted, err
+	case *parser.CmdSubst:
+		value, err := e.cmdSubst(part)
+		return value, part.Quoted, err
+	}
+	panic(fmt.Sprintf("unknown word part %T", part))
+}
+
+// cmdSubst runs a command substitution, removing trailing newlines from
+// its output.
+func (e *Expander) cmdSubst(subst *parser.CmdSubst) (string, error) {
+	if e.CmdSubst == nil {
+		return "", &Error{Msg: fmt.Sprintf("%s: command substitution not supported", subst.Source)}
+	}
+	output, err := e.CmdSubst(subst.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(output, "\n"), nil
+}
+
+// param evaluates a parameter expansion to its string value.
+func (e *Expander) param(p *parser.ParamExp) (string, error) {
+	value, set, err := e.lookup(p)
+	if err != nil {
+		return "", err
+	}
+
+	if p.Length {
+		if p.Index == "@" || p.Index == "*" {
+			elems, _ := e.elements(p.Name)
+			return fmt.Sprint(len(elems)), nil
+		}
+		return fmt.Sprint(utf8.RuneCountInString(value)), nil
+	}
+
+	// For the colon forms an empty value counts as unset.
+	useDefault := !set || (value == "" && strings.HasPrefix(p.Op, ":"))
+
+	switch p.Op {
+	case "":
+		return value, nil
+	case ":-", "-":
+		if useDefault {
+			return e.Word(p.Arg)
+		}
+		return value, nil
+	case ":=", "=":
+		if !useDefault {
+			return value, nil
+		}
+		if !vars.IsName(p.Name) {
+			return "", &Error{Msg: fmt.Sprintf("$%s: cannot assign in this way", p.Name)}
+		}
+		if p.Index != "" {
+			return "", &Error{Msg: fmt.Sprintf("%s[%s]: cannot assign in this way", p.Name, p.Index)}
+		}
+		word, err := e.Word(p.Arg)
+		if err != nil {
+			return "", err
+		}
+		if err := e.Env.Set(p.Name, word); err != nil {
+			return "", err
+		}
+		return word, nil
+	case ":?", "?":
+		if !useDefault {
+			return value, nil
+		}
+		msg, err := e.Word(p.Arg)
+		if err != nil {
+			return "", err
+		}
+		if msg == "" {
+			msg = "parameter null or not set"
+		}
+		return "", &Error{Msg: fmt.Sprintf("%s: %s", p.Name, msg), Fatal: true}
+	case ":+", "+":
+		if useDefault {
+			return "", nil
+		}
+		return e.Word(p.Arg)
+	case "#", "##", "%", "%%":
+		pattern, err := e.Pattern(p.Arg)
+		if err != nil {
+			return "", err
+		}
+		return removePattern(value, pattern, p.Op), nil
+	}
+	return "", &Error{Msg: fmt.Sprintf("%s: bad substitution", p.Source)}
+}
+
+// lookup returns the value of the parameter p refers to and whether it is
+// set. With a subscript that is one element of an array, or for @ and *
+// all of them joined like "$@" and "$*" outside a field context.
+func (e *Expander) lookup(p *parser.ParamExp) (string, bool, error) {
+	if p.Index == "" {
+		value, set := e.Env.Get(p.Name)
+		return value, set, nil
+	}
+
+	elems, _ := e.elements(p.Name)
+	switch p.Index {
+	case "@":
+		return strings.Join(elems, " "), len(elems) > 0, nil
+	case "*":
+		sep := " "
+		if ifs, ok := e.Env.Get("IFS"); ok {
+			sep = ifs[:min(1, len(ifs))]
+		}
+		return strings.Join(elems, sep), len(elems) > 0, nil
+	}
+
+	i, err := e.subscript(p.Index)
+	if err != nil {
+		return "", false, err
+	}
+	if i < 0 {
+		i += len(elems)
+		if i < 0 {
+			return "", false, &Error{Msg: fmt.Sprintf("%s: bad array subscript", p.Name)}
+		}
+	}
+	if i >= len(elems) {
+		return "", false, nil
+	}
+	return elems[i], true, nil
+}
+
+// elements returns the elements of the array variable name and whether it
+// is set.
+func (e *Expander) elements(name string) ([]string, bool) {
+	if e.Array != nil {
+		return e.Array(name)
+	}
+	value, ok := e.Env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return []string{value}, true
+}
+
+// subscript evaluates an array subscript. Only sums and differences of
+// integers and variables are supported, which covers the subscripts
+// completion functions use, such as COMP_CWORD-1.
+func (e *Expander) subscript(index string) (int, error) {
+	bad := &Error{Msg: fmt.Sprintf("%s: syntax error in subscript", index)}
+	total := 0
+	s := index
+	for {
+		s = strings.TrimLeft(s, " \t")
+		sign := 1
+		for s != "" && (s[0] == '+' || s[0] == '-') {
+			if s[0] == '-' {
+				sign = -sign
+			}
+			s = strings.TrimLeft(s[1:], " \t")
+		}
+
+		end := strings.IndexFunc(s, func(r rune) bool {
+			return r != '$' && r != '_' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9')
+		})
+		if end < 0 {
+			end = len(s)
+		}
+		n, ok := e.subscriptTerm(s[:end])
+		if !ok {
+			return 0, bad
+		}
+		total += sign * n
+
+		s = strings.TrimLeft(s[end:], " \t")
+		if s == "" {
+			return total, nil
+		}
+		if s[0] != '+' && s[0] != '-' {
+			return 0, bad
+		}
+	}
+}
+
+// subscriptTerm evaluates an integer or a variable, with or without a
+// leading $, within a subscript. Unset and empty variables count as 0.
+func (e *Expander) subscriptTerm(term string) (int, bool) {
+	if n, err := strconv.Atoi(term); err == nil {
+		return n, true
+	}
+	name := strings.TrimPrefix(term, "$")
+	if !vars.IsName(name) {
+		return 0, false
+	}
+	value, _ := e.Env.Get(name)
+	if value = strings.TrimSpace(value); value == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil
+}
+
+// removePattern implements ${NAME#pattern} and friends: "#" and "##"
+// remove the shortest and longest matching prefix, "%" and "%%" the
+// shortest and longest matching suffix.
+func removePattern(value, pattern, op string) string {
+	runes := []rune(value)
+	n := len(runes)
+
+	switch op {
+	case "#":
+		for i := 0; i <= n; i++ {
+			if Match(pattern, string(runes[:i])) {
+				return string(runes[i:])
+			}
+		}
+	case "##":
+		for i := n; i >= 0; i-- {
+			if Match(pattern, string(runes[:i])) {
+				return string(runes[i:])
+			}
+		}
+	case "%":
+		for i := n; i >= 0; i-- {
+			if Match(pattern, string(runes[i:])) {
+				return string(runes[:i])
+			}
+		}
+	case "%%":
+		for i := 0; i <= n; i++ {
+			if Match(pattern, string(runes[i:])) {
+				return string(runes[:i])
+			}
+		}
+	}
+	return value
+}
+
+// field is one expanded field together with the pattern used for pathname
+// expansion, in which quoted characters are escaped.
+type field struct {
+	value   string
+	pattern string
+}
+
+// fieldBuilder collects the fields produced by expanding one word.
+type fieldBuilder struct {
+	ifs    string
+	fields []field
+	cur    strings.Builder
+	pat    strings.Builder
+	// has is set once the current field exists, even if it is empty, as
+	// for the quoted empty string "".
+	has bool
+	// afterSpace is set when IFS whitespace ended the previous field, so a
+	// following non-whitespace delimiter does not produce an empty field.
+	afterSpace bool
+}
+
+// writeLiteral appends quoted text, which is neither split nor used as a
+// pattern.
+func (b *fieldBuilder) writeLiteral(s string) {
+	b.cur.WriteString(s)
+	b.pat.WriteString(QuoteMeta(s))
+	b.has = true
+	b.afterSpace = false
+}
+
+// writePattern appends unquoted source text, which is not split but may
+// contain pattern characters.
+func (b *fieldBuilder) writePattern(s string) {
+	b.cur.WriteString(s)
+	b.pat.WriteString(s)
+	b.has = true
+	b.afterSpace = false
+}
+
+// writeSplit appends text that is split into fields on IFS.
+func (b *fieldBuilder) writeSplit(s string) {
+	for _, r := range s {
+		if !strings.ContainsRune(b.ifs, r) {
+			b.cur.WriteRune(r)
+			b.pat.WriteRune(r)
+			b.has = true
+			b.afterSpace = false
+			continue
+		}
+
+		if r == ' ' || r == '\t' || r == '\n' {
+			if b.has {
+				b.endField()
+				b.afterSpace = true
+			}
+			continue
+		}
+
+		if b.has || !b.afterSpace {
+			b.endField()
+		}
+		b.afterSpace = false
+	}
+}
+
+func (b *fieldBuilder) endField() {
+	b.fields = append(b.fields, field{value: b.cur.String(), pattern: b.pat.String()})
+	b.cur.Reset()
+	b.pat.Reset()
+	b.has = false
+}
+
+func (b *fieldBuilder) finish() []field {
+	if b.has {
+		b.endField()
+	}
+	return b.fields
+}
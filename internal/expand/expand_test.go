@@ -0,0 +1,302 @@
+package expand
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// mapEnv is a simple Env backed by a map.
+type mapEnv map[string]string
+
+func (m mapEnv) Get(name string) (string, bool) {
+	value, ok := m[name]
+	return value, ok
+}
+
+func (m mapEnv) Set(name, value string) error {
+	m[name] = value
+	return nil
+}
+
+// parseWords returns the words of the single simple command in src.
+func parseWords(t *testing.T, src string) []*parser.Word {
+	t.Helper()
+	list, err := parser.Parse(src)
+	if err != nil {
+		t.Fatalf("Parse(%q) unexpected error: %v", src, err)
+	}
+	return list.Items[0].Pipelines[0].Commands[0].(*parser.SimpleCommand).Args
+}
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		env      mapEnv
+		expected []string
+	}{
+		{name: "plain words", input: "echo a b", expected: []string{"echo", "a", "b"}},
+		{name: "simple variable", input: "echo $HOME", env: mapEnv{"HOME": "/root"}, expected: []string{"echo", "/root"}},
+		{name: "braced variable", input: "echo ${HOME}/bin", env: mapEnv{"HOME": "/root"}, expected: []string{"echo", "/root/bin"}},
+		{name: "single quotes stay literal", input: "echo '$HOME'", env: mapEnv{"HOME": "/root"}, expected: []string{"echo", "$HOME"}},
+		{name: "escaped dollar", input: `echo \$HOME`, env: mapEnv{"HOME": "/root"}, expected: []string{"echo", "$HOME"}},
+		{name: "unset unquoted vanishes", input: "echo $NOPE x", expected: []string{"echo", "x"}},
+		{name: "unset quoted is empty field", input: `echo "$NOPE" x`, expected: []string{"echo", "", "x"}},
+		{name: "unquoted splits on IFS", input: "echo $X", env: mapEnv{"X": " a  b "}, expected: []string{"echo", "a", "b"}},
+		{name: "double quotes prevent splitting", input: `echo "$X"`, env: mapEnv{"X": " a  b "}, expected: []string{"echo", " a  b "}},
+		{name: "split joins with literal prefix", input: "echo x$X", env: mapEnv{"X": "a b"}, expected: []string{"echo", "xa", "b"}},
+		{name: "custom IFS", input: "echo $P", env: mapEnv{"P": "/bin::/usr/bin", "IFS": ":"}, expected: []string{"echo", "/bin", "", "/usr/bin"}},
+		{name: "IFS whitespace around delimiter", input: "echo $P", env: mapEnv{"P": "a : b", "IFS": " :"}, expected: []string{"echo", "a", "b"}},
+		{name: "empty IFS disables splitting", input: "echo $X", env: mapEnv{"X": "a b", "IFS": ""}, expected: []string{"echo", "a b"}},
+		{name: "lone dollar is literal", input: "echo $ a$", expected: []string{"echo", "$", "a$"}},
+		{name: "special parameter", input: "echo $?", env: mapEnv{"?": "1"}, expected: []string{"echo", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env == nil {
+				tt.env = mapEnv{}
+			}
+			e := &Expander{Env: tt.env}
+			result, err := e.Fields(parseWords(t, tt.input))
+			if err != nil {
+				t.Fatalf("Fields(%q) unexpected error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Fields(%q)\n  got:  %q\n  want: %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParamModifiers(t *testing.T) {
+	env := mapEnv{
+		"F":     "path/to/file.tar.gz",
+		"EMPTY": "",
+		"NAME":  "shell",
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"${NAME:-x}", "shell"},
+		{"${UNSET:-x}", "x"},
+		{"${EMPTY:-x}", "x"},
+		{"${EMPTY-x}", ""},
+		{"${UNSET-x}", "x"},
+		{"${NAME:+alt}", "alt"},
+		{"${EMPTY:+alt}", ""},
+		{"${EMPTY+alt}", "alt"},
+		{"${UNSET:-$NAME}", "shell"},
+		{"${UNSET:-'a b'}", "a b"},
+		{"${#NAME}", "5"},
+		{"${#UNSET}", "0"},
+		{"${F#*/}", "to/file.tar.gz"},
+		{"${F##*/}", "file.tar.gz"},
+		{"${F%.*}", "path/to/file.tar"},
+		{"${F%%.*}", "path/to/file"},
+		{"${F#nomatch}", "path/to/file.tar.gz"},
+		{`${F%".gz"}`, "path/to/file.tar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			e := &Expander{Env: env}
+			result, err := e.Word(parseWords(t, "echo "+tt.input)[1])
+			if err != nil {
+				t.Fatalf("Word(%q) unexpected error: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("Word(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAssignDefault(t *testing.T) {
+	env := mapEnv{}
+	e := &Expander{Env: env}
+
+	result, err := e.Word(parseWords(t, "echo ${X:=fallback}")[1])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "fallback" || env["X"] != "fallback" {
+		t.Errorf("${X:=fallback} = %q with X=%q, want both fallback", result, env["X"])
+	}
+
+	// Positional and special parameters cannot be assigned, but are
+	// expanded as usual when set.
+	env = mapEnv{"2": "two", "?": ""}
+	e = &Expander{Env: env}
+	for _, name := range []string{"1", "?"} {
+		_, err = e.Word(parseWords(t, "echo ${"+name+":=x}")[1])
+		want := "$" + name + ": cannot assign in this way"
+		var expandErr *Error
+		if !errors.As(err, &expandErr) || err.Error() != want || expandErr.Fatal {
+			t.Errorf("${%s:=x} error = %v, want %q", name, err, want)
+		}
+	}
+	if result, err := e.Word(parseWords(t, "echo ${2:=x}")[1]); err != nil || result != "two" {
+		t.Errorf("${2:=x} = %q, %v; want %q", result, err, "two")
+	}
+	if len(env) != 2 || env["?"] != "" {
+		t.Errorf("env = %v after assigning to special parameters, want it unchanged", env)
+	}
+}
+
+func TestErrorIfUnset(t *testing.T) {
+	e := &Expander{Env: mapEnv{}}
+
+	_, err := e.Word(parseWords(t, "echo ${X:?is required}")[1])
+	if err == nil || err.Error() != "X: is required" {
+		t.Errorf("${X:?is required} error = %v, want %q", err, "X: is required")
+	}
+
+	_, err = e.Word(parseWords(t, "echo ${X:?}")[1])
+	if err == nil || err.Error() != "X: parameter null or not set" {
+		t.Errorf("${X:?} error = %v, want default message", err)
+	}
+
+	var expandErr *Error
+	if !errors.As(err, &expandErr) || !expandErr.Fatal {
+		t.Errorf("${X:?} error = %#v, want a fatal *Error", err)
+	}
+}
+
+func TestCmdSubst(t *testing.T) {
+	// The fake runner prints the arguments of the substituted command, one
+	// per line, like printf '%s\n'.
+	run := func(body *parser.List) (string, error) {
+		var out string
+		for _, word := range body.Items[0].Pipelines[0].Commands[0].(*parser.SimpleCommand).Args[1:] {
+			out += word.Value() + "\n"
+		}
+		return out, nil
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{input: "echo $(p a b)", expected: []string{"echo", "a", "b"}},
+		{input: `echo "$(p a b)"`, expected: []string{"echo", "a\nb"}},
+		{input: "echo x$(p a)y", expected: []string{"echo", "xay"}},
+		{input: "echo `p a b`", expected: []string{"echo", "a", "b"}},
+		{input: `echo "$(p '' '')"`, expected: []string{"echo", ""}},
+		{input: "echo $(p '' '')", expected: []string{"echo"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			e := &Expander{Env: mapEnv{}, CmdSubst: run}
+			result, err := e.Fields(parseWords(t, tt.input))
+			if err != nil {
+				t.Fatalf("Fields(%q) unexpected error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Fields(%q)\n  got:  %q\n  want: %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPositional(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		params   []string
+		env      mapEnv
+		expected []string
+	}{
+		{name: "quoted at", input: `echo "$@"`, params: []string{"a b", "c"}, expected: []string{"echo", "a b", "c"}},
+		{name: "quoted at without params", input: `echo "$@"`, expected: []string{"echo"}},
+		{name: "quoted at with prefix and suffix", input: `echo "x$@y"`, params: []string{"a", "b"}, expected: []string{"echo", "xa", "by"}},
+		{name: "quoted at keeps empty params", input: `echo "$@"`, params: []string{"", "b"}, expected: []string{"echo", "", "b"}},
+		{name: "unquoted at splits", input: "echo $@", params: []string{"a b", "c"}, expected: []string{"echo", "a", "b", "c"}},
+		{name: "unquoted at drops empty params", input: "echo $@", params: []string{"", "c"}, expected: []string{"echo", "c"}},
+		{name: "quoted star joins", input: `echo "$*"`, params: []string{"a b", "c"}, expected: []string{"echo", "a b c"}},
+		{name: "quoted star joins with IFS", input: `echo "$*"`, params: []string{"a", "b"}, env: mapEnv{"IFS": ":"}, expected: []string{"echo", "a:b"}},
+		{name: "unquoted star splits", input: "echo $*", params: []string{"a b", "c"}, expected: []string{"echo", "a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env == nil {
+				tt.env = mapEnv{}
+			}
+			e := &Expander{Env: tt.env, Positional: func() []string { return tt.params }}
+			result, err := e.Fields(parseWords(t, tt.input))
+			if err != nil {
+				t.Fatalf("Fields(%q) unexpected error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Fields(%q)\n  got:  %q\n  want: %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestArray(t *testing.T) {
+	arrays := map[string][]string{
+		"A":     {"a b", "c", "d"},
+		"EMPTY": {},
+	}
+	env := mapEnv{"A": "a b", "I": "1", "S": "scalar", "IFS": " \t\n"}
+	e := &Expander{Env: env, Array: func(name string) ([]string, bool) {
+		if elems, ok := arrays[name]; ok {
+			return elems, true
+		}
+		if value, ok := env[name]; ok {
+			return []string{value}, true
+		}
+		return nil, false
+	}}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "element", input: `echo "${A[1]}"`, expected: []string{"echo", "c"}},
+		{name: "variable subscript", input: `echo "${A[I]}" "${A[$I]}"`, expected: []string{"echo", "c", "c"}},
+		{name: "sum subscript", input: `echo "${A[I + 1]}" "${A[I-1]}"`, expected: []string{"echo", "d", "a b"}},
+		{name: "negative subscript", input: `echo "${A[-1]}"`, expected: []string{"echo", "d"}},
+		{name: "out of range", input: `echo "${A[5]-unset}"`, expected: []string{"echo", "unset"}},
+		{name: "name is first element", input: `echo "$A"`, expected: []string{"echo", "a b"}},
+		{name: "scalar as array", input: `echo "${S[0]}" "${#S[@]}"`, expected: []string{"echo", "scalar", "1"}},
+		{name: "quoted at", input: `echo "${A[@]}"`, expected: []string{"echo", "a b", "c", "d"}},
+		{name: "quoted at with prefix", input: `echo "x${A[@]}"`, expected: []string{"echo", "xa b", "c", "d"}},
+		{name: "quoted at of empty array", input: `echo "${EMPTY[@]}"`, expected: []string{"echo"}},
+		{name: "unquoted at splits", input: `echo ${A[@]}`, expected: []string{"echo", "a", "b", "c", "d"}},
+		{name: "quoted star joins", input: `echo "${A[*]}"`, expected: []string{"echo", "a b c d"}},
+		{name: "count", input: `echo ${#A[@]} ${#EMPTY[*]} ${#A[0]}`, expected: []string{"echo", "3", "0", "3"}},
+		{name: "element with default", input: `echo "${EMPTY[0]:-none}"`, expected: []string{"echo", "none"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.Fields(parseWords(t, tt.input))
+			if err != nil {
+				t.Fatalf("Fields(%q) unexpected error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Fields(%q)\n  got:  %q\n  want: %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+
+	for input, want := range map[string]string{
+		"${A[x y]}":  "x y: syntax error in subscript",
+		"${A[-9]}":   "A: bad array subscript",
+		"${A[5]:=x}": "A[5]: cannot assign in this way",
+	} {
+		if _, err := e.Word(parseWords(t, "echo "+input)[1]); err == nil || err.Error() != want {
+			t.Errorf("Word(%q) error = %v, want %q", input, err, want)
+		}
+	}
+}
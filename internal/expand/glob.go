@@ -0,0 +1,174 @@
+package expand
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GlobOptions control pathname expansion.
+type GlobOptions struct {
+	NoGlob   bool // set -f: disable pathname expansion
+	NullGlob bool // patterns matching nothing expand to no field
+	FailGlob bool // patterns matching nothing are an error
+	DotGlob  bool // '*', '?' and '[...]' also match a leading '.'
+	GlobStar bool // a "**" component matches any depth of directories
+	// Dir is the directory relative patterns are matched in. If it is
+	// empty the working directory is used. Matches stay relative. It lets
+	// a shell keep a working directory of its own instead of changing the
+	// process's, which an embedded shell must not do.
+	Dir string
+}
+
+// Glob returns the sorted paths matching pattern, which is matched one
+// '/'-separated component at a time. A leading '.' in a file name must be
+// matched explicitly unless DotGlob is set. A pattern ending in '/' only
+// matches directories.
+func Glob(pattern string, opts GlobOptions) []string {
+	prefix := ""
+	if strings.HasPrefix(pattern, "/") {
+		prefix = "/"
+		pattern = strings.TrimLeft(pattern, "/")
+	}
+
+	paths := []string{prefix}
+	components := strings.Split(pattern, "/")
+	for i, component := range components {
+		last := i == len(components)-1
+		var next []string
+		for _, path := range paths {
+			next = append(next, opts.globComponent(path, component, last)...)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		paths = next
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// globComponent matches one pattern component against the directory dir,
+// which is either empty or ends in '/'. Matches of inner components are
+// returned with a trailing '/' so the next component can be appended.
+func (o GlobOptions) globComponent(dir, component string, last bool) []string {
+	if component == "" {
+		// A trailing or doubled slash: dir itself is already a directory.
+		if dir == "" {
+			return nil
+		}
+		return []string{dir}
+	}
+
+	if !HasMeta(component) {
+		path := dir + unescapePattern(component)
+		if last {
+			if _, err := os.Lstat(o.path(path)); err == nil {
+				return []string{path}
+			}
+		} else if o.isDir(path) {
+			return []string{path + "/"}
+		}
+		return nil
+	}
+
+	if component == "**" && o.GlobStar {
+		return o.globStar(dir, last)
+	}
+
+	var matches []string
+	for _, name := range o.readDir(dir, component) {
+		if !Match(component, name) {
+			continue
+		}
+		if last {
+			matches = append(matches, dir+name)
+		} else if o.isDir(dir + name) {
+			matches = append(matches, dir+name+"/")
+		}
+	}
+	return matches
+}
+
+// globStar returns every file below dir for a final "**", or dir and every
+// directory below it for an inner one. Symbolic links to directories are
+// not followed.
+func (o GlobOptions) globStar(dir string, last bool) []string {
+	var matches []string
+	if !last {
+		matches = append(matches, dir)
+	}
+
+	for _, name := range o.readDir(dir, "*") {
+		path := dir + name
+		info, err := os.Lstat(o.path(path))
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			if last {
+				matches = append(matches, path)
+			}
+			matches = append(matches, o.globStar(path+"/", last)...)
+		} else if last {
+			matches = append(matches, path)
+		}
+	}
+	return matches
+}
+
+// readDir returns the names in dir that component may match, leaving out
+// hidden names unless the component starts with a literal '.'.
+func (o GlobOptions) readDir(dir, component string) []string {
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(o.path(dir))
+	if err != nil {
+		return nil
+	}
+
+	showHidden := o.DotGlob || strings.HasPrefix(component, ".") || strings.HasPrefix(component, `\.`)
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") && !showHidden {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func (o GlobOptions) isDir(path string) bool {
+	info, err := os.Stat(o.path(path))
+	return err == nil && info.IsDir()
+}
+
+// path returns the name by which path, as matched, is found on disk.
+func (o GlobOptions) path(path string) string {
+	if o.Dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(o.Dir, path)
+}
+
+// unescapePattern removes the backslashes that quote characters in a
+// pattern without metacharacters.
+func unescapePattern(pattern string) string {
+	if !strings.Contains(pattern, `\`) {
+		return pattern
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
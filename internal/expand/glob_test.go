@@ -0,0 +1,150 @@
+package expand
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// makeTree creates the given files below a new temporary directory, which
+// it returns. Names ending in '/' are created as directories.
+func makeTree(t *testing.T, names ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range names {
+		path := filepath.Join(root, name)
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestGlob(t *testing.T) {
+	root := makeTree(t,
+		"a.go", "b.go", "c.txt", ".hidden.go", "[x].go",
+		"src/main.go", "src/util/util.go", "src/.git/config", "docs/",
+	)
+
+	tests := []struct {
+		name     string
+		pattern  string
+		opts     GlobOptions
+		expected []string
+	}{
+		{name: "star", pattern: "*.go", expected: []string{"[x].go", "a.go", "b.go"}},
+		{name: "question mark", pattern: "?.txt", expected: []string{"c.txt"}},
+		{name: "bracket", pattern: "[ab].go", expected: []string{"a.go", "b.go"}},
+		{name: "escaped bracket", pattern: `\[x\].go`, expected: []string{"[x].go"}},
+		{name: "explicit dot", pattern: ".*.go", expected: []string{".hidden.go"}},
+		{name: "dotglob", pattern: "*.go", opts: GlobOptions{DotGlob: true}, expected: []string{".hidden.go", "[x].go", "a.go", "b.go"}},
+		{name: "directories only", pattern: "*/", expected: []string{"docs/", "src/"}},
+		{name: "inner component", pattern: "*/*.go", expected: []string{"src/main.go"}},
+		{name: "literal inner component", pattern: "src/*", expected: []string{"src/main.go", "src/util"}},
+		{name: "no match", pattern: "*.rs", expected: nil},
+		{name: "double star without globstar", pattern: "**/*.go", expected: []string{"src/main.go"}},
+		{
+			name: "globstar", pattern: "**/*.go", opts: GlobOptions{GlobStar: true},
+			expected: []string{"[x].go", "a.go", "b.go", "src/main.go", "src/util/util.go"},
+		},
+		{
+			name: "trailing globstar", pattern: "src/**", opts: GlobOptions{GlobStar: true},
+			expected: []string{"src/main.go", "src/util", "src/util/util.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result []string
+			for _, path := range Glob(root+"/"+tt.pattern, tt.opts) {
+				result = append(result, strings.TrimPrefix(path, root+"/"))
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Glob(%q)\n  got:  %q\n  want: %q", tt.pattern, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGlobDir(t *testing.T) {
+	root := makeTree(t, "a.go", "src/b.go", "src/c.txt", "src/deep/d.go", "docs/")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pattern  string
+		opts     GlobOptions
+		expected []string
+	}{
+		{pattern: "*.go", expected: []string{"a.go"}},
+		{pattern: "*/*.go", expected: []string{"src/b.go"}},
+		{pattern: "src/c.txt", expected: []string{"src/c.txt"}},
+		{pattern: "*/", expected: []string{"docs/", "src/"}},
+		{pattern: "src/*/", expected: []string{"src/deep/"}},
+		{pattern: "**/*.go", opts: GlobOptions{GlobStar: true}, expected: []string{"a.go", "src/b.go", "src/deep/d.go"}},
+		{pattern: "*.txt", expected: nil},
+		{pattern: "src/../*.go", expected: []string{"src/../a.go"}},
+		{pattern: root + "/*.go", expected: []string{root + "/a.go"}},
+		// The working directory of the process plays no part.
+		{pattern: "glob_test.go", expected: nil},
+		{pattern: wd + "/glob_test.go", expected: []string{wd + "/glob_test.go"}},
+	}
+
+	for _, tt := range tests {
+		tt.opts.Dir = root
+		if result := Glob(tt.pattern, tt.opts); !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Glob(%q) in dir\n  got:  %q\n  want: %q", tt.pattern, result, tt.expected)
+		}
+	}
+}
+
+func TestFieldsGlob(t *testing.T) {
+	root := makeTree(t, "a.go", "b.go", "c.txt")
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     GlobOptions
+		expected []string
+	}{
+		{name: "unquoted", input: "echo $D/*.go", expected: []string{"echo", root + "/a.go", root + "/b.go"}},
+		{name: "quoted star", input: `echo $D/"*".go`, expected: []string{"echo", root + "/*.go"}},
+		{name: "escaped star", input: `echo $D/\*.go`, expected: []string{"echo", root + "/*.go"}},
+		{name: "quoted variable", input: `echo "$D/*.go"`, expected: []string{"echo", root + "/*.go"}},
+		{name: "no match keeps word", input: "echo $D/*.rs", expected: []string{"echo", root + "/*.rs"}},
+		{name: "nullglob", input: "echo $D/*.rs", opts: GlobOptions{NullGlob: true}, expected: []string{"echo"}},
+		{name: "noglob", input: "echo $D/*.go", opts: GlobOptions{NoGlob: true}, expected: []string{"echo", root + "/*.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Expander{Env: mapEnv{"D": root}, Glob: tt.opts}
+			result, err := e.Fields(parseWords(t, tt.input))
+			if err != nil {
+				t.Fatalf("Fields(%q) unexpected error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Fields(%q)\n  got:  %q\n  want: %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+
+	e := &Expander{Env: mapEnv{"D": root}, Glob: GlobOptions{FailGlob: true}}
+	_, err := e.Fields(parseWords(t, "echo $D/*.rs"))
+	if err == nil || err.Error() != "no match: "+root+"/*.rs" {
+		t.Errorf("failglob error = %v, want no match", err)
+	}
+}
@@ -0,0 +1,167 @@
+package expand
+
+import "strings"
+
+// Match reports whether name matches the shell pattern. '*' matches any
+// string, '?' matches any single character and '[...]' matches one
+// character from a set, with '!' or '^' negating the set. A backslash makes
+// the following character literal.
+func Match(pattern, name string) bool {
+	return matchRunes([]rune(pattern), []rune(name))
+}
+
+func matchRunes(pattern, name []rune) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchRunes(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		case '[':
+			if len(name) == 0 {
+				return false
+			}
+			matched, width, ok := matchClass(pattern, name[0])
+			if ok {
+				if !matched {
+					return false
+				}
+				pattern = pattern[width:]
+				name = name[1:]
+				continue
+			}
+			// An unterminated '[' is an ordinary character.
+			if name[0] != '[' {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+func isAlpha(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' }
+func isDigit(r rune) bool { return r >= '0' && r <= '9' }
+
+// charClasses maps the POSIX character class names usable inside [...].
+var charClasses = map[string]func(rune) bool{
+	"alpha":  isAlpha,
+	"digit":  isDigit,
+	"alnum":  func(r rune) bool { return isAlpha(r) || isDigit(r) },
+	"upper":  func(r rune) bool { return r >= 'A' && r <= 'Z' },
+	"lower":  func(r rune) bool { return r >= 'a' && r <= 'z' },
+	"space":  func(r rune) bool { return strings.ContainsRune(" \t\n\r\v\f", r) },
+	"blank":  func(r rune) bool { return r == ' ' || r == '\t' },
+	"punct":  func(r rune) bool { return r > ' ' && r < 0x7f && !isAlpha(r) && !isDigit(r) },
+	"xdigit": func(r rune) bool { return isDigit(r) || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' },
+}
+
+// matchClass matches c against the bracket expression at the start of
+// pattern. It returns whether c matched, the width of the expression, and
+// false if the expression is not terminated.
+func matchClass(pattern []rune, c rune) (matched bool, width int, ok bool) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+
+	for first := true; i < len(pattern); first = false {
+		if pattern[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+
+		if pattern[i] == '[' && i+1 < len(pattern) && pattern[i+1] == ':' {
+			if end := classEnd(pattern[i+2:]); end >= 0 {
+				if class, ok := charClasses[string(pattern[i+2:i+2+end])]; ok && class(c) {
+					matched = true
+				}
+				i += 2 + end + 2
+				continue
+			}
+		}
+
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			i += 2
+		}
+		if c >= lo && c <= hi {
+			matched = true
+		}
+		i++
+	}
+	return false, 0, false
+}
+
+// classEnd returns the index of the ":]" that ends a character class name,
+// or -1 if there is none.
+func classEnd(rest []rune) int {
+	for j := 0; j+1 < len(rest); j++ {
+		if rest[j] == ':' && rest[j+1] == ']' {
+			return j
+		}
+	}
+	return -1
+}
+
+// HasMeta reports whether pattern contains an unescaped '*', '?' or '['.
+func HasMeta(pattern string) bool {
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*' || r == '?' || r == '[':
+			return true
+		}
+	}
+	return false
+}
+
+// QuoteMeta escapes every character of s that is special in a pattern.
+func QuoteMeta(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package expand
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"*.go", "main.go", true},
+		{"*.go", "main.gox", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"?", "x", true},
+		{"?", "", false},
+		{"file?.txt", "file1.txt", true},
+		{"[abc]", "b", true},
+		{"[abc]", "d", false},
+		{"[a-c]x", "bx", true},
+		{"[!a-c]", "d", true},
+		{"[^a-c]", "a", false},
+		{"[]]", "]", true},
+		{"[[:digit:]]*", "7up", true},
+		{"[[:upper:]]", "a", false},
+		{`\*`, "*", true},
+		{`\*`, "x", false},
+		{"[", "[", true},
+		{"a[", "a[", true},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHasMeta(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"plain", false},
+		{"*.go", true},
+		{"file?", true},
+		{"[ab]", true},
+		{`\*`, false},
+		{`a\?b*`, true},
+	}
+
+	for _, tt := range tests {
+		if got := HasMeta(tt.pattern); got != tt.want {
+			t.Errorf("HasMeta(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteMeta(t *testing.T) {
+	s := `a*b?[c]\d`
+	quoted := QuoteMeta(s)
+	if HasMeta(quoted) {
+		t.Errorf("QuoteMeta(%q) = %q still has meta characters", s, quoted)
+	}
+	if !Match(quoted, s) {
+		t.Errorf("QuoteMeta(%q) = %q does not match the original", s, quoted)
+	}
+}
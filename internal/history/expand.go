@@ -0,0 +1,356 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expand performs csh-style history expansion on line, which is not yet in
+// the history, and reports whether anything was expanded. It supports the
+// events !!, !n, !-n, !string and !?string?, the word designators
+// :n, :x-y, :^, :$ and :*, and the modifiers :h, :t, :r, :e and
+// :s/old/new/ ("gs" replaces every match). ^old^new at the start of the
+// line is short for !!:s/old/new/. A '!' inside single quotes, after a
+// backslash, or followed by a blank, '=', '(' or the end of the line is
+// left alone.
+func (h *History) Expand(line string) (string, bool, error) {
+	if strings.HasPrefix(line, "^") {
+		return h.quickSubstitute(line)
+	}
+
+	var b strings.Builder
+	expanded := false
+	inSingle, inDouble := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && !inSingle && i+1 < len(line):
+			b.WriteString(line[i : i+2])
+			i++
+			continue
+		case c == '\'' && !inDouble:
+			inSingle = !inSingle
+		case c == '"' && !inSingle:
+			inDouble = !inDouble
+		case c == '!' && !inSingle && !literalBang(line[i+1:], inDouble):
+			text, n, err := h.expandBang(line[i:], inDouble)
+			if err != nil {
+				return "", false, err
+			}
+			b.WriteString(text)
+			i += n - 1
+			expanded = true
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), expanded, nil
+}
+
+// literalBang reports whether a '!' followed by rest stands for itself.
+func literalBang(rest string, inDouble bool) bool {
+	if rest == "" {
+		return true
+	}
+	switch rest[0] {
+	case ' ', '\t', '\n', '=', '(':
+		return true
+	case '"':
+		return inDouble
+	}
+	return false
+}
+
+// expandBang expands the history reference at the start of s, which
+// starts with '!', and returns the text it stands for and its length.
+func (h *History) expandBang(s string, inDouble bool) (string, int, error) {
+	text, n, err := h.event(s, inDouble)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// A word designator follows the event after ':', or directly when it
+	// starts with '^', '$' or '*'.
+	if n < len(s) {
+		spec := n
+		if s[n] == ':' && n+1 < len(s) && isDesignator(s[n+1]) {
+			spec++
+		}
+		if spec > n || strings.IndexByte("^$*", s[n]) >= 0 {
+			words, m, err := selectWords(text, s[spec:])
+			if err != nil {
+				return "", 0, fmt.Errorf("%s: %v", s[:spec+m], err)
+			}
+			text, n = words, spec+m
+		}
+	}
+
+	text, m, err := modify(text, s[n:])
+	if err != nil {
+		return "", 0, err
+	}
+	return text, n + m, nil
+}
+
+// event finds the entry named by the event at the start of s and returns
+// it with the length of the event.
+func (h *History) event(s string, inDouble bool) (string, int, error) {
+	n := len(h.entries)
+	switch {
+	case strings.HasPrefix(s, "!!"):
+		return h.entry(n-1, s[:2], 2)
+	case len(s) > 1 && strings.IndexByte("^$*:", s[1]) >= 0:
+		return h.entry(n-1, s[:1], 1)
+	case len(s) > 1 && (isDigit(s[1]) || s[1] == '-' && len(s) > 2 && isDigit(s[2])):
+		end := 2
+		for end < len(s) && isDigit(s[end]) {
+			end++
+		}
+		num, err := strconv.Atoi(s[1:end])
+		if err != nil {
+			return "", 0, fmt.Errorf("%s: event not found", s[:end])
+		}
+		i := num - h.base - 1
+		if num < 0 {
+			i = n + num
+		}
+		return h.entry(i, s[:end], end)
+	case len(s) > 1 && s[1] == '?':
+		end := strings.IndexByte(s[2:], '?')
+		text, length := s[2:], len(s)
+		if end >= 0 {
+			text, length = s[2:2+end], end+3
+		}
+		for i := n - 1; i >= 0; i-- {
+			if strings.Contains(h.entries[i], text) {
+				return h.entries[i], length, nil
+			}
+		}
+		return "", 0, fmt.Errorf("%s: event not found", s[:length])
+	}
+
+	// A search string ends where a word designator or a new word starts.
+	end := 1
+	for end < len(s) && !strings.ContainsRune(" \t\n:^$*%-;&|<>()", rune(s[end])) && !(inDouble && s[end] == '"') {
+		end++
+	}
+	prefix := s[1:end]
+	for i := n - 1; i >= 0 && prefix != ""; i-- {
+		if strings.HasPrefix(h.entries[i], prefix) {
+			return h.entries[i], end, nil
+		}
+	}
+	return "", 0, fmt.Errorf("%s: event not found", s[:end])
+}
+
+// entry returns entry i, or an event not found error naming event.
+func (h *History) entry(i int, event string, length int) (string, int, error) {
+	if i < 0 || i >= len(h.entries) {
+		return "", 0, fmt.Errorf("%s: event not found", event)
+	}
+	return h.entries[i], length, nil
+}
+
+// isDesignator reports whether c can start a word designator after ':'.
+func isDesignator(c byte) bool {
+	return isDigit(c) || strings.IndexByte("^$*-", c) >= 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// selectWords returns the words of entry chosen by the word designator at
+// the start of spec, and the designator's length.
+func selectWords(entry, spec string) (string, int, error) {
+	words := Words(entry)
+	last := len(words) - 1
+
+	// number parses a word number or '$' at spec[i], or returns def.
+	number := func(i, def int) (int, int) {
+		if i < len(spec) && spec[i] == '$' {
+			return last, i + 1
+		}
+		end := i
+		for end < len(spec) && isDigit(spec[end]) {
+			end++
+		}
+		if end == i {
+			return def, i
+		}
+		n, _ := strconv.Atoi(spec[i:end])
+		return n, end
+	}
+
+	var from, to, n int
+	switch spec[0] {
+	case '^':
+		from, to, n = 1, 1, 1
+	case '*':
+		if last < 1 {
+			return "", 1, nil
+		}
+		from, to, n = 1, last, 1
+	default:
+		from, n = number(0, 0)
+		to = from
+		if n < len(spec) && spec[n] == '*' {
+			to, n = last, n+1
+		} else if n < len(spec) && spec[n] == '-' {
+			to, n = number(n+1, last-1)
+		}
+	}
+
+	if from < 0 || from > to || to > last {
+		return "", n, fmt.Errorf("bad word specifier")
+	}
+	return strings.Join(words[from:to+1], " "), n, nil
+}
+
+// modify applies the modifiers at the start of spec to text and returns
+// the result with the length of the modifiers.
+func modify(text, spec string) (string, int, error) {
+	n := 0
+	for n+1 < len(spec) && spec[n] == ':' {
+		switch spec[n+1] {
+		case 'h':
+			if i := strings.LastIndexByte(text, '/'); i > 0 {
+				text = text[:i]
+			} else if i == 0 {
+				text = "/"
+			}
+			n += 2
+		case 't':
+			text = text[strings.LastIndexByte(text, '/')+1:]
+			n += 2
+		case 'r':
+			if i := strings.LastIndexByte(text, '.'); i > strings.LastIndexByte(text, '/') {
+				text = text[:i]
+			}
+			n += 2
+		case 'e':
+			if i := strings.LastIndexByte(text, '.'); i > strings.LastIndexByte(text, '/') {
+				text = text[i:]
+			} else {
+				text = ""
+			}
+			n += 2
+		case 's', 'g':
+			start := n + 2
+			global := spec[n+1] == 'g'
+			if global {
+				if start >= len(spec) || spec[start] != 's' {
+					return "", 0, fmt.Errorf("%s: unrecognized history modifier", spec[n:min(start+1, len(spec))])
+				}
+				start++
+			}
+			result, m, err := substitute(text, spec[start:], global)
+			if err != nil {
+				return "", 0, err
+			}
+			text = result
+			n = start + m
+		default:
+			return "", 0, fmt.Errorf("%s: unrecognized history modifier", spec[n:n+2])
+		}
+	}
+	return text, n, nil
+}
+
+// substitute applies a substitution of the form /old/new/, where '/' may
+// be any delimiter and the final one may be left out at the end of the
+// line. An '&' in new stands for old. It returns the result and the length
+// of the substitution.
+func substitute(text, spec string, global bool) (string, int, error) {
+	if spec == "" {
+		return "", 0, fmt.Errorf("s: substitution failed")
+	}
+	delim := spec[0]
+	parts := make([]string, 0, 2)
+	i := 1
+	for len(parts) < 2 {
+		end := strings.IndexByte(spec[i:], delim)
+		if end < 0 {
+			parts = append(parts, spec[i:])
+			i = len(spec)
+			break
+		}
+		parts = append(parts, spec[i:i+end])
+		i += end + 1
+	}
+	if len(parts) < 2 {
+		parts = append(parts, "")
+	}
+
+	old, replacement := parts[0], strings.ReplaceAll(parts[1], "&", parts[0])
+	if old == "" || !strings.Contains(text, old) {
+		return "", 0, fmt.Errorf("%s: substitution failed", spec[:i])
+	}
+	if global {
+		return strings.ReplaceAll(text, old, replacement), i, nil
+	}
+	return strings.Replace(text, old, replacement, 1), i, nil
+}
+
+// quickSubstitute expands ^old^new^rest, which repeats the previous command
+// with old replaced by new and rest appended.
+func (h *History) quickSubstitute(line string) (string, bool, error) {
+	if len(h.entries) == 0 {
+		return "", false, fmt.Errorf("!!: event not found")
+	}
+	text, n, err := substitute(h.entries[len(h.entries)-1], line, false)
+	if err != nil {
+		return "", false, err
+	}
+	return text + line[n:], true, nil
+}
+
+// Words splits a command line into words the way history word designators
+// count them: at unquoted blanks, with each run of the operator characters
+// ;&|<>() forming a word of its own.
+func Words(line string) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			word.WriteByte(c)
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(line) {
+				i++
+				word.WriteByte(line[i])
+			}
+		case c == '\\' && i+1 < len(line):
+			word.WriteString(line[i : i+2])
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+			word.WriteByte(c)
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		case strings.IndexByte(";&|<>()", c) >= 0:
+			flush()
+			j := i
+			for j < len(line) && strings.IndexByte(";&|<>()", line[j]) >= 0 {
+				j++
+			}
+			words = append(words, line[i:j])
+			i = j - 1
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return words
+}
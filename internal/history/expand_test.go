@@ -0,0 +1,103 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	h := New(-1)
+	for _, line := range []string{
+		"git status",
+		"cp docs/notes.txt /usr/local/share/notes.txt",
+		`echo "hello world" | wc -c`,
+	} {
+		h.Add(line, Control{})
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		err      string
+	}{
+		{name: "no bang", input: "echo hi", expected: "echo hi"},
+		{name: "last command", input: "!!", expected: `echo "hello world" | wc -c`},
+		{name: "last command inside line", input: "sudo !!", expected: `sudo echo "hello world" | wc -c`},
+		{name: "absolute number", input: "!1", expected: "git status"},
+		{name: "relative number", input: "!-2", expected: "cp docs/notes.txt /usr/local/share/notes.txt"},
+		{name: "prefix", input: "!git", expected: "git status"},
+		{name: "prefix then text", input: "!git; ls", expected: "git status; ls"},
+		{name: "substring", input: "!?notes?", expected: "cp docs/notes.txt /usr/local/share/notes.txt"},
+		{name: "substring at end", input: "!?stat", expected: "git status"},
+		{name: "last word", input: "vi !$", expected: "vi -c"},
+		{name: "first argument", input: "echo !^", expected: `echo "hello world"`},
+		{name: "all arguments", input: "echo !-2:*", expected: "echo docs/notes.txt /usr/local/share/notes.txt"},
+		{name: "numbered word", input: "echo !2:2", expected: "echo /usr/local/share/notes.txt"},
+		{name: "word range", input: "echo !3:0-1", expected: `echo echo "hello world"`},
+		{name: "word after event", input: "echo !cp$", expected: "echo /usr/local/share/notes.txt"},
+		{name: "head", input: "cd !2:$:h", expected: "cd /usr/local/share"},
+		{name: "tail", input: "echo !2:$:t", expected: "echo notes.txt"},
+		{name: "root", input: "echo !2:1:r", expected: "echo docs/notes"},
+		{name: "extension", input: "echo !2:1:e", expected: "echo .txt"},
+		{name: "substitution", input: "!1:s/status/log/", expected: "git log"},
+		{name: "substitution with ampersand", input: "!1:s/git/&-x", expected: "git-x status"},
+		{name: "global substitution", input: "!2:gs/notes/todo/", expected: "cp docs/todo.txt /usr/local/share/todo.txt"},
+		{name: "quick substitution", input: "^hello^bye", expected: `echo "bye world" | wc -c`},
+		{name: "quick substitution with rest", input: "^-c^-l^ -w", expected: `echo "hello world" | wc -l -w`},
+		{name: "single quotes", input: "echo '!!'", expected: "echo '!!'"},
+		{name: "double quotes", input: `echo "!1"`, expected: `echo "git status"`},
+		{name: "bang before closing quote", input: `echo "hi!"`, expected: `echo "hi!"`},
+		{name: "escaped", input: `echo \!!`, expected: `echo \!!`},
+		{name: "followed by blank", input: "echo ! x", expected: "echo ! x"},
+		{name: "at end", input: "echo hi!", expected: "echo hi!"},
+		{name: "test negation", input: "[ ! -f x ]", expected: "[ ! -f x ]"},
+		{name: "unknown event", input: "!nope", err: "!nope: event not found"},
+		{name: "number out of range", input: "!9", err: "!9: event not found"},
+		{name: "bad word", input: "!1:5", err: "!1:5: bad word specifier"},
+		{name: "bad modifier", input: "!!:x", err: ":x: unrecognized history modifier"},
+		{name: "failed substitution", input: "^zzz^y", err: "^zzz^y: substitution failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, expanded, err := h.Expand(tt.input)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expand(%q) error = %v, want %q", tt.input, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expand(%q) unexpected error: %v", tt.input, err)
+			}
+			if got != tt.expected || expanded != (tt.input != tt.expected) {
+				t.Errorf("Expand(%q) = %q, %v; want %q", tt.input, got, expanded, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandEmptyHistory(t *testing.T) {
+	if _, _, err := New(-1).Expand("!!"); err == nil || err.Error() != "!!: event not found" {
+		t.Errorf("Expand(!!) error = %v, want event not found", err)
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{input: "ls -l", expected: []string{"ls", "-l"}},
+		{input: `echo "a b" 'c d' e\ f`, expected: []string{"echo", `"a b"`, "'c d'", `e\ f`}},
+		{input: "a|b && c>out", expected: []string{"a", "|", "b", "&&", "c", ">", "out"}},
+		{input: "  ", expected: nil},
+	}
+
+	for _, tt := range tests {
+		if got := Words(tt.input); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Words(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package history
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Control holds the HISTCONTROL settings, which decide what Add leaves out.
+type Control struct {
+	IgnoreSpace bool // lines starting with a space
+	IgnoreDups  bool // lines equal to the previous entry
+}
+
+// ParseControl parses a colon-separated HISTCONTROL value. "ignoreboth"
+// sets both settings; unknown words are ignored.
+func ParseControl(value string) Control {
+	var c Control
+	for _, word := range strings.Split(value, ":") {
+		switch word {
+		case "ignorespace":
+			c.IgnoreSpace = true
+		case "ignoredups":
+			c.IgnoreDups = true
+		case "ignoreboth":
+			c.IgnoreSpace, c.IgnoreDups = true, true
+		}
+	}
+	return c
+}
+
+// ErrOutOfRange is returned by Delete for a position not in the history.
+var ErrOutOfRange = errors.New("history position out of range")
+
+// History is the list of commands entered, numbered from 1. The numbers
+// stay the same when the oldest entries are dropped to respect the size
+// limit.
+type History struct {
+	entries []string
+	// base is the number of entries dropped from the front, so entries[i]
+	// has number base+i+1.
+	base int
+	// size limits the number of entries; negative means no limit.
+	size int
+	// appended is the number of leading entries already in the history
+	// file, so that AppendFile writes only the newer ones.
+	appended int
+}
+
+// New returns an empty History holding at most size entries, or any
+// number of them if size is negative.
+func New(size int) *History {
+	return &History{size: size}
+}
+
+// Add appends line unless it is empty or ctl leaves it out, and reports
+// whether it was added.
+func (h *History) Add(line string, ctl Control) bool {
+	if strings.TrimSpace(line) == "" {
+		return false
+	}
+	if ctl.IgnoreSpace && strings.HasPrefix(line, " ") {
+		return false
+	}
+	if ctl.IgnoreDups && len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return false
+	}
+	h.entries = append(h.entries, line)
+	h.trim()
+	return true
+}
+
+// SetSize changes the size limit, dropping the oldest entries if needed.
+func (h *History) SetSize(size int) {
+	h.size = size
+	h.trim()
+}
+
+func (h *History) trim() {
+	if h.size < 0 || len(h.entries) <= h.size {
+		return
+	}
+	n := len(h.entries) - h.size
+	h.entries = append([]string(nil), h.entries[n:]...)
+	h.base += n
+	h.appended = max(0, h.appended-n)
+}
+
+// Len returns the number of entries.
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// Entries returns the entries, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Number returns the number of the entry at index i of Entries.
+func (h *History) Number(i int) int {
+	return h.base + i + 1
+}
+
+// Clear removes every entry.
+func (h *History) Clear() {
+	h.entries = nil
+	h.appended = 0
+}
+
+// Delete removes the entry with number n. A negative n counts back from
+// the end, -1 being the last entry.
+func (h *History) Delete(n int) error {
+	i := n - h.base - 1
+	if n < 0 {
+		i = len(h.entries) + n
+	}
+	if i < 0 || i >= len(h.entries) {
+		return ErrOutOfRange
+	}
+	h.entries = append(h.entries[:i], h.entries[i+1:]...)
+	if i < h.appended {
+		h.appended--
+	}
+	return nil
+}
+
+// ReadFile appends the lines of the history file at path to the history.
+// They count as already saved.
+func (h *History) ReadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	h.trim()
+	h.appended = len(h.entries)
+	return scanner.Err()
+}
+
+// WriteFile replaces the history file at path with the entries, keeping
+// at most fileSize lines, or all of them if fileSize is negative.
+func (h *History) WriteFile(path string, fileSize int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(joinLines(lastLines(h.entries, fileSize))); err != nil {
+		return err
+	}
+	h.appended = len(h.entries)
+	return nil
+}
+
+// AppendFile appends the entries added since the history file was last
+// read, written or appended to, then cuts the file down to its last
+// fileSize lines unless fileSize is negative. The file is locked
+// throughout, so concurrent shells each add their own entries without
+// losing the others'.
+func (h *History) AppendFile(path string, fileSize int) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(joinLines(h.entries[h.appended:])); err != nil {
+		return err
+	}
+	h.appended = len(h.entries)
+	if fileSize < 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= fileSize {
+		return nil
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteString(strings.Join(lines[len(lines)-fileSize:], ""))
+	return err
+}
+
+// lastLines returns the entries making up the last n lines, or all of
+// them if n is negative.
+func lastLines(entries []string, n int) []string {
+	if n < 0 {
+		return entries
+	}
+	lines := strings.Split(strings.Join(entries, "\n"), "\n")
+	if len(entries) == 0 || len(lines) <= n {
+		return entries
+	}
+	return lines[len(lines)-n:]
+}
+
+// joinLines returns the entries as text with each entry on its own line.
+func joinLines(entries []string) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	return strings.Join(entries, "\n") + "\n"
+}
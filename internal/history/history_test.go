@@ -0,0 +1,176 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseControl(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Control
+	}{
+		{value: "", expected: Control{}},
+		{value: "ignorespace", expected: Control{IgnoreSpace: true}},
+		{value: "ignoredups:ignorespace", expected: Control{IgnoreSpace: true, IgnoreDups: true}},
+		{value: "ignoreboth", expected: Control{IgnoreSpace: true, IgnoreDups: true}},
+		{value: "erasedups", expected: Control{}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseControl(tt.value); got != tt.expected {
+			t.Errorf("ParseControl(%q) = %+v, want %+v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctl      Control
+		lines    []string
+		expected []string
+	}{
+		{name: "plain", lines: []string{"ls", "ls", " pwd"}, expected: []string{"ls", "ls", " pwd"}},
+		{name: "blank lines", lines: []string{"", "  ", "ls"}, expected: []string{"ls"}},
+		{name: "ignorespace", ctl: Control{IgnoreSpace: true}, lines: []string{" secret", "ls"}, expected: []string{"ls"}},
+		{name: "ignoredups", ctl: Control{IgnoreDups: true}, lines: []string{"ls", "ls", "pwd", "ls"}, expected: []string{"ls", "pwd", "ls"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(-1)
+			for _, line := range tt.lines {
+				h.Add(line, tt.ctl)
+			}
+			if !reflect.DeepEqual(h.Entries(), tt.expected) {
+				t.Errorf("entries = %q, want %q", h.Entries(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestSizeKeepsNumbers(t *testing.T) {
+	h := New(2)
+	for _, line := range []string{"a", "b", "c"} {
+		h.Add(line, Control{})
+	}
+	if !reflect.DeepEqual(h.Entries(), []string{"b", "c"}) {
+		t.Fatalf("entries = %q, want the last two", h.Entries())
+	}
+	if h.Number(0) != 2 || h.Number(1) != 3 {
+		t.Errorf("numbers = %d, %d, want 2, 3", h.Number(0), h.Number(1))
+	}
+
+	h.SetSize(1)
+	if !reflect.DeepEqual(h.Entries(), []string{"c"}) || h.Number(0) != 3 {
+		t.Errorf("after SetSize(1): entries %q numbered from %d", h.Entries(), h.Number(0))
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		expected []string
+		err      error
+	}{
+		{name: "first", n: 1, expected: []string{"b", "c"}},
+		{name: "last", n: 3, expected: []string{"a", "b"}},
+		{name: "negative", n: -1, expected: []string{"a", "b"}},
+		{name: "negative first", n: -3, expected: []string{"b", "c"}},
+		{name: "zero", n: 0, expected: []string{"a", "b", "c"}, err: ErrOutOfRange},
+		{name: "past the end", n: 4, expected: []string{"a", "b", "c"}, err: ErrOutOfRange},
+		{name: "before the start", n: -4, expected: []string{"a", "b", "c"}, err: ErrOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(-1)
+			for _, line := range []string{"a", "b", "c"} {
+				h.Add(line, Control{})
+			}
+			if err := h.Delete(tt.n); err != tt.err {
+				t.Errorf("Delete(%d) error = %v, want %v", tt.n, err, tt.err)
+			}
+			if !reflect.DeepEqual(h.Entries(), tt.expected) {
+				t.Errorf("entries = %q, want %q", h.Entries(), tt.expected)
+			}
+		})
+	}
+}
+
+func readLines(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAppendFileFromTwoSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := New(-1), New(-1)
+	for _, h := range []*History{first, second} {
+		if err := h.ReadFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first.Add("one", Control{})
+	second.Add("two", Control{})
+	if err := first.AppendFile(path, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.AppendFile(path, -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, path); got != "old\none\ntwo\n" {
+		t.Errorf("file = %q, want both sessions' entries", got)
+	}
+
+	// Appending again writes nothing new.
+	if err := first.AppendFile(path, -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, path); got != "old\none\ntwo\n" {
+		t.Errorf("file after second append = %q", got)
+	}
+}
+
+func TestFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := New(-1)
+	for _, line := range []string{"a", "b", "c"} {
+		h.Add(line, Control{})
+	}
+
+	if err := h.WriteFile(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, path); got != "b\nc\n" {
+		t.Errorf("WriteFile(2) wrote %q", got)
+	}
+
+	h.Add("d", Control{})
+	if err := h.AppendFile(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLines(t, path); got != "c\nd\n" {
+		t.Errorf("AppendFile(2) left %q", got)
+	}
+
+	h.Clear()
+	if err := h.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h.Entries(), []string{"c", "d"}) {
+		t.Errorf("ReadFile entries = %q", h.Entries())
+	}
+}
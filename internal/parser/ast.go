@@ -0,0 +1,253 @@
+package parser
+
+// Node is implemented by every node of the syntax tree.
+type Node interface {
+	Pos() Pos
+}
+
+// List is a sequence of and-or lists separated by ";" or newlines, such as
+// the body of a script, a subshell or a brace group.
+type List struct {
+	Position Pos
+	Items    []*AndOr
+}
+
+// AndOr is a chain of pipelines joined by "&&" and "||". Ops[i] is the
+// operator between Pipelines[i] and Pipelines[i+1]. Background is set when
+// the list was terminated by "&".
+type AndOr struct {
+	Pipelines  []*Pipeline
+	Ops        []string
+	Background bool
+	Source     string // the original text, without the terminator
+}
+
+// Pipeline is one or more commands connected by "|". A leading "!" inverts
+// the exit status of the pipeline.
+type Pipeline struct {
+	Position Pos
+	Negated  bool
+	Commands []Command
+	Source   string // the original text
+}
+
+// Command is implemented by every node that can appear as a pipeline stage.
+type Command interface {
+	Node
+	command()
+}
+
+// SimpleCommand is a command name with its arguments and redirections,
+// optionally preceded by variable assignments.
+type SimpleCommand struct {
+	Position Pos
+	Assigns  []*Assign
+	Args     []*Word
+	Redirs   []*Redirect
+}
+
+// Assign is a NAME=value word before the command name. For an array
+// assignment, NAME=(word...), Array is set and Elems holds the words
+// while Value is empty.
+type Assign struct {
+	Position Pos
+	Name     string
+	Value    *Word
+	Array    bool
+	Elems    []*Word
+}
+
+// Subshell is a list run in a separate shell environment: ( list ).
+type Subshell struct {
+	Position Pos
+	Body     *List
+	Redirs   []*Redirect
+}
+
+// Group is a list run in the current shell environment: { list; }.
+type Group struct {
+	Position Pos
+	Body     *List
+	Redirs   []*Redirect
+}
+
+// If is an if command. Conds[i] is the condition guarding Bodies[i]: the
+// first for "if" and one more for each "elif". Else is nil when there is
+// no else branch.
+type If struct {
+	Position Pos
+	Conds    []*List
+	Bodies   []*List
+	Else     *List
+	Redirs   []*Redirect
+}
+
+// While is a while loop, or an until loop when Until is set, which runs
+// Body for as long as Cond succeeds, or fails for until.
+type While struct {
+	Position Pos
+	Until    bool
+	Cond     *List
+	Body     *List
+	Redirs   []*Redirect
+}
+
+// For is a for loop assigning each expanded word to the variable Name in
+// turn. Without "in", In is false and the loop runs over "$@".
+type For struct {
+	Position Pos
+	Name     string
+	In       bool
+	Words    []*Word
+	Body     *List
+	Redirs   []*Redirect
+}
+
+// Case is a case command that runs the body of the first item with a
+// pattern matching Word.
+type Case struct {
+	Position Pos
+	Word     *Word
+	Items    []*CaseItem
+	Redirs   []*Redirect
+}
+
+// CaseItem is one "pattern | pattern) list ;;" clause of a case command.
+// Body may be empty.
+type CaseItem struct {
+	Position Pos
+	Patterns []*Word
+	Body     *List
+}
+
+// FuncDef defines a function, written "name() body" or "function name
+// body", whose body is a compound command. Source is the text of the whole
+// definition.
+type FuncDef struct {
+	Position Pos
+	Name     string
+	Body     Command
+	Source   string
+}
+
+// Redirect is a single I/O redirection such as "2>> err.log". Fd is -1 when
+// no explicit descriptor number precedes the operator. For the
+// here-document operators "<<" and "<<-" Target is the delimiter and
+// Heredoc holds the body.
+type Redirect struct {
+	Position Pos
+	Fd       int
+	Op       string
+	Target   *Word
+	Heredoc  *Word
+}
+
+// Word is a shell word made of one or more parts that each carry the
+// quoting context they appeared in.
+type Word struct {
+	Position Pos
+	Parts    []WordPart
+}
+
+// WordPart is implemented by every element of a Word.
+type WordPart interface {
+	wordPart()
+}
+
+// Quote describes the quoting context of a piece of a word.
+type Quote int
+
+const (
+	Unquoted     Quote = iota // plain text
+	SingleQuoted              // inside '...'
+	DoubleQuoted              // inside "..."
+	Escaped                   // a single character preceded by a backslash
+)
+
+// Lit is literal text with its quoting context. Quote removal has already
+// been applied to Value.
+type Lit struct {
+	Value string
+	Quote Quote
+}
+
+// ParamExp is a parameter expansion such as $HOME, ${#PATH},
+// ${NAME:-default} or ${NAME[1]}. Quoted is set when it appeared inside
+// double quotes.
+type ParamExp struct {
+	Name   string
+	Index  string // the subscript of ${NAME[index]}, unevaluated
+	Op     string // "", or one of :- - := = :? ? :+ + # ## % %%
+	Arg    *Word  // operand of Op, nil when Op is ""
+	Length bool   // ${#NAME}
+	Quoted bool
+	Source string // the original text, e.g. "${NAME:-default}"
+}
+
+// CmdSubst is a command substitution, either $(...) or `...`. Quoted is
+// set when it appeared inside double quotes.
+type CmdSubst struct {
+	Body   *List
+	Quoted bool
+	Source string // the original text, e.g. "$(pwd)"
+}
+
+func (l *List) Pos() Pos          { return l.Position }
+func (a *AndOr) Pos() Pos         { return a.Pipelines[0].Position }
+func (p *Pipeline) Pos() Pos      { return p.Position }
+func (c *SimpleCommand) Pos() Pos { return c.Position }
+func (s *Subshell) Pos() Pos      { return s.Position }
+func (g *Group) Pos() Pos         { return g.Position }
+func (i *If) Pos() Pos            { return i.Position }
+func (w *While) Pos() Pos         { return w.Position }
+func (f *For) Pos() Pos           { return f.Position }
+func (c *Case) Pos() Pos          { return c.Position }
+func (c *CaseItem) Pos() Pos      { return c.Position }
+func (f *FuncDef) Pos() Pos       { return f.Position }
+func (a *Assign) Pos() Pos        { return a.Position }
+func (r *Redirect) Pos() Pos      { return r.Position }
+func (w *Word) Pos() Pos          { return w.Position }
+
+func (*SimpleCommand) command() {}
+func (*Subshell) command()      {}
+func (*Group) command()         {}
+func (*If) command()            {}
+func (*While) command()         {}
+func (*For) command()           {}
+func (*Case) command()          {}
+func (*FuncDef) command()       {}
+
+func (*Lit) wordPart()      {}
+func (*ParamExp) wordPart() {}
+func (*CmdSubst) wordPart() {}
+
+// Lit returns the text of w when it consists only of unquoted literal
+// parts. Reserved words and operators are only recognised in that case.
+func (w *Word) Lit() (string, bool) {
+	var value string
+	for _, part := range w.Parts {
+		lit, ok := part.(*Lit)
+		if !ok || lit.Quote != Unquoted {
+			return "", false
+		}
+		value += lit.Value
+	}
+	return value, true
+}
+
+// Value returns the text of w with quotes removed. Expansions are not
+// performed and appear in their original source form.
+func (w *Word) Value() string {
+	var value string
+	for _, part := range w.Parts {
+		switch part := part.(type) {
+		case *Lit:
+			value += part.Value
+		case *ParamExp:
+			value += part.Source
+		case *CmdSubst:
+			value += part.Source
+		}
+	}
+	return value
+}
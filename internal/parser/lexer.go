@@ -0,0 +1,704 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a location in the source text. Line and Col are 1-based.
+type Pos struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// TokenKind identifies the kind of a lexical token.
+type TokenKind int
+
+const (
+	EOF      TokenKind = iota // end of input
+	Newline                   // an unquoted newline
+	WordTok                   // a shell word, see Token.Word
+	IONumber                  // digits directly followed by '<' or '>'
+	Operator                  // a control or redirection operator
+)
+
+// Token is a lexical token. Value holds the operator text or the IONumber
+// digits; Word is set for WordTok tokens.
+type Token struct {
+	Kind  TokenKind
+	Pos   Pos
+	Value string
+	Word  *Word
+}
+
+func (t Token) String() string {
+	switch t.Kind {
+	case EOF:
+		return "end of file"
+	case Newline:
+		return "newline"
+	case WordTok:
+		return t.Word.Value()
+	}
+	return t.Value
+}
+
+// operators lists every operator the lexer recognises, longest first so
+// that the first prefix match is also the longest one.
+var operators = []string{
+	"&>>", "<<-", "<<<",
+	"<<",
+	"&&", "||", ";;", ">>", ">&", "<&", "<>", ">|", "&>",
+	"|", "&", ";", "(", ")", "<", ">",
+}
+
+// Lexer splits shell source into tokens, keeping track of quoting and
+// source positions.
+type Lexer struct {
+	src  []rune
+	off  int
+	line int
+	col  int
+	// heredocs are the here-document redirections whose bodies start after
+	// the next newline.
+	heredocs []*Redirect
+	// aliases looks up the aliases expanded by parsers reading from the
+	// lexer, including those of command substitutions.
+	aliases func(name string) (string, bool)
+}
+
+// NewLexer returns a Lexer reading from src.
+func NewLexer(src string) *Lexer {
+	return &Lexer{src: []rune(src), line: 1, col: 1}
+}
+
+func (l *Lexer) pos() Pos {
+	return Pos{Offset: l.off, Line: l.line, Col: l.col}
+}
+
+func (l *Lexer) peek() (rune, bool) {
+	if l.off >= len(l.src) {
+		return 0, false
+	}
+	return l.src[l.off], true
+}
+
+func (l *Lexer) peekAt(n int) (rune, bool) {
+	if l.off+n >= len(l.src) {
+		return 0, false
+	}
+	return l.src[l.off+n], true
+}
+
+func (l *Lexer) advance() rune {
+	r := l.src[l.off]
+	l.off++
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *Lexer) hasPrefix(s string) bool {
+	i := l.off
+	for _, r := range s {
+		if i >= len(l.src) || l.src[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// isMeta reports whether r ends an unquoted word.
+func isMeta(r rune) bool {
+	return strings.ContainsRune(" \t\n|&;<>()", r)
+}
+
+// Next returns the next token. On an unterminated quote it returns an
+// error together with the partial word read so far.
+func (l *Lexer) Next() (Token, error) {
+	l.skipBlanks()
+
+	start := l.pos()
+	r, ok := l.peek()
+	if !ok {
+		if len(l.heredocs) > 0 {
+			return Token{}, l.heredocError(start)
+		}
+		return Token{Kind: EOF, Pos: start}, nil
+	}
+
+	if r == '\n' {
+		l.advance()
+		if err := l.readHeredocs(); err != nil {
+			return Token{}, err
+		}
+		return Token{Kind: Newline, Pos: start, Value: "\n"}, nil
+	}
+
+	for _, op := range operators {
+		if l.hasPrefix(op) {
+			for range op {
+				l.advance()
+			}
+			return Token{Kind: Operator, Pos: start, Value: op}, nil
+		}
+	}
+
+	word, err := l.readWord()
+	tok := Token{Kind: WordTok, Pos: start, Word: word}
+	if err != nil {
+		return tok, err
+	}
+
+	if next, ok := l.peek(); ok && (next == '<' || next == '>') {
+		if digits, ok := word.Lit(); ok && isDigits(digits) {
+			return Token{Kind: IONumber, Pos: start, Value: digits}, nil
+		}
+	}
+
+	return tok, nil
+}
+
+// skipBlanks skips spaces, tabs, line continuations and comments.
+func (l *Lexer) skipBlanks() {
+	for {
+		r, ok := l.peek()
+		switch {
+		case !ok:
+			return
+		case r == ' ' || r == '\t':
+			l.advance()
+		case r == '\\':
+			if next, ok := l.peekAt(1); ok && next == '\n' {
+				l.advance()
+				l.advance()
+				continue
+			}
+			return
+		case r == '#':
+			for r, ok := l.peek(); ok && r != '\n'; r, ok = l.peek() {
+				l.advance()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// wordBuilder accumulates word parts, merging adjacent literals that share
+// the same quoting context.
+type wordBuilder struct {
+	word *Word
+	buf  strings.Builder
+	kind Quote
+	open bool
+}
+
+func (b *wordBuilder) add(s string, kind Quote) {
+	if b.open && b.kind != kind {
+		b.flush()
+	}
+	b.kind = kind
+	b.open = true
+	b.buf.WriteString(s)
+}
+
+func (b *wordBuilder) flush() {
+	if b.open {
+		b.word.Parts = append(b.word.Parts, &Lit{Value: b.buf.String(), Quote: b.kind})
+		b.buf.Reset()
+		b.open = false
+	}
+}
+
+// addPart appends a non-literal part such as an expansion.
+func (b *wordBuilder) addPart(part WordPart) {
+	b.flush()
+	b.word.Parts = append(b.word.Parts, part)
+}
+
+// readWord reads a word up to the next unquoted metacharacter.
+func (l *Lexer) readWord() (*Word, error) {
+	b := &wordBuilder{word: &Word{Position: l.pos()}}
+
+	for {
+		r, ok := l.peek()
+		if !ok || isMeta(r) {
+			break
+		}
+
+		switch r {
+		case '\'':
+			if err := l.readSingleQuoted(b); err != nil {
+				b.flush()
+				return b.word, err
+			}
+		case '"':
+			if err := l.readDoubleQuoted(b); err != nil {
+				b.flush()
+				return b.word, err
+			}
+		case '\\':
+			l.advance()
+			next, ok := l.peek()
+			if !ok {
+				break
+			}
+			l.advance()
+			if next != '\n' {
+				b.add(string(next), Escaped)
+			}
+		case '$':
+			if err := l.readDollar(b, false); err != nil {
+				b.flush()
+				return b.word, err
+			}
+		case '`':
+			if err := l.readBackquote(b, false); err != nil {
+				b.flush()
+				return b.word, err
+			}
+		default:
+			b.add(string(l.advance()), Unquoted)
+		}
+	}
+
+	b.flush()
+	return b.word, nil
+}
+
+// readSingleQuoted reads '...' where every character is literal.
+func (l *Lexer) readSingleQuoted(b *wordBuilder) error {
+	start := l.pos()
+	l.advance()
+	b.add("", SingleQuoted)
+	for {
+		r, ok := l.peek()
+		if !ok {
+			return &Error{Pos: start, Msg: "unexpected EOF while looking for matching `''", Incomplete: true}
+		}
+		l.advance()
+		if r == '\'' {
+			return nil
+		}
+		b.add(string(r), SingleQuoted)
+	}
+}
+
+// readDoubleQuoted reads "..." where a backslash only escapes $, `, ", \
+// and newline, and is kept literally before any other character.
+func (l *Lexer) readDoubleQuoted(b *wordBuilder) error {
+	start := l.pos()
+	l.advance()
+	b.add("", DoubleQuoted)
+	closed, err := l.readDoubleQuotedText(b, false)
+	if err != nil {
+		return err
+	}
+	if !closed {
+		return &Error{Pos: start, Msg: "unexpected EOF while looking for matching `\"'", Incomplete: true}
+	}
+	return nil
+}
+
+// readDoubleQuotedText reads text with double-quote semantics up to the
+// closing '"', reporting whether it was found. In a here-document body
+// the text runs to the end of input and '"' is an ordinary character.
+func (l *Lexer) readDoubleQuotedText(b *wordBuilder, heredoc bool) (closed bool, err error) {
+	for {
+		r, ok := l.peek()
+		if !ok {
+			return false, nil
+		}
+		if r == '$' || r == '`' {
+			if err := l.readExpansion(b, true); err != nil {
+				return false, err
+			}
+			continue
+		}
+		l.advance()
+		switch {
+		case r == '"' && !heredoc:
+			return true, nil
+		case r == '\\':
+			next, ok := l.peek()
+			if !ok {
+				b.add("\\", DoubleQuoted)
+				continue
+			}
+			switch {
+			case next == '\n':
+				l.advance()
+			case next == '$' || next == '`' || next == '\\' || (next == '"' && !heredoc):
+				b.add(string(l.advance()), DoubleQuoted)
+			default:
+				b.add("\\", DoubleQuoted)
+			}
+		default:
+			b.add(string(r), DoubleQuoted)
+		}
+	}
+}
+
+// readHeredocs reads the bodies of the pending here-documents, which
+// follow the newline the lexer has just consumed, one after another.
+func (l *Lexer) readHeredocs() error {
+	for len(l.heredocs) > 0 {
+		redir := l.heredocs[0]
+		delim := redir.Target.Value()
+		start := l.pos()
+
+		var body strings.Builder
+		for {
+			if _, ok := l.peek(); !ok {
+				return l.heredocError(start)
+			}
+			var line strings.Builder
+			for r, ok := l.peek(); ok && r != '\n'; r, ok = l.peek() {
+				line.WriteRune(l.advance())
+			}
+			text := line.String()
+			if redir.Op == "<<-" {
+				text = strings.TrimLeft(text, "\t")
+			}
+			if text == delim {
+				if _, ok := l.peek(); ok {
+					l.advance()
+				}
+				break
+			}
+			body.WriteString(text)
+			if _, ok := l.peek(); !ok {
+				return l.heredocError(start)
+			}
+			body.WriteRune(l.advance())
+		}
+
+		word, err := heredocWord(body.String(), start, isQuotedWord(redir.Target))
+		if err != nil {
+			return err
+		}
+		redir.Heredoc = word
+		l.heredocs = l.heredocs[1:]
+	}
+	return nil
+}
+
+// heredocError reports a here-document that the input ended inside of.
+func (l *Lexer) heredocError(pos Pos) error {
+	delim := l.heredocs[0].Target.Value()
+	return &Error{
+		Pos:        pos,
+		Msg:        fmt.Sprintf("unexpected EOF while looking for here-document delimiter `%s'", delim),
+		Incomplete: true,
+	}
+}
+
+// heredocWord turns a here-document body into a word. With a quoted
+// delimiter the body is literal; otherwise it is expanded like text inside
+// double quotes, except that '"' is not special.
+func heredocWord(body string, pos Pos, quoted bool) (*Word, error) {
+	if quoted {
+		return &Word{Position: pos, Parts: []WordPart{&Lit{Value: body, Quote: SingleQuoted}}}, nil
+	}
+
+	l := &Lexer{src: []rune(body), line: pos.Line, col: pos.Col}
+	b := &wordBuilder{word: &Word{Position: pos}}
+	b.add("", DoubleQuoted)
+	if _, err := l.readDoubleQuotedText(b, true); err != nil {
+		return nil, err
+	}
+	b.flush()
+	return b.word, nil
+}
+
+// ParseText parses s as text in which parameter expansions, command
+// substitutions and backslashes work as inside double quotes, while '"'
+// is an ordinary character, as in an unquoted here-document body. The
+// shell uses it to expand prompt strings.
+func ParseText(s string) (*Word, error) {
+	return heredocWord(s, Pos{Line: 1, Col: 1}, false)
+}
+
+// isQuotedWord reports whether any part of w was quoted or escaped.
+func isQuotedWord(w *Word) bool {
+	for _, part := range w.Parts {
+		if lit, ok := part.(*Lit); !ok || lit.Quote != Unquoted {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || (r >= '0' && r <= '9')
+}
+
+// isName reports whether s is a valid variable name.
+func isName(s string) bool {
+	for i, r := range s {
+		if !isNameChar(r) || (i == 0 && !isNameStart(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isSpecialParam reports whether r names a single-character special
+// parameter such as $? or $#.
+func isSpecialParam(r rune) bool {
+	return strings.ContainsRune("?$#@*!-0123456789", r)
+}
+
+// readExpansion reads an expansion starting at '$' or '`'.
+func (l *Lexer) readExpansion(b *wordBuilder, quoted bool) error {
+	if r, _ := l.peek(); r == '`' {
+		return l.readBackquote(b, quoted)
+	}
+	return l.readDollar(b, quoted)
+}
+
+// readDollar reads an expansion starting at '$'. A '$' that does not start
+// an expansion is kept as a literal character.
+func (l *Lexer) readDollar(b *wordBuilder, quoted bool) error {
+	start := l.off
+	l.advance()
+
+	kind := Unquoted
+	if quoted {
+		kind = DoubleQuoted
+	}
+
+	r, ok := l.peek()
+	switch {
+	case ok && r == '(':
+		subst, err := l.readCmdSubst(start, quoted)
+		if err != nil {
+			return err
+		}
+		b.addPart(subst)
+	case ok && r == '{':
+		param, err := l.readBracedParam(start, quoted)
+		if err != nil {
+			return err
+		}
+		b.addPart(param)
+	case ok && isNameStart(r):
+		name := l.readName()
+		b.addPart(&ParamExp{Name: name, Quoted: quoted, Source: string(l.src[start:l.off])})
+	case ok && isSpecialParam(r):
+		l.advance()
+		b.addPart(&ParamExp{Name: string(r), Quoted: quoted, Source: string(l.src[start:l.off])})
+	default:
+		b.add("$", kind)
+	}
+	return nil
+}
+
+func (l *Lexer) readName() string {
+	start := l.off
+	for r, ok := l.peek(); ok && isNameChar(r); r, ok = l.peek() {
+		l.advance()
+	}
+	return string(l.src[start:l.off])
+}
+
+// paramOps lists the ${NAME<op>word} operators, longest first.
+var paramOps = []string{":-", ":=", ":?", ":+", "##", "%%", "-", "=", "?", "+", "#", "%"}
+
+// readBracedParam reads ${...} with the lexer positioned at '{'.
+func (l *Lexer) readBracedParam(start int, quoted bool) (*ParamExp, error) {
+	startPos := l.pos()
+	l.advance()
+	param := &ParamExp{Quoted: quoted}
+
+	badSubstitution := func() (*ParamExp, error) {
+		for r, ok := l.peek(); ok && r != '}'; r, ok = l.peek() {
+			l.advance()
+		}
+		return nil, &Error{Pos: startPos, Msg: fmt.Sprintf("%s}: bad substitution", string(l.src[start:l.off]))}
+	}
+
+	// ${#} is the parameter count, ${#NAME} is the length of NAME.
+	if l.hasPrefix("#") && !l.hasPrefix("#}") {
+		param.Length = true
+		l.advance()
+	}
+
+	r, ok := l.peek()
+	switch {
+	case ok && isNameStart(r):
+		param.Name = l.readName()
+		if l.hasPrefix("[") {
+			l.advance()
+			for r, ok := l.peek(); ok && r != ']' && r != '}'; r, ok = l.peek() {
+				param.Index += string(l.advance())
+			}
+			if _, ok := l.peek(); !ok {
+				return nil, &Error{Pos: startPos, Msg: "unexpected EOF while looking for matching `}'", Incomplete: true}
+			}
+			if !l.hasPrefix("]") || param.Index == "" {
+				return badSubstitution()
+			}
+			l.advance()
+		}
+	case ok && r >= '0' && r <= '9':
+		for r, ok := l.peek(); ok && r >= '0' && r <= '9'; r, ok = l.peek() {
+			param.Name += string(l.advance())
+		}
+	case ok && isSpecialParam(r):
+		param.Name = string(l.advance())
+	default:
+		return badSubstitution()
+	}
+
+	if !param.Length {
+		for _, op := range paramOps {
+			if l.hasPrefix(op) {
+				param.Op = op
+				for range op {
+					l.advance()
+				}
+				arg, err := l.readParamArg(quoted)
+				if err != nil {
+					return nil, err
+				}
+				param.Arg = arg
+				break
+			}
+		}
+	}
+
+	if r, ok := l.peek(); !ok {
+		return nil, &Error{Pos: startPos, Msg: "unexpected EOF while looking for matching `}'", Incomplete: true}
+	} else if r != '}' {
+		return badSubstitution()
+	}
+	l.advance()
+
+	param.Source = string(l.src[start:l.off])
+	return param, nil
+}
+
+// readParamArg reads the operand of a ${NAME<op>word} expansion up to the
+// closing brace. Inside double quotes the operand is double-quoted too.
+func (l *Lexer) readParamArg(quoted bool) (*Word, error) {
+	b := &wordBuilder{word: &Word{Position: l.pos()}}
+
+	kind := Unquoted
+	if quoted {
+		kind = DoubleQuoted
+	}
+
+	for {
+		r, ok := l.peek()
+		if !ok || r == '}' {
+			b.flush()
+			return b.word, nil
+		}
+
+		switch {
+		case r == '\\':
+			l.advance()
+			next, ok := l.peek()
+			if !ok {
+				break
+			}
+			l.advance()
+			switch {
+			case next == '\n':
+			case quoted && !strings.ContainsRune("$`\"\\}", next):
+				b.add("\\"+string(next), kind)
+			default:
+				b.add(string(next), Escaped)
+			}
+		case r == '\'' && !quoted:
+			if err := l.readSingleQuoted(b); err != nil {
+				return nil, err
+			}
+		case r == '"':
+			if err := l.readDoubleQuoted(b); err != nil {
+				return nil, err
+			}
+		case r == '$' || r == '`':
+			if err := l.readExpansion(b, quoted); err != nil {
+				return nil, err
+			}
+		default:
+			b.add(string(l.advance()), kind)
+		}
+	}
+}
+
+// readCmdSubst reads $(...) with the lexer positioned at '('. The body is
+// parsed directly from the lexer, so quotes and nested substitutions inside
+// it are handled by the regular grammar.
+func (l *Lexer) readCmdSubst(start int, quoted bool) (*CmdSubst, error) {
+	l.advance()
+	body, err := parseNested(l)
+	if err != nil {
+		return nil, err
+	}
+	return &CmdSubst{Body: body, Quoted: quoted, Source: string(l.src[start:l.off])}, nil
+}
+
+// readBackquote reads `...`. Inside it a backslash only escapes $, ` and
+// \ (and " within double quotes); the unescaped text is then parsed as a
+// separate program.
+func (l *Lexer) readBackquote(b *wordBuilder, quoted bool) error {
+	start := l.off
+	startPos := l.pos()
+	l.advance()
+
+	var inner strings.Builder
+	for {
+		r, ok := l.peek()
+		if !ok {
+			return &Error{Pos: startPos, Msg: "unexpected EOF while looking for matching ``'", Incomplete: true}
+		}
+		l.advance()
+		if r == '`' {
+			break
+		}
+		if r == '\\' {
+			if next, ok := l.peek(); ok && (strings.ContainsRune("$`\\", next) || (quoted && next == '"')) {
+				inner.WriteRune(l.advance())
+				continue
+			}
+		}
+		inner.WriteRune(r)
+	}
+
+	body, err := Parse(inner.String())
+	if err != nil {
+		return err
+	}
+	b.addPart(&CmdSubst{Body: body, Quoted: quoted, Source: string(l.src[start:l.off])})
+	return nil
+}
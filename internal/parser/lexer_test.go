@@ -0,0 +1,193 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLexerTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "words", input: "echo  hi", expected: []string{"w:echo", "w:hi"}},
+		{name: "operators", input: "a&&b||c|d;e", expected: []string{"w:a", "op:&&", "w:b", "op:||", "w:c", "op:|", "w:d", "op:;", "w:e"}},
+		{name: "io number", input: "cmd 2>err", expected: []string{"w:cmd", "n:2", "op:>", "w:err"}},
+		{name: "quoted digits are a word", input: "cmd '2'>err", expected: []string{"w:cmd", "w:2", "op:>", "w:err"}},
+		{name: "append", input: "cmd >>log", expected: []string{"w:cmd", "op:>>", "w:log"}},
+		{name: "newline", input: "a\nb", expected: []string{"w:a", "nl", "w:b"}},
+		{name: "line continuation", input: "ec\\\nho hi", expected: []string{"w:echo", "w:hi"}},
+		{name: "comment", input: "a # b c\nd", expected: []string{"w:a", "nl", "w:d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lex := NewLexer(tt.input)
+			var got []string
+			for {
+				tok, err := lex.Next()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tok.Kind == EOF {
+					break
+				}
+				switch tok.Kind {
+				case WordTok:
+					got = append(got, "w:"+tok.Word.Value())
+				case IONumber:
+					got = append(got, "n:"+tok.Value)
+				case Operator:
+					got = append(got, "op:"+tok.Value)
+				case Newline:
+					got = append(got, "nl")
+				}
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("tokens of %q\n  got:  %v\n  want: %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLexerQuoteContext(t *testing.T) {
+	lex := NewLexer(`a'b c'"d\$"\*`)
+	tok, err := lex.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []WordPart{
+		&Lit{Value: "a", Quote: Unquoted},
+		&Lit{Value: "b c", Quote: SingleQuoted},
+		&Lit{Value: "d$", Quote: DoubleQuoted},
+		&Lit{Value: "*", Quote: Escaped},
+	}
+	if !reflect.DeepEqual(tok.Word.Parts, expected) {
+		t.Errorf("parts\n  got:  %#v\n  want: %#v", tok.Word.Parts, expected)
+	}
+	if _, ok := tok.Word.Lit(); ok {
+		t.Error("Lit() should report false for a quoted word")
+	}
+}
+
+func TestLexerPositions(t *testing.T) {
+	lex := NewLexer("echo a\n  ls")
+	var positions []Pos
+	for {
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tok.Kind == EOF {
+			break
+		}
+		positions = append(positions, tok.Pos)
+	}
+
+	expected := []Pos{
+		{Offset: 0, Line: 1, Col: 1},
+		{Offset: 5, Line: 1, Col: 6},
+		{Offset: 6, Line: 1, Col: 7},
+		{Offset: 9, Line: 2, Col: 3},
+	}
+	if !reflect.DeepEqual(positions, expected) {
+		t.Errorf("positions\n  got:  %v\n  want: %v", positions, expected)
+	}
+}
+
+func TestLexerParamExp(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected *ParamExp
+	}{
+		{input: "$HOME", expected: &ParamExp{Name: "HOME", Source: "$HOME"}},
+		{input: "$?", expected: &ParamExp{Name: "?", Source: "$?"}},
+		{input: "${PATH}", expected: &ParamExp{Name: "PATH", Source: "${PATH}"}},
+		{input: "${#PATH}", expected: &ParamExp{Name: "PATH", Length: true, Source: "${#PATH}"}},
+		{input: "${#}", expected: &ParamExp{Name: "#", Source: "${#}"}},
+		{input: `"$X"`, expected: &ParamExp{Name: "X", Quoted: true, Source: "$X"}},
+		{input: "${A[1]}", expected: &ParamExp{Name: "A", Index: "1", Source: "${A[1]}"}},
+		{input: "${#A[@]}", expected: &ParamExp{Name: "A", Index: "@", Length: true, Source: "${#A[@]}"}},
+		{input: "${A[i - 1]}", expected: &ParamExp{Name: "A", Index: "i - 1", Source: "${A[i - 1]}"}},
+		{input: "$A[1]", expected: &ParamExp{Name: "A", Source: "$A"}},
+		{
+			input: "${X:-a b}",
+			expected: &ParamExp{
+				Name: "X", Op: ":-", Source: "${X:-a b}",
+				Arg: &Word{Position: Pos{Offset: 5, Line: 1, Col: 6}, Parts: []WordPart{&Lit{Value: "a b"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tok, err := NewLexer(tt.input).Next()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got *ParamExp
+			for _, part := range tok.Word.Parts {
+				if param, ok := part.(*ParamExp); ok {
+					got = param
+				}
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParamExp of %q\n  got:  %+v\n  want: %+v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLexerCmdSubst(t *testing.T) {
+	tests := []struct {
+		input  string
+		body   string
+		quoted bool
+		source string
+	}{
+		{input: "$(pwd)", body: "[pwd]", source: "$(pwd)"},
+		{input: "$(echo a | wc -c)", body: "[echo] [a] | [wc] [-c]", source: "$(echo a | wc -c)"},
+		{input: `$(echo ")")`, body: "[echo] [)]", source: `$(echo ")")`},
+		{input: "$(echo $(echo x))", body: "[echo] [$(echo x)]", source: "$(echo $(echo x))"},
+		{input: `"$(echo a  b)"`, body: "[echo] [a] [b]", quoted: true, source: "$(echo a  b)"},
+		{input: "`pwd`", body: "[pwd]", source: "`pwd`"},
+		{input: "`echo \\`echo x\\``", body: "[echo] [`echo x`]", source: "`echo \\`echo x\\``"},
+		{input: "\"`echo \\\"q\\\"`\"", body: `[echo] [q]`, quoted: true, source: "`echo \\\"q\\\"`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tok, err := NewLexer(tt.input).Next()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var subst *CmdSubst
+			for _, part := range tok.Word.Parts {
+				if s, ok := part.(*CmdSubst); ok {
+					subst = s
+				}
+			}
+			if subst == nil {
+				t.Fatalf("no command substitution in %+v", tok.Word.Parts)
+			}
+			if got := formatList(subst.Body); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			if subst.Quoted != tt.quoted {
+				t.Errorf("Quoted = %v, want %v", subst.Quoted, tt.quoted)
+			}
+			if subst.Source != tt.source {
+				t.Errorf("Source = %q, want %q", subst.Source, tt.source)
+			}
+		})
+	}
+}
+
+func TestLexerBadSubstitution(t *testing.T) {
+	_, err := NewLexer("${X!y}").Next()
+	if err == nil || err.Error() != "${X!y}: bad substitution" {
+		t.Errorf("error = %v, want bad substitution", err)
+	}
+}
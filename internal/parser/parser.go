@@ -1,63 +1,645 @@
 package parser
 
-// ParseInput parses a shell input string into tokenized arguments,
-// handling single quotes, double quotes, and backslash escaping.
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Error is a syntax error at a position in the source.
+type Error struct {
+	Pos Pos
+	Msg string
+	// Incomplete is set when the source ended in the middle of a construct,
+	// so that more input could make it valid.
+	Incomplete bool
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// IsIncomplete reports whether err is a syntax error caused only by the
+// source ending too early, such as an open quote or a missing here-document
+// delimiter.
+func IsIncomplete(err error) bool {
+	var syntaxErr *Error
+	return errors.As(err, &syntaxErr) && syntaxErr.Incomplete
+}
+
+// Parser builds a syntax tree from the tokens produced by a Lexer.
+type Parser struct {
+	lex *Lexer
+	tok Token
+	// end is the source offset just past the token before tok.
+	end int
+	// pending holds the tokens of an alias's value still to be read
+	// before the lexer's, and expanding the aliases they came from, which
+	// are not expanded again until they have been read. aliasNext is set
+	// when the value ended in a blank, so the word after it is checked
+	// for an alias too.
+	pending   []Token
+	expanding map[string]bool
+	aliasNext bool
+}
+
+// Parse parses src as a complete shell program.
+func Parse(src string) (*List, error) {
+	return parse(NewLexer(src))
+}
+
+// ParseAliases is like Parse but expands aliases: an unquoted word in the
+// position of a command name for which aliases returns a value is replaced
+// by the tokens of that value.
+func ParseAliases(src string, aliases func(name string) (string, bool)) (*List, error) {
+	lex := NewLexer(src)
+	lex.aliases = aliases
+	return parse(lex)
+}
+
+func parse(lex *Lexer) (list *List, err error) {
+	p := &Parser{lex: lex}
+
+	defer bailout(&err)
+
+	p.next()
+	p.skipNewlines()
+	list = p.parseList()
+	if p.tok.Kind != EOF {
+		p.unexpected()
+	}
+	return list, nil
+}
+
+// bailout converts a syntax error raised with panic during parsing into an
+// error result. It must be deferred directly.
+func bailout(err *error) {
+	if r := recover(); r != nil {
+		syntaxErr, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		*err = syntaxErr
+	}
+}
+
+// parseNested parses the body of a $(...) substitution from l, stopping
+// after the closing parenthesis.
+func parseNested(l *Lexer) (list *List, err error) {
+	p := &Parser{lex: l}
+
+	defer bailout(&err)
+
+	p.next()
+	p.skipNewlines()
+	list = p.parseList()
+	if !p.isOp(")") {
+		p.unexpected()
+	}
+	return list, nil
+}
+
+// ParseInput tokenizes a shell input string into arguments with quotes
+// removed, handling single quotes, double quotes, and backslash escaping.
+// Operators such as "|" and "2>" are returned as separate arguments. An
+// unterminated quote is treated as if it were closed at the end of input.
 func ParseInput(s string) []string {
-	var inSingleQuote bool
-	var inDoubleQuote bool
-	var hasBackslash bool
-	var arg string
+	lex := NewLexer(s)
 	var result []string
+	prefix := ""
+
+	for {
+		tok, err := lex.Next()
+		switch tok.Kind {
+		case EOF:
+			return result
+		case WordTok:
+			result = append(result, tok.Word.Value())
+		case IONumber:
+			prefix = tok.Value
+			continue
+		case Operator:
+			result = append(result, prefix+tok.Value)
+		}
+		prefix = ""
+		if err != nil {
+			return result
+		}
+	}
+}
+
+// next advances to the next token, aborting the parse on a lexical error.
+func (p *Parser) next() {
+	p.end = p.lex.off
+	if len(p.pending) > 0 {
+		p.tok, p.pending = p.pending[0], p.pending[1:]
+		return
+	}
+	p.expanding = nil
+	tok, err := p.lex.Next()
+	if err != nil {
+		panic(err)
+	}
+	p.tok = tok
+	if p.aliasNext {
+		p.aliasNext = false
+		p.expandAlias()
+	}
+}
+
+// expandAlias replaces the current token with the tokens of its alias's
+// value, repeatedly, if it is an unquoted word other than a reserved word
+// that names an alias not already being expanded. The tokens take the
+// position of the word they replace.
+func (p *Parser) expandAlias() {
+	for p.lex.aliases != nil && p.tok.Kind == WordTok {
+		name, ok := p.tok.Word.Lit()
+		if !ok || p.expanding[name] || isReserved(name) {
+			return
+		}
+		value, ok := p.lex.aliases(name)
+		if !ok {
+			return
+		}
 
-	for _, char := range s {
-		switch char {
-		case '\'':
-			if hasBackslash && inDoubleQuote {
-				arg += "\\"
+		pos := p.tok.Pos
+		lex := NewLexer(value)
+		lex.aliases = p.lex.aliases
+		var toks []Token
+		for {
+			tok, err := lex.Next()
+			if err != nil {
+				p.fail(pos, "%s: %v", name, err)
 			}
-			if hasBackslash || inDoubleQuote {
-				arg += string(char)
-			} else {
-				inSingleQuote = !inSingleQuote
+			if tok.Kind == EOF {
+				break
 			}
-			hasBackslash = false
-		case '"':
-			if hasBackslash || inSingleQuote {
-				arg += string(char)
-			} else {
-				inDoubleQuote = !inDoubleQuote
+			tok.Pos = pos
+			toks = append(toks, tok)
+		}
+
+		if p.expanding == nil {
+			p.expanding = make(map[string]bool)
+		}
+		p.expanding[name] = true
+		p.aliasNext = strings.HasSuffix(value, " ") || strings.HasSuffix(value, "\t")
+		p.pending = append(toks, p.pending...)
+		p.next()
+	}
+}
+
+// source returns the source text from start up to the end of the token
+// before the current one.
+func (p *Parser) source(start Pos) string {
+	return string(p.lex.src[start.Offset:p.end])
+}
+
+// fail aborts the parse with a syntax error.
+func (p *Parser) fail(pos Pos, format string, args ...any) {
+	panic(&Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// unexpected aborts the parse, reporting the current token.
+func (p *Parser) unexpected() {
+	if p.tok.Kind == EOF {
+		panic(&Error{Pos: p.tok.Pos, Msg: "syntax error: unexpected end of file", Incomplete: true})
+	}
+	p.fail(p.tok.Pos, "syntax error near unexpected token `%s'", p.tok)
+}
+
+func (p *Parser) isOp(op string) bool {
+	return p.tok.Kind == Operator && p.tok.Value == op
+}
+
+// isWord reports whether the current token is the unquoted word w.
+func (p *Parser) isWord(w string) bool {
+	if p.tok.Kind != WordTok {
+		return false
+	}
+	lit, ok := p.tok.Word.Lit()
+	return ok && lit == w
+}
+
+func (p *Parser) skipNewlines() {
+	for p.tok.Kind == Newline {
+		p.next()
+	}
+}
+
+// reservedClosers are reserved words that end a list.
+var reservedClosers = []string{"}", "then", "elif", "else", "fi", "do", "done", "esac"}
+
+// isReserved reports whether w is a reserved word, which is never taken
+// for an alias.
+func isReserved(w string) bool {
+	switch w {
+	case "!", "{", "if", "while", "until", "for", "case", "function", "in":
+		return true
+	}
+	for _, closer := range reservedClosers {
+		if w == closer {
+			return true
+		}
+	}
+	return false
+}
+
+// startsCommand reports whether the current token can begin a command.
+func (p *Parser) startsCommand() bool {
+	switch p.tok.Kind {
+	case WordTok:
+		for _, w := range reservedClosers {
+			if p.isWord(w) {
+				return false
 			}
-			hasBackslash = false
-		case '\\':
-			if hasBackslash || inSingleQuote {
-				arg += string(char)
-				hasBackslash = false
-			} else {
-				hasBackslash = true
+		}
+		return true
+	case IONumber:
+		return true
+	case Operator:
+		return p.isOp("(") || isRedirectOp(p.tok.Value)
+	}
+	return false
+}
+
+// parseList parses and-or lists separated by ";", "&" or newlines until a
+// token that cannot start a command.
+func (p *Parser) parseList() *List {
+	list := &List{Position: p.tok.Pos}
+	for p.startsCommand() {
+		andOr := p.parseAndOr()
+		list.Items = append(list.Items, andOr)
+		if p.isOp("&") {
+			andOr.Background = true
+		} else if !p.isOp(";") && p.tok.Kind != Newline {
+			break
+		}
+		p.next()
+		p.skipNewlines()
+	}
+	return list
+}
+
+func (p *Parser) parseAndOr() *AndOr {
+	start := p.tok.Pos
+	andOr := &AndOr{Pipelines: []*Pipeline{p.parsePipeline()}}
+	for p.isOp("&&") || p.isOp("||") {
+		andOr.Ops = append(andOr.Ops, p.tok.Value)
+		p.next()
+		p.skipNewlines()
+		andOr.Pipelines = append(andOr.Pipelines, p.parsePipeline())
+	}
+	andOr.Source = p.source(start)
+	return andOr
+}
+
+func (p *Parser) parsePipeline() *Pipeline {
+	pipeline := &Pipeline{Position: p.tok.Pos}
+	if p.isWord("!") {
+		pipeline.Negated = true
+		p.next()
+	}
+
+	pipeline.Commands = append(pipeline.Commands, p.parseCommand())
+	for p.isOp("|") {
+		p.next()
+		p.skipNewlines()
+		pipeline.Commands = append(pipeline.Commands, p.parseCommand())
+	}
+	pipeline.Source = p.source(pipeline.Position)
+	return pipeline
+}
+
+func (p *Parser) parseCommand() Command {
+	p.expandAlias()
+	pos := p.tok.Pos
+	switch {
+	case p.isOp("("):
+		p.next()
+		body := p.parseCompoundBody()
+		if !p.isOp(")") {
+			p.unexpected()
+		}
+		p.next()
+		return &Subshell{Position: pos, Body: body, Redirs: p.parseRedirects()}
+	case p.isWord("{"):
+		p.next()
+		body := p.parseCompoundBody()
+		if !p.isWord("}") {
+			p.unexpected()
+		}
+		p.next()
+		return &Group{Position: pos, Body: body, Redirs: p.parseRedirects()}
+	case p.isWord("if"):
+		return p.parseIf()
+	case p.isWord("while"), p.isWord("until"):
+		return p.parseWhile()
+	case p.isWord("for"):
+		return p.parseFor()
+	case p.isWord("case"):
+		return p.parseCase()
+	case p.isWord("function"):
+		p.next()
+		if p.tok.Kind != WordTok {
+			p.unexpected()
+		}
+		name := p.tok.Word
+		p.next()
+		if p.isOp("(") {
+			p.next()
+			p.expectOp(")")
+		}
+		return p.parseFuncBody(pos, name)
+	}
+
+	cmd := p.parseSimpleCommand()
+	if p.isOp("(") && len(cmd.Args) == 1 && len(cmd.Assigns) == 0 && len(cmd.Redirs) == 0 {
+		p.next()
+		p.expectOp(")")
+		return p.parseFuncBody(pos, cmd.Args[0])
+	}
+	return cmd
+}
+
+// expectOp consumes the operator op, failing if it is missing.
+func (p *Parser) expectOp(op string) {
+	if !p.isOp(op) {
+		p.unexpected()
+	}
+	p.next()
+}
+
+// parseFuncBody parses the body of a function definition starting at pos,
+// which must be a compound command.
+func (p *Parser) parseFuncBody(pos Pos, name *Word) *FuncDef {
+	lit, ok := name.Lit()
+	if !ok || lit == "" || strings.ContainsAny(lit, "/$=") {
+		p.fail(name.Position, "`%s': not a valid identifier", name.Value())
+	}
+	p.skipNewlines()
+
+	switch {
+	case p.isOp("("), p.isWord("{"), p.isWord("if"), p.isWord("while"), p.isWord("until"),
+		p.isWord("for"), p.isWord("case"):
+	default:
+		p.unexpected()
+	}
+	body := p.parseCommand()
+	return &FuncDef{Position: pos, Name: lit, Body: body, Source: p.source(pos)}
+}
+
+// expectWord consumes the reserved word w, failing if it is missing.
+func (p *Parser) expectWord(w string) {
+	if !p.isWord(w) {
+		p.unexpected()
+	}
+	p.next()
+}
+
+func (p *Parser) parseIf() *If {
+	cmd := &If{Position: p.tok.Pos}
+	p.next()
+	for {
+		cmd.Conds = append(cmd.Conds, p.parseCompoundBody())
+		p.expectWord("then")
+		cmd.Bodies = append(cmd.Bodies, p.parseCompoundBody())
+		if !p.isWord("elif") {
+			break
+		}
+		p.next()
+	}
+	if p.isWord("else") {
+		p.next()
+		cmd.Else = p.parseCompoundBody()
+	}
+	p.expectWord("fi")
+	cmd.Redirs = p.parseRedirects()
+	return cmd
+}
+
+func (p *Parser) parseWhile() *While {
+	cmd := &While{Position: p.tok.Pos, Until: p.isWord("until")}
+	p.next()
+	cmd.Cond = p.parseCompoundBody()
+	cmd.Body = p.parseDoGroup()
+	cmd.Redirs = p.parseRedirects()
+	return cmd
+}
+
+// parseDoGroup parses "do list done".
+func (p *Parser) parseDoGroup() *List {
+	p.expectWord("do")
+	body := p.parseCompoundBody()
+	p.expectWord("done")
+	return body
+}
+
+func (p *Parser) parseFor() *For {
+	cmd := &For{Position: p.tok.Pos}
+	p.next()
+	name, ok := "", p.tok.Kind == WordTok
+	if ok {
+		name, ok = p.tok.Word.Lit()
+	}
+	if !ok || !isName(name) {
+		if p.tok.Kind == WordTok {
+			p.fail(p.tok.Pos, "`%s': not a valid identifier", p.tok)
+		}
+		p.unexpected()
+	}
+	cmd.Name = name
+	p.next()
+	p.skipNewlines()
+
+	if p.isWord("in") {
+		cmd.In = true
+		p.next()
+		for p.tok.Kind == WordTok {
+			cmd.Words = append(cmd.Words, p.tok.Word)
+			p.next()
+		}
+		if !p.isOp(";") && p.tok.Kind != Newline {
+			p.unexpected()
+		}
+		p.next()
+	} else if p.isOp(";") {
+		p.next()
+	}
+	p.skipNewlines()
+
+	cmd.Body = p.parseDoGroup()
+	cmd.Redirs = p.parseRedirects()
+	return cmd
+}
+
+func (p *Parser) parseCase() *Case {
+	cmd := &Case{Position: p.tok.Pos}
+	p.next()
+	if p.tok.Kind != WordTok {
+		p.unexpected()
+	}
+	cmd.Word = p.tok.Word
+	p.next()
+	p.skipNewlines()
+	p.expectWord("in")
+	p.skipNewlines()
+
+	for !p.isWord("esac") {
+		item := &CaseItem{Position: p.tok.Pos}
+		if p.isOp("(") {
+			p.next()
+		}
+		for {
+			if p.tok.Kind != WordTok {
+				p.unexpected()
 			}
-		case ' ':
-			if hasBackslash && inDoubleQuote {
-				arg += "\\"
+			item.Patterns = append(item.Patterns, p.tok.Word)
+			p.next()
+			if !p.isOp("|") {
+				break
 			}
-			if hasBackslash || inSingleQuote || inDoubleQuote {
-				arg += string(char)
-			} else if arg != "" {
-				result = append(result, arg)
-				arg = ""
+			p.next()
+		}
+		if !p.isOp(")") {
+			p.unexpected()
+		}
+		p.next()
+		p.skipNewlines()
+
+		item.Body = p.parseList()
+		cmd.Items = append(cmd.Items, item)
+		if !p.isOp(";;") {
+			break
+		}
+		p.next()
+		p.skipNewlines()
+	}
+	p.expectWord("esac")
+	cmd.Redirs = p.parseRedirects()
+	return cmd
+}
+
+// parseCompoundBody parses the non-empty list inside a compound command,
+// which may start with newlines.
+func (p *Parser) parseCompoundBody() *List {
+	p.skipNewlines()
+	body := p.parseList()
+	if len(body.Items) == 0 {
+		p.unexpected()
+	}
+	return body
+}
+
+func (p *Parser) parseSimpleCommand() *SimpleCommand {
+	cmd := &SimpleCommand{Position: p.tok.Pos}
+	for {
+		switch {
+		case p.tok.Kind == WordTok:
+			if assign, ok := splitAssign(p.tok.Word); ok && len(cmd.Args) == 0 {
+				cmd.Assigns = append(cmd.Assigns, assign)
+				p.next()
+				if len(assign.Value.Parts) == 0 && p.isOp("(") && p.tok.Pos.Offset == p.end {
+					p.parseArray(assign)
+				}
+				// The command name may follow the assignments.
+				p.expandAlias()
+				continue
 			}
-			hasBackslash = false
+			cmd.Args = append(cmd.Args, p.tok.Word)
+			p.next()
+		case p.tok.Kind == IONumber || (p.tok.Kind == Operator && isRedirectOp(p.tok.Value)):
+			cmd.Redirs = append(cmd.Redirs, p.parseRedirect())
 		default:
-			if inDoubleQuote && hasBackslash {
-				arg += "\\"
+			if len(cmd.Assigns) == 0 && len(cmd.Args) == 0 && len(cmd.Redirs) == 0 {
+				p.unexpected()
 			}
-			arg += string(char)
-			hasBackslash = false
+			return cmd
 		}
 	}
+}
 
-	if arg != "" {
-		result = append(result, arg)
+// parseArray parses the elements of the array assignment NAME=(word...)
+// into assign, starting at the "(".
+func (p *Parser) parseArray(assign *Assign) {
+	assign.Array = true
+	p.next()
+	for {
+		p.skipNewlines()
+		if p.tok.Kind != WordTok {
+			break
+		}
+		assign.Elems = append(assign.Elems, p.tok.Word)
+		p.next()
 	}
+	p.expectOp(")")
+}
 
-	return result
+// splitAssign recognises a NAME=value word. The name and the "=" must be
+// unquoted; the value keeps the remaining parts of the word.
+func splitAssign(word *Word) (*Assign, bool) {
+	if len(word.Parts) == 0 {
+		return nil, false
+	}
+	lit, ok := word.Parts[0].(*Lit)
+	if !ok || lit.Quote != Unquoted {
+		return nil, false
+	}
+	name, rest, ok := strings.Cut(lit.Value, "=")
+	if !ok || !isName(name) {
+		return nil, false
+	}
+
+	value := &Word{Position: word.Position}
+	if rest != "" {
+		value.Parts = append(value.Parts, &Lit{Value: rest, Quote: Unquoted})
+	}
+	value.Parts = append(value.Parts, word.Parts[1:]...)
+	return &Assign{Position: word.Position, Name: name, Value: value}, true
+}
+
+// parseRedirects parses the redirections that follow a compound command.
+func (p *Parser) parseRedirects() []*Redirect {
+	var redirs []*Redirect
+	for p.tok.Kind == IONumber || (p.tok.Kind == Operator && isRedirectOp(p.tok.Value)) {
+		redirs = append(redirs, p.parseRedirect())
+	}
+	return redirs
+}
+
+func (p *Parser) parseRedirect() *Redirect {
+	redir := &Redirect{Position: p.tok.Pos, Fd: -1}
+	if p.tok.Kind == IONumber {
+		fd, err := strconv.Atoi(p.tok.Value)
+		if err != nil {
+			p.fail(p.tok.Pos, "%s: bad file descriptor", p.tok.Value)
+		}
+		redir.Fd = fd
+		p.next()
+	}
+
+	if p.tok.Kind != Operator || !isRedirectOp(p.tok.Value) {
+		p.unexpected()
+	}
+	redir.Op = p.tok.Value
+	p.next()
+
+	if p.tok.Kind != WordTok {
+		p.unexpected()
+	}
+	redir.Target = p.tok.Word
+	if redir.Op == "<<" || redir.Op == "<<-" {
+		// The body follows the next newline, which p.next may reach.
+		p.lex.heredocs = append(p.lex.heredocs, redir)
+	}
+	p.next()
+	return redir
+}
+
+func isRedirectOp(op string) bool {
+	switch op {
+	case "<", ">", ">>", ">|", "<>", "<&", ">&", "&>", "&>>", "<<", "<<-", "<<<":
+		return true
+	}
+	return false
 }
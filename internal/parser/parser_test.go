@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -142,3 +144,423 @@ func TestParseInput(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAliases(t *testing.T) {
+	aliases := map[string]string{
+		"ll":    "ls -la",
+		"ls":    "ls -F",
+		"sudo":  "sudo ",
+		"loop1": "loop2 a",
+		"loop2": "loop1 b",
+		"both":  "echo a; echo b",
+		"cond":  "if",
+		"empty": "",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := aliases[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "command word", input: "ll /tmp", expected: "[ls] [-F] [-la] [/tmp]"},
+		{name: "not an argument", input: "echo ll", expected: "[echo] [ll]"},
+		{name: "quoted", input: "'ll' x", expected: "[ll] [x]"},
+		{name: "after assignment", input: "X=1 ll", expected: "[ls] [-F] [-la]"},
+		{name: "in pipeline", input: "echo | ll && ! ll", expected: "[echo] | [ls] [-F] [-la] && ! [ls] [-F] [-la]"},
+		{name: "trailing blank", input: "sudo ll x", expected: "[sudo] [ls] [-F] [-la] [x]"},
+		{name: "no trailing blank", input: "ll ll", expected: "[ls] [-F] [-la] [ll]"},
+		{name: "recursive", input: "loop1", expected: "[loop1] [b] [a]"},
+		{name: "operators", input: "both c", expected: "[echo] [a]; [echo] [b] [c]"},
+		{name: "reserved word", input: "cond true; then echo; fi", expected: "if {[true]} then {[echo]}"},
+		{name: "empty", input: "empty echo", expected: "[echo]"},
+		{name: "in compound command", input: "{ ll; }", expected: "{[ls] [-F] [-la]}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := ParseAliases(tt.input, lookup)
+			if err != nil {
+				t.Fatalf("ParseAliases(%q) unexpected error: %v", tt.input, err)
+			}
+			if got := formatList(list); got != tt.expected {
+				t.Errorf("ParseAliases(%q)\n  got:  %s\n  want: %s", tt.input, got, tt.expected)
+			}
+			if got := list.Items[0].Source; !strings.HasPrefix(tt.input, got) {
+				t.Errorf("ParseAliases(%q) source %q, want a prefix of the input", tt.input, got)
+			}
+		})
+	}
+}
+
+// formatList renders a parsed list in a compact form for comparison.
+func formatList(list *List) string {
+	var items []string
+	for _, andOr := range list.Items {
+		var s string
+		for i, pipeline := range andOr.Pipelines {
+			if i > 0 {
+				s += " " + andOr.Ops[i-1] + " "
+			}
+			if pipeline.Negated {
+				s += "! "
+			}
+			var stages []string
+			for _, cmd := range pipeline.Commands {
+				stages = append(stages, formatCommand(cmd))
+			}
+			s += strings.Join(stages, " | ")
+		}
+		items = append(items, s)
+	}
+	return strings.Join(items, "; ")
+}
+
+func formatCommand(cmd Command) string {
+	var s string
+	var redirs []*Redirect
+	switch c := cmd.(type) {
+	case *SimpleCommand:
+		var args []string
+		for _, w := range c.Args {
+			args = append(args, "["+w.Value()+"]")
+		}
+		s = strings.Join(args, " ")
+		redirs = c.Redirs
+	case *Subshell:
+		s = "(" + formatList(c.Body) + ")"
+		redirs = c.Redirs
+	case *Group:
+		s = "{" + formatList(c.Body) + "}"
+		redirs = c.Redirs
+	case *If:
+		for i, cond := range c.Conds {
+			keyword := "if"
+			if i > 0 {
+				keyword = " elif"
+			}
+			s += keyword + " {" + formatList(cond) + "} then {" + formatList(c.Bodies[i]) + "}"
+		}
+		if c.Else != nil {
+			s += " else {" + formatList(c.Else) + "}"
+		}
+		redirs = c.Redirs
+	case *While:
+		keyword := "while"
+		if c.Until {
+			keyword = "until"
+		}
+		s = keyword + " {" + formatList(c.Cond) + "} do {" + formatList(c.Body) + "}"
+		redirs = c.Redirs
+	case *For:
+		s = "for " + c.Name
+		if c.In {
+			s += " in"
+			for _, w := range c.Words {
+				s += " [" + w.Value() + "]"
+			}
+		}
+		s += " do {" + formatList(c.Body) + "}"
+		redirs = c.Redirs
+	case *Case:
+		s = "case [" + c.Word.Value() + "]"
+		for _, item := range c.Items {
+			var patterns []string
+			for _, p := range item.Patterns {
+				patterns = append(patterns, "["+p.Value()+"]")
+			}
+			s += " " + strings.Join(patterns, "|") + ") {" + formatList(item.Body) + "}"
+		}
+		redirs = c.Redirs
+	case *FuncDef:
+		s = c.Name + "() " + formatCommand(c.Body)
+	}
+	for _, r := range redirs {
+		fd := ""
+		if r.Fd >= 0 {
+			fd = fmt.Sprint(r.Fd)
+		}
+		s += " " + fd + r.Op + "[" + r.Target.Value() + "]"
+	}
+	return strings.TrimSpace(s)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "empty", input: "", expected: ""},
+		{name: "simple command", input: "echo hello world", expected: "[echo] [hello] [world]"},
+		{name: "quoted operator is a word", input: "echo '>' x", expected: "[echo] [>] [x]"},
+		{name: "escaped operator is a word", input: `echo \| x`, expected: "[echo] [|] [x]"},
+		{name: "redirection", input: "echo hi > out.txt", expected: "[echo] [hi] >[out.txt]"},
+		{name: "fd redirection", input: "ls 2>>err.log", expected: "[ls] 2>>[err.log]"},
+		{name: "digits not before operator", input: "echo 2 > f", expected: "[echo] [2] >[f]"},
+		{name: "redirection before command", input: "> f echo", expected: "[echo] >[f]"},
+		{name: "pipeline", input: "ls | grep go | wc -l", expected: "[ls] | [grep] [go] | [wc] [-l]"},
+		{name: "and or", input: "make && ./run || echo failed", expected: "[make] && [./run] || [echo] [failed]"},
+		{name: "semicolons and newlines", input: "cd /tmp; pwd\necho", expected: "[cd] [/tmp]; [pwd]; [echo]"},
+		{name: "trailing semicolon", input: "echo hi;", expected: "[echo] [hi]"},
+		{name: "newline after operator", input: "true &&\n echo ok", expected: "[true] && [echo] [ok]"},
+		{name: "negation", input: "! false", expected: "! [false]"},
+		{name: "subshell", input: "(cd /tmp && ls) > out", expected: "([cd] [/tmp] && [ls]) >[out]"},
+		{name: "group", input: "{ echo a; echo b; } | wc", expected: "{[echo] [a]; [echo] [b]} | [wc]"},
+		{name: "closing brace as argument", input: "echo }", expected: "[echo] [}]"},
+		{name: "comment", input: "echo hi # note", expected: "[echo] [hi]"},
+		{name: "hash inside word", input: "echo a#b", expected: "[echo] [a#b]"},
+		{name: "empty quoted argument", input: `echo ""`, expected: "[echo] []"},
+		{name: "if", input: "if true; then echo a; fi", expected: "if {[true]} then {[echo] [a]}"},
+		{
+			name: "if elif else", input: "if a\nthen b\nelif c; then d\nelse e; fi > out",
+			expected: "if {[a]} then {[b]} elif {[c]} then {[d]} else {[e]} >[out]",
+		},
+		{name: "while", input: "while a; do b; done", expected: "while {[a]} do {[b]}"},
+		{name: "until on several lines", input: "until a\ndo\n  b\ndone", expected: "until {[a]} do {[b]}"},
+		{name: "for in", input: "for x in a 'b c'; do echo $x; done", expected: "for x in [a] [b c] do {[echo] [$x]}"},
+		{name: "for without in", input: "for x; do echo; done", expected: "for x do {[echo]}"},
+		{name: "for with empty list", input: "for x in; do echo; done", expected: "for x in do {[echo]}"},
+		{name: "for in on next line", input: "for x\nin a\ndo b; done", expected: "for x in [a] do {[b]}"},
+		{
+			name: "case", input: "case $f in\n  *.go|*.rs) echo src ;;\n  (*) ;;\nesac",
+			expected: "case [$f] [*.go]|[*.rs]) {[echo] [src]} [*]) {}",
+		},
+		{name: "case without final terminator", input: "case x in a) echo a; esac", expected: "case [x] [a]) {[echo] [a]}"},
+		{name: "reserved words as arguments", input: "echo if then done", expected: "[echo] [if] [then] [done]"},
+		{name: "compound in pipeline", input: "for x in a; do echo $x; done | wc", expected: "for x in [a] do {[echo] [$x]} | [wc]"},
+		{name: "nested loops", input: "while a; do for b in c; do d; done; done", expected: "while {[a]} do {for b in [c] do {[d]}}"},
+		{name: "function", input: "f() { echo $1; }", expected: "f() {[echo] [$1]}"},
+		{name: "function body on next line", input: "f ()\n{\n  echo a\n}", expected: "f() {[echo] [a]}"},
+		{name: "function keyword", input: "function f { echo; }", expected: "f() {[echo]}"},
+		{name: "function keyword with parens", input: "function f() (cd /tmp)", expected: "f() ([cd] [/tmp])"},
+		{name: "function with loop body", input: "f() for x; do echo; done", expected: "f() for x do {[echo]}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			if got := formatList(list); got != tt.expected {
+				t.Errorf("Parse(%q)\n  got:  %s\n  want: %s", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+	}{
+		{name: "leading pipe", input: "| ls", msg: "syntax error near unexpected token `|'"},
+		{name: "dangling and", input: "echo a &&", msg: "syntax error: unexpected end of file"},
+		{name: "double semicolon", input: "echo a;; echo b", msg: "syntax error near unexpected token `;;'"},
+		{name: "if without then", input: "if true; fi", msg: "syntax error near unexpected token `fi'"},
+		{name: "empty if condition", input: "if then echo; fi", msg: "syntax error near unexpected token `then'"},
+		{name: "unclosed if", input: "if true; then echo", msg: "syntax error: unexpected end of file"},
+		{name: "while without do", input: "while true; done", msg: "syntax error near unexpected token `done'"},
+		{name: "invalid for name", input: "for 1x in a; do :; done", msg: "`1x': not a valid identifier"},
+		{name: "stray done", input: "echo a; done", msg: "syntax error near unexpected token `done'"},
+		{name: "case without in", input: "case x y) ;; esac", msg: "syntax error near unexpected token `y'"},
+		{name: "unclosed case", input: "case x in a) echo", msg: "syntax error: unexpected end of file"},
+		{name: "function without body", input: "f()", msg: "syntax error: unexpected end of file"},
+		{name: "function with simple body", input: "f() echo", msg: "syntax error near unexpected token `echo'"},
+		{name: "invalid function name", input: "$f() { :; }", msg: "`$f': not a valid identifier"},
+		{name: "missing redirect target", input: "echo >", msg: "syntax error: unexpected end of file"},
+		{name: "unclosed subshell", input: "(echo a", msg: "syntax error: unexpected end of file"},
+		{name: "empty group", input: "{ }", msg: "syntax error near unexpected token `}'"},
+		{name: "unterminated quote", input: "echo 'abc", msg: "unexpected EOF while looking for matching `''"},
+		{name: "unclosed substitution", input: "echo $(ls", msg: "syntax error: unexpected end of file"},
+		{name: "unclosed backquote", input: "echo `ls", msg: "unexpected EOF while looking for matching ``'"},
+		{name: "bad substitution body", input: "echo $(| ls)", msg: "syntax error near unexpected token `|'"},
+		{name: "space before array", input: "A= (a)", msg: "syntax error near unexpected token `('"},
+		{name: "unclosed array", input: "A=(a b", msg: "syntax error: unexpected end of file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if err == nil || err.Error() != tt.msg {
+				t.Errorf("Parse(%q) error = %v, want %q", tt.input, err, tt.msg)
+			}
+		})
+	}
+}
+
+func TestParseAssignments(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		assigns []string
+		args    []string
+	}{
+		{name: "assignment only", input: "X=1", assigns: []string{"X=1"}},
+		{name: "empty value", input: "X=", assigns: []string{"X="}},
+		{name: "prefix assignments", input: "A=1 B=two cmd arg", assigns: []string{"A=1", "B=two"}, args: []string{"cmd", "arg"}},
+		{name: "quoted value", input: `X="a b"`, assigns: []string{"X=a b"}},
+		{name: "after command name is an argument", input: "cmd X=1", args: []string{"cmd", "X=1"}},
+		{name: "quoted name is not an assignment", input: `"X"=1`, args: []string{"X=1"}},
+		{name: "invalid name", input: "1X=1", args: []string{"1X=1"}},
+		{name: "array", input: "A=(a 'b c' $x) cmd", assigns: []string{"A=(a,b c,$x)"}, args: []string{"cmd"}},
+		{name: "empty array", input: "A=()", assigns: []string{"A=()"}},
+		{name: "array over lines", input: "A=(a\n  b)", assigns: []string{"A=(a,b)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			cmd := list.Items[0].Pipelines[0].Commands[0].(*SimpleCommand)
+
+			var assigns, args []string
+			for _, a := range cmd.Assigns {
+				if !a.Array {
+					assigns = append(assigns, a.Name+"="+a.Value.Value())
+					continue
+				}
+				var elems []string
+				for _, w := range a.Elems {
+					elems = append(elems, w.Value())
+				}
+				assigns = append(assigns, a.Name+"=("+strings.Join(elems, ",")+")")
+			}
+			for _, w := range cmd.Args {
+				args = append(args, w.Value())
+			}
+			if !reflect.DeepEqual(assigns, tt.assigns) || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("Parse(%q)\n  got:  %q %q\n  want: %q %q", tt.input, assigns, args, tt.assigns, tt.args)
+			}
+		})
+	}
+}
+
+func TestQuoteWord(t *testing.T) {
+	tests := []string{"", "plain", "/usr/bin:/bin", "a b", "it's", `"$HOME"`, "tab\there", "*"}
+
+	for _, s := range tests {
+		quoted := QuoteWord(s)
+		if got := ParseInput("echo " + quoted); len(got) != 2 || got[1] != s {
+			t.Errorf("QuoteWord(%q) = %s, reads back as %q", s, quoted, got)
+		}
+	}
+}
+
+func TestParseHeredoc(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		bodies []string
+		quoted bool
+	}{
+		{name: "simple", input: "cat <<EOF\nline 1\nline 2\nEOF\n", bodies: []string{"line 1\nline 2\n"}},
+		{name: "expansions", input: "cat <<EOF\n$X \"q\"\nEOF", bodies: []string{"$X \"q\"\n"}},
+		{name: "quoted delimiter", input: "cat <<'EOF'\n$X\nEOF\n", bodies: []string{"$X\n"}, quoted: true},
+		{name: "strip tabs", input: "cat <<-EOF\n\t\tindented\n\tEOF\n", bodies: []string{"indented\n"}},
+		{name: "two heredocs", input: "cat <<A; cat <<B\na\nA\nb\nB\n", bodies: []string{"a\n", "b\n"}},
+		{name: "empty body", input: "cat <<EOF\nEOF\n", bodies: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			var bodies []string
+			for _, andOr := range list.Items {
+				cmd := andOr.Pipelines[0].Commands[0].(*SimpleCommand)
+				redir := cmd.Redirs[0]
+				bodies = append(bodies, redir.Heredoc.Value())
+				if _, literal := redir.Heredoc.Parts[0].(*Lit); tt.quoted && (!literal || len(redir.Heredoc.Parts) != 1) {
+					t.Errorf("quoted heredoc parts = %+v, want a single literal", redir.Heredoc.Parts)
+				}
+			}
+			if !reflect.DeepEqual(bodies, tt.bodies) {
+				t.Errorf("bodies = %q, want %q", bodies, tt.bodies)
+			}
+		})
+	}
+}
+
+func TestParseIncomplete(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{input: "echo 'abc", incomplete: true},
+		{input: `echo "abc`, incomplete: true},
+		{input: "echo a &&", incomplete: true},
+		{input: "echo $(ls", incomplete: true},
+		{input: "cat <<EOF\nbody", incomplete: true},
+		{input: "cat <<EOF", incomplete: true},
+		{input: "echo a;; b", incomplete: false},
+		{input: "${X!y}", incomplete: false},
+		{input: "A=(a", incomplete: true},
+		{input: "echo ${A[0", incomplete: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if err == nil {
+				t.Fatalf("Parse(%q) expected an error", tt.input)
+			}
+			if IsIncomplete(err) != tt.incomplete {
+				t.Errorf("IsIncomplete(%v) = %v, want %v", err, !tt.incomplete, tt.incomplete)
+			}
+		})
+	}
+}
+
+func TestParseBackground(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		background []bool
+		sources    []string
+	}{
+		{name: "single", input: "sleep 10 &", background: []bool{true}, sources: []string{"sleep 10"}},
+		{name: "and-or", input: "make && ./run || echo failed &", background: []bool{true}, sources: []string{"make && ./run || echo failed"}},
+		{name: "followed by command", input: "a & b", background: []bool{true, false}, sources: []string{"a", "b"}},
+		{name: "mixed separators", input: "a; b & c &", background: []bool{false, true, true}, sources: []string{"a", "b", "c"}},
+		{name: "pipeline", input: "cat f | grep x  &", background: []bool{true}, sources: []string{"cat f | grep x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			var background []bool
+			var sources []string
+			for _, andOr := range list.Items {
+				background = append(background, andOr.Background)
+				sources = append(sources, andOr.Source)
+			}
+			if !reflect.DeepEqual(background, tt.background) {
+				t.Errorf("background = %v, want %v", background, tt.background)
+			}
+			if !reflect.DeepEqual(sources, tt.sources) {
+				t.Errorf("sources = %q, want %q", sources, tt.sources)
+			}
+		})
+	}
+
+	list, err := Parse("sleep 1 | cat && true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := list.Items[0].Pipelines[0].Source; got != "sleep 1 | cat" {
+		t.Errorf("pipeline source = %q, want %q", got, "sleep 1 | cat")
+	}
+}
@@ -0,0 +1,22 @@
+package parser
+
+import "strings"
+
+// QuoteWord returns s quoted so that the lexer reads it back as a single word
+// with value s. Words made only of safe characters are returned unchanged.
+func QuoteWord(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !isNameChar(r) && !strings.ContainsRune("@%+=:,./-", r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,263 @@
+// Package pathcache implements the shell's command hash table: it remembers
+// where commands were found in PATH and caches the listing of each PATH
+// directory, so that neither running a command nor completing one has to
+// rescan PATH.
+package pathcache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry is a command remembered by the cache.
+type Entry struct {
+	Name string
+	Path string
+	Hits int // number of times the command was looked up
+	// Pinned is set for entries added with Add, which are used without
+	// searching PATH.
+	Pinned bool
+	// dir is the PATH directory the command was found in.
+	dir string
+}
+
+// listing is the cached contents of a directory.
+type listing struct {
+	modTime time.Time
+	// executable maps each name in the directory to whether it was an
+	// executable file when the directory was read.
+	executable map[string]bool
+	names      []string
+}
+
+// Cache is a command hash table. A directory's listing is read again when
+// its modification time changes, and the remembered commands are
+// forgotten when PATH changes. It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	path    string // PATH the entries were found with
+	entries map[string]*Entry
+	dirs    map[string]*listing
+}
+
+// New returns an empty Cache.
+func New() *Cache {
+	return &Cache{entries: make(map[string]*Entry), dirs: make(map[string]*listing)}
+}
+
+// Lookup returns the path of the executable name, which must not contain a
+// slash, in the directories of pathEnv, and remembers it. Relative
+// directories in pathEnv are taken relative to dir, and the path returned
+// is relative too in that case.
+//
+// A remembered command is used as long as neither its directory nor any
+// directory before it in PATH has changed, so that only those directories
+// are checked again; a change to the file's mode alone goes unnoticed.
+func (c *Cache) Lookup(name, pathEnv, dir string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setPath(pathEnv)
+	if e, ok := c.entries[name]; ok && (e.Pinned || c.unchanged(e, pathEnv, dir)) {
+		e.Hits++
+		return e.Path, true
+	}
+
+	pathDir, ok := c.search(name, pathEnv, dir)
+	if !ok {
+		delete(c.entries, name)
+		return "", false
+	}
+	path := filepath.Join(pathDir, name)
+	e, ok := c.entries[name]
+	if !ok || e.Path != path {
+		e = &Entry{Name: name, Path: path, dir: pathDir}
+		c.entries[name] = e
+	}
+	e.Hits++
+	return path, true
+}
+
+// unchanged reports whether the directories of pathEnv up to and including
+// the one e was found in are as they were when last read.
+func (c *Cache) unchanged(e *Entry, pathEnv, dir string) bool {
+	for _, pathDir := range filepath.SplitList(pathEnv) {
+		if pathDir == "" {
+			pathDir = "."
+		}
+		abs := absPath(dir, pathDir)
+		l, ok := c.dirs[abs]
+		if !ok {
+			return false
+		}
+		info, err := os.Stat(abs)
+		if err != nil || !l.modTime.Equal(info.ModTime()) {
+			return false
+		}
+		if pathDir == e.dir {
+			return true
+		}
+	}
+	return false
+}
+
+// Find is like Lookup but neither uses nor changes the remembered
+// commands.
+func (c *Cache) Find(name, pathEnv, dir string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.find(name, pathEnv, dir)
+}
+
+func (c *Cache) find(name, pathEnv, dir string) (string, bool) {
+	pathDir, ok := c.search(name, pathEnv, dir)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(pathDir, name), true
+}
+
+// search returns the directory of pathEnv that holds the executable name.
+func (c *Cache) search(name, pathEnv, dir string) (string, bool) {
+	for _, pathDir := range filepath.SplitList(pathEnv) {
+		if pathDir == "" {
+			pathDir = "."
+		}
+		abs := absPath(dir, pathDir)
+		if _, ok := c.listing(abs).executable[name]; !ok {
+			continue
+		}
+		// The file is checked again in case its mode changed, which
+		// leaves the directory's modification time alone.
+		if !isExecutable(filepath.Join(abs, name)) {
+			continue
+		}
+		return pathDir, true
+	}
+	return "", false
+}
+
+// Executables returns the names of the executables in the directories of
+// pathEnv, each once, in PATH order and sorted within each directory.
+func (c *Cache) Executables(pathEnv, dir string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, pathDir := range filepath.SplitList(pathEnv) {
+		if pathDir == "" {
+			pathDir = "."
+		}
+		l := c.listing(absPath(dir, pathDir))
+		for _, name := range l.names {
+			if l.executable[name] && !seen[name] {
+				names = append(names, name)
+				seen[name] = true
+			}
+		}
+	}
+	return names
+}
+
+// Add remembers path as the location of name until it is removed, the
+// cache is cleared or PATH changes.
+func (c *Cache) Add(name, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[name] = &Entry{Name: name, Path: path, Pinned: true}
+}
+
+// Get returns the remembered entry for name.
+func (c *Cache) Get(name string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Remove forgets name and reports whether it was remembered.
+func (c *Cache) Remove(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[name]
+	delete(c.entries, name)
+	return ok
+}
+
+// Clear forgets every command and directory listing.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*Entry)
+	c.dirs = make(map[string]*listing)
+}
+
+// Entries returns the remembered commands sorted by name.
+func (c *Cache) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// SetPath forgets the remembered commands if pathEnv is not the PATH they
+// were found with. Lookup does this itself.
+func (c *Cache) SetPath(pathEnv string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setPath(pathEnv)
+}
+
+func (c *Cache) setPath(pathEnv string) {
+	if pathEnv != c.path {
+		c.path = pathEnv
+		c.entries = make(map[string]*Entry)
+	}
+}
+
+// listing returns the contents of dir, reading it again if it changed
+// since it was cached. A directory that cannot be read is empty.
+func (c *Cache) listing(dir string) *listing {
+	info, err := os.Stat(dir)
+	if err != nil {
+		delete(c.dirs, dir)
+		return &listing{}
+	}
+	if l, ok := c.dirs[dir]; ok && l.modTime.Equal(info.ModTime()) {
+		return l
+	}
+
+	l := &listing{modTime: info.ModTime(), executable: make(map[string]bool)}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		l.names = append(l.names, name)
+		l.executable[name] = isExecutable(filepath.Join(dir, name))
+	}
+	c.dirs[dir] = l
+	return l
+}
+
+func absPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// isExecutable reports whether path is a regular file with an execute bit.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
@@ -0,0 +1,168 @@
+package pathcache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeExecutable creates an executable file called name in dir.
+func writeExecutable(t *testing.T, dir, name string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeExecutable(t, first, "tool")
+	writeExecutable(t, second, "tool")
+	writeExecutable(t, second, "other")
+	if err := os.WriteFile(filepath.Join(first, "data"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pathEnv := first + ":" + second
+
+	c := New()
+	tests := []struct {
+		name     string
+		expected string
+		ok       bool
+	}{
+		{name: "tool", expected: filepath.Join(first, "tool"), ok: true},
+		{name: "other", expected: filepath.Join(second, "other"), ok: true},
+		{name: "data", ok: false},
+		{name: "missing", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := c.Lookup(tt.name, pathEnv, "/")
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.expected, tt.ok)
+		}
+	}
+
+	c.Lookup("tool", pathEnv, "/")
+	if e, ok := c.Get("tool"); !ok || e.Hits != 2 {
+		t.Errorf("Get(tool) = %+v, %v; want 2 hits", e, ok)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Error("a command that was not found should not be remembered")
+	}
+}
+
+func TestLookupRelativeDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeExecutable(t, filepath.Join(dir, "bin"), "tool")
+
+	if got, ok := New().Lookup("tool", "bin", dir); !ok || got != "bin/tool" {
+		t.Errorf("Lookup(tool) = %q, %v; want bin/tool", got, ok)
+	}
+}
+
+func TestDirectoryChange(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeExecutable(t, second, "tool")
+	pathEnv := first + ":" + second
+
+	c := New()
+	if got, _ := c.Lookup("tool", pathEnv, "/"); got != filepath.Join(second, "tool") {
+		t.Fatalf("Lookup(tool) = %q", got)
+	}
+	if names := c.Executables(pathEnv, "/"); !reflect.DeepEqual(names, []string{"tool"}) {
+		t.Fatalf("Executables() = %q", names)
+	}
+
+	// A command added to an earlier directory takes over once the
+	// directory's modification time changes.
+	writeExecutable(t, first, "tool")
+	writeExecutable(t, first, "new")
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(first, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.Lookup("tool", pathEnv, "/"); got != filepath.Join(first, "tool") {
+		t.Errorf("Lookup(tool) after change = %q, want the first directory's", got)
+	}
+	if names := c.Executables(pathEnv, "/"); !reflect.DeepEqual(names, []string{"new", "tool"}) {
+		t.Errorf("Executables() after change = %q", names)
+	}
+}
+
+func TestRememberedCommand(t *testing.T) {
+	first, second, third := t.TempDir(), t.TempDir(), t.TempDir()
+	writeExecutable(t, second, "tool")
+	pathEnv := first + ":" + second + ":" + third
+
+	c := New()
+	tool := filepath.Join(second, "tool")
+	if got, _ := c.Lookup("tool", pathEnv, "/"); got != tool {
+		t.Fatalf("Lookup(tool) = %q", got)
+	}
+
+	// Directories after the command's are not looked at again, and neither
+	// is the file, so a mode change alone goes unnoticed.
+	if err := os.Remove(third); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(tool, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.Lookup("tool", pathEnv, "/"); !ok || got != tool {
+		t.Errorf("Lookup(tool) = %q, %v; want the remembered %q", got, ok, tool)
+	}
+	if _, ok := c.Find("tool", pathEnv, "/"); ok {
+		t.Error("Find(tool) should check the file's mode")
+	}
+
+	// A change to the command's own directory makes it be searched for.
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(second, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.Lookup("tool", pathEnv, "/"); ok {
+		t.Errorf("Lookup(tool) after change = %q, want none", got)
+	}
+}
+
+func TestPathChange(t *testing.T) {
+	dir := t.TempDir()
+	writeExecutable(t, dir, "tool")
+
+	c := New()
+	c.Lookup("tool", dir, "/")
+	c.SetPath(dir)
+	if len(c.Entries()) != 1 {
+		t.Fatalf("entries = %+v, want tool", c.Entries())
+	}
+	c.SetPath("/nonexistent")
+	if len(c.Entries()) != 0 {
+		t.Errorf("entries after PATH change = %+v, want none", c.Entries())
+	}
+	if _, ok := c.Lookup("tool", "/nonexistent", "/"); ok {
+		t.Error("Lookup should not find tool outside PATH")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	c := New()
+	c.SetPath("/nonexistent")
+	c.Add("ls", "/opt/bin/ls")
+	if got, ok := c.Lookup("ls", "/nonexistent", "/"); !ok || got != "/opt/bin/ls" {
+		t.Errorf("Lookup(ls) = %q, %v; want the added path", got, ok)
+	}
+	if !c.Remove("ls") || c.Remove("ls") {
+		t.Error("Remove(ls) should succeed once")
+	}
+
+	c.Add("ls", "/opt/bin/ls")
+	c.Clear()
+	if len(c.Entries()) != 0 {
+		t.Errorf("entries after Clear = %+v", c.Entries())
+	}
+}
@@ -1,90 +1,257 @@
 package redirect
 
-import "os"
-
-// Redirect holds parsed I/O redirection information for a shell command.
-type Redirect struct {
-	OutputFile   string   // File path for stdout redirection (>, 1>, >>, 1>>)
-	ErrorFile    string   // File path for stderr redirection (2>, 2>>)
-	AppendOutput bool     // True if stdout should append (>>, 1>>)
-	AppendError  bool     // True if stderr should append (2>>)
-	CommandParts []string // The command and arguments without redirect operators
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+// Op is the kind of a redirection.
+type Op int
+
+const (
+	Input     Op = iota // n<file
+	Output              // n>file
+	Clobber             // n>|file, which ignores noclobber
+	Append              // n>>file
+	ReadWrite           // n<>file
+	DupInput            // n<&m or n<&-
+	DupOutput           // n>&m or n>&-
+	Here                // n<<delim, n<<-delim and n<<<word
+)
+
+// Redirection is a single I/O redirection of descriptor Fd. For the dup
+// operations Target is a descriptor number, or "-" to close Fd. For Here
+// it is the text the descriptor reads.
+type Redirection struct {
+	Fd     int
+	Op     Op
+	Target string
 }
 
-// Parse scans inputParts for the first I/O redirection operator and returns
-// a Redirect with the parsed information. Only one redirect operator per
-// command is supported (consistent with codecrafters requirements).
-func Parse(inputParts []string) Redirect {
-	var r Redirect
-
-	for i, part := range inputParts {
-		switch part {
-		case ">", "1>":
-			if i+1 < len(inputParts) {
-				r.OutputFile = inputParts[i+1]
-				r.CommandParts = inputParts[:i]
-				r.AppendOutput = false
-				return r
-			}
-		case ">>", "1>>":
-			if i+1 < len(inputParts) {
-				r.OutputFile = inputParts[i+1]
-				r.CommandParts = inputParts[:i]
-				r.AppendOutput = true
-				return r
-			}
-		case "2>":
-			if i+1 < len(inputParts) {
-				r.ErrorFile = inputParts[i+1]
-				r.CommandParts = inputParts[:i]
-				r.AppendError = false
-				return r
-			}
-		case "2>>":
-			if i+1 < len(inputParts) {
-				r.ErrorFile = inputParts[i+1]
-				r.CommandParts = inputParts[:i]
-				r.AppendError = true
-				return r
+// New converts a shell redirection operator such as ">>" or "<&", with its
+// explicit descriptor number or -1, and its expanded target into the
+// redirections to apply. "&>file" and ">&file" become two redirections:
+// stdout to file, then stderr to stdout. For "<<" and "<<-" target is the
+// expanded here-document body; for "<<<" it is the word, to which a
+// newline is appended.
+func New(fd int, op, target string) ([]Redirection, error) {
+	defaultFd := 1
+	var kind Op
+	switch op {
+	case "<":
+		defaultFd, kind = 0, Input
+	case ">":
+		kind = Output
+	case ">|":
+		kind = Clobber
+	case ">>":
+		kind = Append
+	case "<>":
+		defaultFd, kind = 0, ReadWrite
+	case "<&":
+		defaultFd, kind = 0, DupInput
+		if !isDupTarget(target) {
+			return nil, fmt.Errorf("%s: ambiguous redirect", target)
+		}
+	case ">&":
+		kind = DupOutput
+		if !isDupTarget(target) {
+			if fd >= 0 {
+				return nil, fmt.Errorf("%s: ambiguous redirect", target)
 			}
+			return both(Output, target), nil
 		}
+	case "<<", "<<-":
+		defaultFd, kind = 0, Here
+	case "<<<":
+		defaultFd, kind = 0, Here
+		target += "\n"
+	case "&>":
+		return both(Output, target), nil
+	case "&>>":
+		return both(Append, target), nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported redirection", op)
 	}
 
-	// No redirect found
-	r.CommandParts = inputParts
-	return r
+	if fd < 0 {
+		fd = defaultFd
+	}
+	return []Redirection{{Fd: fd, Op: kind, Target: target}}, nil
 }
 
-// HasOutput returns true if stdout is being redirected to a file.
-func (r *Redirect) HasOutput() bool {
-	return r.OutputFile != ""
+// both redirects stdout and stderr to the same file.
+func both(kind Op, target string) []Redirection {
+	return []Redirection{
+		{Fd: 1, Op: kind, Target: target},
+		{Fd: 2, Op: DupOutput, Target: "1"},
+	}
 }
 
-// HasError returns true if stderr is being redirected to a file.
-func (r *Redirect) HasError() bool {
-	return r.ErrorFile != ""
+func isDupTarget(target string) bool {
+	if target == "-" {
+		return true
+	}
+	_, err := strconv.Atoi(target)
+	return err == nil
 }
 
-// OpenOutputFile opens the output redirect file with appropriate flags.
-// Returns nil if no output redirection is configured.
-func (r *Redirect) OpenOutputFile() (*os.File, error) {
-	if r.OutputFile == "" {
-		return nil, nil
+// Table is a file descriptor table mapping descriptor numbers to the
+// streams they refer to. Each entry is an io.Reader, an io.Writer or, like
+// *os.File, both. Descriptors missing from the table are closed.
+type Table map[int]any
+
+// Clone returns a copy of t.
+func (t Table) Clone() Table {
+	clone := make(Table, len(t))
+	for fd, stream := range t {
+		clone[fd] = stream
 	}
-	if r.AppendOutput {
-		return os.OpenFile(r.OutputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	return clone
+}
+
+// Fds returns the open descriptor numbers in increasing order.
+func (t Table) Fds() []int {
+	fds := make([]int, 0, len(t))
+	for fd := range t {
+		fds = append(fds, fd)
+	}
+	sort.Ints(fds)
+	return fds
+}
+
+// Reader returns descriptor fd as a reader, or Closed if fd is closed or
+// not readable.
+func (t Table) Reader(fd int) io.Reader {
+	if r, ok := t[fd].(io.Reader); ok {
+		return r
 	}
-	return os.Create(r.OutputFile)
+	return Closed{}
 }
 
-// OpenErrorFile opens the error redirect file with appropriate flags.
-// Returns nil if no error redirection is configured.
-func (r *Redirect) OpenErrorFile() (*os.File, error) {
-	if r.ErrorFile == "" {
-		return nil, nil
+// Writer returns descriptor fd as a writer, or Closed if fd is closed or
+// not writable.
+func (t Table) Writer(fd int) io.Writer {
+	if w, ok := t[fd].(io.Writer); ok {
+		return w
 	}
-	if r.AppendError {
-		return os.OpenFile(r.ErrorFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	return Closed{}
+}
+
+// Closed stands in for a closed descriptor: every read and write fails.
+type Closed struct{}
+
+func (Closed) Read([]byte) (int, error)  { return 0, syscall.EBADF }
+func (Closed) Write([]byte) (int, error) { return 0, syscall.EBADF }
+
+// Apply performs redirs from left to right on a copy of t and returns the
+// resulting table together with the files it opened, which the caller must
+// close once the command has finished. Relative file names are opened in
+// dir, the shell's own working directory, or in the working directory of
+// the process if dir is empty. With noclobber set,
+// ">" refuses to truncate an existing regular file. On error every file
+// opened so far is closed.
+func (t Table) Apply(redirs []Redirection, dir string, noclobber bool) (Table, []*os.File, error) {
+	result := t.Clone()
+	var opened []*os.File
+
+	for _, r := range redirs {
+		switch r.Op {
+		case DupInput, DupOutput:
+			if r.Target == "-" {
+				delete(result, r.Fd)
+				continue
+			}
+			src, _ := strconv.Atoi(r.Target)
+			stream, ok := result[src]
+			if !ok {
+				closeAll(opened)
+				return nil, nil, fmt.Errorf("%s: bad file descriptor", r.Target)
+			}
+			result[r.Fd] = stream
+		default:
+			file, err := open(r, dir, noclobber)
+			if err != nil {
+				closeAll(opened)
+				return nil, nil, err
+			}
+			opened = append(opened, file)
+			result[r.Fd] = file
+		}
+	}
+	return result, opened, nil
+}
+
+// open opens the file named by a file redirection, or a file holding the
+// text of a here-document.
+func open(r Redirection, dir string, noclobber bool) (*os.File, error) {
+	if r.Op == Here {
+		return hereFile(r.Target)
+	}
+	// No file has an empty name; joined to dir it would name dir itself.
+	if r.Target == "" {
+		return nil, fmt.Errorf(": %v", syscall.ENOENT)
+	}
+	path := r.Target
+	if dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	var flag int
+	switch r.Op {
+	case Input:
+		flag = os.O_RDONLY
+	case Output, Clobber:
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if r.Op == Output && noclobber {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return nil, fmt.Errorf("%s: cannot overwrite existing file", r.Target)
+			}
+		}
+	case Append:
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	case ReadWrite:
+		flag = os.O_RDWR | os.O_CREATE
+	}
+
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return nil, fmt.Errorf("%s: %v", r.Target, pathErr.Err)
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// hereFile returns an unlinked temporary file containing text, positioned
+// at its start. Unlike a pipe it cannot block however long the text is.
+func hereFile(text string) (*os.File, error) {
+	file, err := os.CreateTemp("", "myshell-here")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name())
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		f.Close()
 	}
-	return os.Create(r.ErrorFile)
 }
@@ -1,135 +1,242 @@
 package redirect
 
 import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
+	"syscall"
 	"testing"
 )
 
-func TestParse(t *testing.T) {
+func TestNew(t *testing.T) {
 	tests := []struct {
 		name     string
-		input    []string
-		expected Redirect
+		fd       int
+		op       string
+		target   string
+		expected []Redirection
 	}{
+		{name: "stdout", fd: -1, op: ">", target: "out", expected: []Redirection{{Fd: 1, Op: Output, Target: "out"}}},
+		{name: "explicit fd", fd: 3, op: ">", target: "out", expected: []Redirection{{Fd: 3, Op: Output, Target: "out"}}},
+		{name: "append stderr", fd: 2, op: ">>", target: "err", expected: []Redirection{{Fd: 2, Op: Append, Target: "err"}}},
+		{name: "clobber", fd: -1, op: ">|", target: "out", expected: []Redirection{{Fd: 1, Op: Clobber, Target: "out"}}},
+		{name: "input", fd: -1, op: "<", target: "in", expected: []Redirection{{Fd: 0, Op: Input, Target: "in"}}},
+		{name: "read write", fd: -1, op: "<>", target: "f", expected: []Redirection{{Fd: 0, Op: ReadWrite, Target: "f"}}},
+		{name: "dup stderr", fd: 2, op: ">&", target: "1", expected: []Redirection{{Fd: 2, Op: DupOutput, Target: "1"}}},
+		{name: "dup input", fd: 3, op: "<&", target: "0", expected: []Redirection{{Fd: 3, Op: DupInput, Target: "0"}}},
+		{name: "heredoc", fd: -1, op: "<<", target: "body\n", expected: []Redirection{{Fd: 0, Op: Here, Target: "body\n"}}},
+		{name: "here-string", fd: 3, op: "<<<", target: "word", expected: []Redirection{{Fd: 3, Op: Here, Target: "word\n"}}},
+		{name: "close", fd: 3, op: ">&", target: "-", expected: []Redirection{{Fd: 3, Op: DupOutput, Target: "-"}}},
 		{
-			name:  "no redirect",
-			input: []string{"echo", "hello"},
-			expected: Redirect{
-				CommandParts: []string{"echo", "hello"},
-			},
+			name: "both", fd: -1, op: "&>", target: "log",
+			expected: []Redirection{{Fd: 1, Op: Output, Target: "log"}, {Fd: 2, Op: DupOutput, Target: "1"}},
 		},
 		{
-			name:  "stdout redirect >",
-			input: []string{"echo", "hello", ">", "file.txt"},
-			expected: Redirect{
-				OutputFile:   "file.txt",
-				CommandParts: []string{"echo", "hello"},
-			},
+			name: "both append", fd: -1, op: "&>>", target: "log",
+			expected: []Redirection{{Fd: 1, Op: Append, Target: "log"}, {Fd: 2, Op: DupOutput, Target: "1"}},
 		},
 		{
-			name:  "stdout redirect 1>",
-			input: []string{"echo", "hello", "1>", "file.txt"},
-			expected: Redirect{
-				OutputFile:   "file.txt",
-				CommandParts: []string{"echo", "hello"},
-			},
-		},
-		{
-			name:  "stdout append >>",
-			input: []string{"echo", "hello", ">>", "file.txt"},
-			expected: Redirect{
-				OutputFile:   "file.txt",
-				AppendOutput: true,
-				CommandParts: []string{"echo", "hello"},
-			},
-		},
-		{
-			name:  "stdout append 1>>",
-			input: []string{"echo", "hello", "1>>", "file.txt"},
-			expected: Redirect{
-				OutputFile:   "file.txt",
-				AppendOutput: true,
-				CommandParts: []string{"echo", "hello"},
-			},
-		},
-		{
-			name:  "stderr redirect 2>",
-			input: []string{"echo", "hello", "2>", "err.txt"},
-			expected: Redirect{
-				ErrorFile:    "err.txt",
-				CommandParts: []string{"echo", "hello"},
-			},
-		},
-		{
-			name:  "stderr append 2>>",
-			input: []string{"echo", "hello", "2>>", "err.txt"},
-			expected: Redirect{
-				ErrorFile:    "err.txt",
-				AppendError:  true,
-				CommandParts: []string{"echo", "hello"},
-			},
-		},
-		{
-			name:  "redirect with no args before operator",
-			input: []string{">", "file.txt"},
-			expected: Redirect{
-				OutputFile:   "file.txt",
-				CommandParts: []string{},
-			},
-		},
-		{
-			name:  "single element no redirect",
-			input: []string{"pwd"},
-			expected: Redirect{
-				CommandParts: []string{"pwd"},
-			},
-		},
-		{
-			name:  "empty input",
-			input: []string{},
-			expected: Redirect{
-				CommandParts: []string{},
-			},
-		},
-		{
-			name:  "redirect operator without target file",
-			input: []string{"echo", "hello", ">"},
-			expected: Redirect{
-				CommandParts: []string{"echo", "hello", ">"},
-			},
+			name: "dup to file name", fd: -1, op: ">&", target: "log",
+			expected: []Redirection{{Fd: 1, Op: Output, Target: "log"}, {Fd: 2, Op: DupOutput, Target: "1"}},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := Parse(tt.input)
+			result, err := New(tt.fd, tt.op, tt.target)
+			if err != nil {
+				t.Fatalf("New(%d, %q, %q) unexpected error: %v", tt.fd, tt.op, tt.target, err)
+			}
 			if !reflect.DeepEqual(result, tt.expected) {
-				t.Errorf("Parse(%v)\n  got:  %+v\n  want: %+v", tt.input, result, tt.expected)
+				t.Errorf("New(%d, %q, %q)\n  got:  %+v\n  want: %+v", tt.fd, tt.op, tt.target, result, tt.expected)
 			}
 		})
 	}
 }
 
-func TestRedirectHasOutput(t *testing.T) {
-	r := Redirect{OutputFile: "out.txt"}
-	if !r.HasOutput() {
-		t.Error("HasOutput() should return true when OutputFile is set")
+func TestNewErrors(t *testing.T) {
+	if _, err := New(-1, "<&", "file"); err == nil || err.Error() != "file: ambiguous redirect" {
+		t.Errorf("New(<&file) error = %v, want ambiguous redirect", err)
+	}
+	if _, err := New(2, ">&", "file"); err == nil || err.Error() != "file: ambiguous redirect" {
+		t.Errorf("New(2>&file) error = %v, want ambiguous redirect", err)
+	}
+}
+
+// apply applies the redirections described by (fd, op, target) triples to
+// a table holding stdout and stderr buffers.
+func apply(t *testing.T, table Table, noclobber bool, specs ...[3]string) (Table, error) {
+	t.Helper()
+	var redirs []Redirection
+	for _, spec := range specs {
+		fd := -1
+		if spec[0] != "" {
+			fd = int(spec[0][0] - '0')
+		}
+		r, err := New(fd, spec[1], spec[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirs = append(redirs, r...)
+	}
+	result, files, err := table.Apply(redirs, "", noclobber)
+	t.Cleanup(func() { closeAll(files) })
+	return result, err
+}
+
+func TestApplyOrder(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	table := Table{1: stdout, 2: stderr}
+
+	// "> out 2>&1" sends both streams to the file.
+	result, err := apply(t, table, false, [3]string{"", ">", out}, [3]string{"2", ">&", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result[1] != result[2] || result[1] == any(stdout) {
+		t.Errorf("> out 2>&1: fd 1 = %v, fd 2 = %v, want the same file", result[1], result[2])
+	}
+
+	// "2>&1 > out" leaves stderr on the old stdout.
+	result, err = apply(t, table, false, [3]string{"2", ">&", "1"}, [3]string{"", ">", out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result[2] != any(stdout) {
+		t.Errorf("2>&1 > out: fd 2 = %v, want original stdout", result[2])
 	}
 
-	r2 := Redirect{}
-	if r2.HasOutput() {
-		t.Error("HasOutput() should return false when OutputFile is empty")
+	if table[1] != any(stdout) || table[2] != any(stderr) {
+		t.Error("Apply modified the original table")
 	}
 }
 
-func TestRedirectHasError(t *testing.T) {
-	r := Redirect{ErrorFile: "err.txt"}
-	if !r.HasError() {
-		t.Error("HasError() should return true when ErrorFile is set")
+func TestApplyCloseAndBadFd(t *testing.T) {
+	table := Table{1: &bytes.Buffer{}}
+
+	result, err := apply(t, table, false, [3]string{"1", ">&", "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result[1]; ok {
+		t.Error("1>&- should close fd 1")
+	}
+	if _, err := result.Writer(1).Write([]byte("x")); !errors.Is(err, syscall.EBADF) {
+		t.Errorf("writing to a closed fd: error = %v, want %v", err, syscall.EBADF)
 	}
 
-	r2 := Redirect{}
-	if r2.HasError() {
-		t.Error("HasError() should return false when ErrorFile is empty")
+	if _, err := apply(t, table, false, [3]string{"", ">&", "5"}); err == nil || err.Error() != "5: bad file descriptor" {
+		t.Errorf(">&5 error = %v, want bad file descriptor", err)
+	}
+}
+
+func TestApplyFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := apply(t, Table{}, false, [3]string{"3", "<", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(result.Reader(3))
+	if buf.String() != "data" {
+		t.Errorf("3< f read %q, want %q", buf.String(), "data")
+	}
+
+	result, err = apply(t, Table{}, false, [3]string{"", "<<<", "here"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	buf.ReadFrom(result.Reader(0))
+	if buf.String() != "here\n" {
+		t.Errorf("<<< here read %q, want %q", buf.String(), "here\n")
+	}
+
+	if _, err := apply(t, Table{}, false, [3]string{"", "<", filepath.Join(dir, "missing")}); err == nil {
+		t.Error("< missing should fail")
+	}
+
+	if _, err := apply(t, Table{}, true, [3]string{"", ">", path}); err == nil || err.Error() != path+": cannot overwrite existing file" {
+		t.Errorf("noclobber > error = %v", err)
+	}
+	if _, err := apply(t, Table{}, true, [3]string{"", ">|", path}); err != nil {
+		t.Errorf("noclobber >| unexpected error: %v", err)
+	}
+	if _, err := apply(t, Table{}, false, [3]string{"", ">>", path}); err != nil {
+		t.Errorf(">> unexpected error: %v", err)
+	}
+}
+
+func TestApplyRelativeToDir(t *testing.T) {
+	dir := t.TempDir()
+	r, err := New(-1, ">", "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, files, err := Table{}.Apply(r, dir, false)
+	closeAll(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out")); err != nil {
+		t.Errorf("> out did not create the file in dir: %v", err)
+	}
+
+	r, _ = New(-1, "<", "missing")
+	if _, _, err := (Table{}).Apply(r, dir, false); err == nil || err.Error() != "missing: no such file or directory" {
+		t.Errorf("< missing error = %v, want the name as written", err)
+	}
+
+	// Every kind of file redirection resolves relative names in dir, and
+	// noclobber looks there too.
+	for _, op := range []string{">>", "<>", "<"} {
+		r, _ := New(-1, op, "out")
+		_, files, err := Table{}.Apply(r, dir, false)
+		closeAll(files)
+		if err != nil {
+			t.Errorf("%s out in dir: %v", op, err)
+		}
+	}
+	r, _ = New(-1, ">", "out")
+	if _, _, err := (Table{}).Apply(r, dir, true); err == nil || err.Error() != "out: cannot overwrite existing file" {
+		t.Errorf("noclobber > out in dir: error = %v", err)
+	}
+
+	// Absolute names are used as they are.
+	other := filepath.Join(t.TempDir(), "abs")
+	r, _ = New(-1, ">", other)
+	_, files, err = Table{}.Apply(r, dir, false)
+	closeAll(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("> %s in dir: %v", other, err)
+	}
+}
+
+func TestApplyEmptyName(t *testing.T) {
+	// An empty name must not open the directory names are resolved in.
+	for _, op := range []string{"<", ">", ">|", ">>", "<>"} {
+		for _, dir := range []string{"", t.TempDir()} {
+			r, err := New(-1, op, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, files, err := Table{}.Apply(r, dir, false)
+			closeAll(files)
+			if err == nil || err.Error() != ": no such file or directory" {
+				t.Errorf("%s '' in %q: error = %v, want %q", op, dir, err, ": no such file or directory")
+			}
+		}
 	}
 }
@@ -0,0 +1,243 @@
+package vars
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Var is a single shell variable. An indexed array has its elements in
+// Array, which is nil for a scalar, and its first element in Value.
+type Var struct {
+	Value    string
+	Array    []string
+	Exported bool
+	ReadOnly bool
+}
+
+// ReadOnlyError is returned when modifying or unsetting a readonly variable.
+type ReadOnlyError struct {
+	Name string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return e.Name + ": readonly variable"
+}
+
+// Store holds the shell variables, keeping track of which ones are exported
+// to child processes and which ones are readonly.
+type Store struct {
+	vars map[string]*Var
+	// scopes holds, for each active scope, the state the variables made
+	// local to it had before; nil means the variable was unset.
+	scopes []map[string]*Var
+}
+
+// New returns an empty Store.
+func New() *Store {
+	return &Store{vars: make(map[string]*Var)}
+}
+
+// FromEnviron returns a Store holding every NAME=value entry of environ as
+// an exported variable, as a shell does with the environment it inherits.
+func FromEnviron(environ []string) *Store {
+	s := New()
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if ok && IsName(name) {
+			s.vars[name] = &Var{Value: value, Exported: true}
+		}
+	}
+	return s
+}
+
+// IsName reports whether name is a valid variable name.
+func IsName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the value of a variable and whether it is set. The value of
+// an array is its first element; an empty array is unset.
+func (s *Store) Get(name string) (string, bool) {
+	v, ok := s.vars[name]
+	if !ok || (v.Array != nil && len(v.Array) == 0) {
+		return "", false
+	}
+	return v.Value, true
+}
+
+// Array returns the elements of a variable and whether it is set. A scalar
+// is an array of one element.
+func (s *Store) Array(name string) ([]string, bool) {
+	v, ok := s.vars[name]
+	if !ok {
+		return nil, false
+	}
+	if v.Array == nil {
+		return []string{v.Value}, true
+	}
+	return slices.Clone(v.Array), true
+}
+
+// Lookup returns a copy of the named variable and whether it is set.
+func (s *Store) Lookup(name string) (Var, bool) {
+	v, ok := s.vars[name]
+	if !ok {
+		return Var{}, false
+	}
+	return *v, true
+}
+
+// Set assigns value to a variable, creating it as a shell-local variable
+// if it does not exist yet. Setting an array replaces its first element.
+func (s *Store) Set(name, value string) error {
+	v, ok := s.vars[name]
+	if !ok {
+		s.vars[name] = &Var{Value: value}
+		return nil
+	}
+	if v.ReadOnly {
+		return &ReadOnlyError{Name: name}
+	}
+	v.Value = value
+	if v.Array != nil {
+		// Copy, since clones and saved scopes share the elements.
+		v.Array = append([]string{value}, v.Array[min(1, len(v.Array)):]...)
+	}
+	return nil
+}
+
+// SetArray makes a variable an indexed array holding values, creating it
+// as a shell-local variable if it does not exist yet.
+func (s *Store) SetArray(name string, values []string) error {
+	v, ok := s.vars[name]
+	if !ok {
+		v = &Var{}
+		s.vars[name] = v
+	} else if v.ReadOnly {
+		return &ReadOnlyError{Name: name}
+	}
+	v.Array = append([]string{}, values...)
+	v.Value = ""
+	if len(values) > 0 {
+		v.Value = values[0]
+	}
+	return nil
+}
+
+// Export marks a variable for export to child processes, creating it with
+// an empty value if needed.
+func (s *Store) Export(name string) {
+	s.get(name).Exported = true
+}
+
+// Unexport removes the export mark from a variable, keeping its value.
+func (s *Store) Unexport(name string) {
+	if v, ok := s.vars[name]; ok {
+		v.Exported = false
+	}
+}
+
+// SetReadOnly marks a variable readonly, creating it with an empty value
+// if needed.
+func (s *Store) SetReadOnly(name string) {
+	s.get(name).ReadOnly = true
+}
+
+// Unset removes a variable.
+func (s *Store) Unset(name string) error {
+	if v, ok := s.vars[name]; ok && v.ReadOnly {
+		return &ReadOnlyError{Name: name}
+	}
+	delete(s.vars, name)
+	return nil
+}
+
+// Names returns the names of all variables in sorted order.
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Environ returns the exported variables as sorted NAME=value entries,
+// suitable for exec.Cmd.Env. Arrays cannot be exported and are left out.
+func (s *Store) Environ() []string {
+	var environ []string
+	for _, name := range s.Names() {
+		if v := s.vars[name]; v.Exported && v.Array == nil {
+			environ = append(environ, name+"="+v.Value)
+		}
+	}
+	return environ
+}
+
+// PushScope starts a new variable scope. Variables declared with Local are
+// restored to their previous state when the scope is popped.
+func (s *Store) PushScope() {
+	s.scopes = append(s.scopes, make(map[string]*Var))
+}
+
+// PopScope ends the innermost scope, restoring every variable made local
+// to it.
+func (s *Store) PopScope() {
+	saved := s.scopes[len(s.scopes)-1]
+	s.scopes = s.scopes[:len(s.scopes)-1]
+	for name, v := range saved {
+		if v == nil {
+			delete(s.vars, name)
+		} else {
+			s.vars[name] = v
+		}
+	}
+}
+
+// Local makes name local to the innermost scope. It reports false when
+// there is no active scope.
+func (s *Store) Local(name string) bool {
+	if len(s.scopes) == 0 {
+		return false
+	}
+	scope := s.scopes[len(s.scopes)-1]
+	if _, ok := scope[name]; ok {
+		return true
+	}
+
+	if v, ok := s.vars[name]; ok {
+		saved := *v
+		scope[name] = &saved
+	} else {
+		scope[name] = nil
+	}
+	return true
+}
+
+// Clone returns an independent copy of the store, as used for subshells.
+func (s *Store) Clone() *Store {
+	clone := New()
+	for name, v := range s.vars {
+		copied := *v
+		clone.vars[name] = &copied
+	}
+	return clone
+}
+
+func (s *Store) get(name string) *Var {
+	v, ok := s.vars[name]
+	if !ok {
+		v = &Var{}
+		s.vars[name] = v
+	}
+	return v
+}
@@ -0,0 +1,193 @@
+package vars
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromEnviron(t *testing.T) {
+	s := FromEnviron([]string{"HOME=/root", "EMPTY=", "A=b=c", "1BAD=x", "NOEQUALS"})
+
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"HOME", "/root", true},
+		{"EMPTY", "", true},
+		{"A", "b=c", true},
+		{"1BAD", "", false},
+		{"NOEQUALS", "", false},
+	}
+	for _, tt := range tests {
+		value, ok := s.Get(tt.name)
+		if value != tt.value || ok != tt.ok {
+			t.Errorf("Get(%q) = %q, %v, want %q, %v", tt.name, value, ok, tt.value, tt.ok)
+		}
+	}
+
+	if v, _ := s.Lookup("HOME"); !v.Exported {
+		t.Error("inherited variables should be exported")
+	}
+}
+
+func TestIsName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"PATH", true},
+		{"_x1", true},
+		{"a_b", true},
+		{"", false},
+		{"1a", false},
+		{"a-b", false},
+		{"a b", false},
+	}
+	for _, tt := range tests {
+		if got := IsName(tt.name); got != tt.want {
+			t.Errorf("IsName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnvironOnlyExported(t *testing.T) {
+	s := New()
+	s.Set("LOCAL", "1")
+	s.Set("SHARED", "2")
+	s.Export("SHARED")
+	s.Export("NEW")
+
+	expected := []string{"NEW=", "SHARED=2"}
+	if got := s.Environ(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Environ() = %v, want %v", got, expected)
+	}
+
+	s.Unexport("SHARED")
+	if got := s.Environ(); !reflect.DeepEqual(got, []string{"NEW="}) {
+		t.Errorf("Environ() after Unexport = %v", got)
+	}
+	if value, _ := s.Get("SHARED"); value != "2" {
+		t.Errorf("Unexport should keep the value, got %q", value)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := New()
+	s.Set("X", "1")
+	s.SetReadOnly("X")
+
+	if err := s.Set("X", "2"); err == nil || err.Error() != "X: readonly variable" {
+		t.Errorf("Set on readonly error = %v", err)
+	}
+	if err := s.Unset("X"); err == nil {
+		t.Error("Unset on readonly should fail")
+	}
+	if value, _ := s.Get("X"); value != "1" {
+		t.Errorf("readonly value changed to %q", value)
+	}
+}
+
+func TestUnset(t *testing.T) {
+	s := New()
+	s.Set("X", "1")
+	if err := s.Unset("X"); err != nil {
+		t.Fatalf("Unset error: %v", err)
+	}
+	if _, ok := s.Get("X"); ok {
+		t.Error("X should be unset")
+	}
+	if err := s.Unset("NEVER"); err != nil {
+		t.Errorf("Unset of missing variable should succeed, got %v", err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	s := New()
+	s.Set("X", "1")
+	clone := s.Clone()
+	clone.Set("X", "2")
+	clone.Set("Y", "3")
+
+	if value, _ := s.Get("X"); value != "1" {
+		t.Errorf("original X changed to %q", value)
+	}
+	if _, ok := s.Get("Y"); ok {
+		t.Error("original should not see Y")
+	}
+}
+
+func TestArray(t *testing.T) {
+	s := New()
+	s.Set("X", "scalar")
+	if got, ok := s.Array("X"); !ok || !reflect.DeepEqual(got, []string{"scalar"}) {
+		t.Errorf("Array of scalar = %v, %v", got, ok)
+	}
+	if _, ok := s.Array("MISSING"); ok {
+		t.Error("Array of unset variable should report false")
+	}
+
+	s.SetArray("A", []string{"a", "b", "c"})
+	if value, ok := s.Get("A"); !ok || value != "a" {
+		t.Errorf("Get of array = %q, %v, want first element", value, ok)
+	}
+	clone := s.Clone()
+	s.Set("A", "z")
+	if got, _ := s.Array("A"); !reflect.DeepEqual(got, []string{"z", "b", "c"}) {
+		t.Errorf("Array after Set = %v, want first element replaced", got)
+	}
+	if got, _ := clone.Array("A"); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("clone changed to %v", got)
+	}
+
+	s.Export("A")
+	if got := s.Environ(); len(got) != 0 {
+		t.Errorf("Environ() = %v, arrays should not be exported", got)
+	}
+
+	s.SetArray("E", nil)
+	if _, ok := s.Get("E"); ok {
+		t.Error("an empty array should be unset for Get")
+	}
+	if got, ok := s.Array("E"); !ok || len(got) != 0 {
+		t.Errorf("Array of empty array = %v, %v", got, ok)
+	}
+
+	s.SetReadOnly("X")
+	if err := s.SetArray("X", []string{"1"}); err == nil {
+		t.Error("SetArray on readonly should fail")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	s := New()
+	s.Set("X", "global")
+
+	if s.Local("X") {
+		t.Error("Local without a scope should report false")
+	}
+
+	s.PushScope()
+	s.Local("X")
+	s.Local("NEW")
+	s.Set("X", "local")
+	s.Set("NEW", "1")
+	s.Export("X")
+	s.Set("OUTER", "kept")
+
+	if value, _ := s.Get("X"); value != "local" {
+		t.Errorf("X inside scope = %q, want local", value)
+	}
+
+	s.PopScope()
+
+	if v, _ := s.Lookup("X"); v.Value != "global" || v.Exported {
+		t.Errorf("X after PopScope = %+v, want unexported global", v)
+	}
+	if _, ok := s.Get("NEW"); ok {
+		t.Error("NEW should be unset after PopScope")
+	}
+	if value, _ := s.Get("OUTER"); value != "kept" {
+		t.Errorf("non-local OUTER = %q, want kept", value)
+	}
+}
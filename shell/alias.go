@@ -0,0 +1,133 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// parse parses src with the shell's aliases expanded.
+func (sh *Shell) parse(src string) (*parser.List, error) {
+	return parser.ParseAliases(src, sh.lookupAlias)
+}
+
+// lookupAlias returns the value of the alias name.
+func (sh *Shell) lookupAlias(name string) (string, bool) {
+	value, ok := sh.aliases[name]
+	return value, ok
+}
+
+// aliasNames returns the names of the defined aliases, sorted.
+func (sh *Shell) aliasNames() []string {
+	names := make([]string, 0, len(sh.aliases))
+	for name := range sh.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validAliasName reports whether name can be defined as an alias. It must
+// not contain quotes, expansions, blanks, "/", "=" or operator characters.
+func validAliasName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\n|&;<>()'\"\\$`=/")
+}
+
+// formatAlias returns the alias command that defines name as value.
+func formatAlias(name, value string) string {
+	return fmt.Sprintf("alias %s='%s'", name, strings.ReplaceAll(value, "'", `'\''`))
+}
+
+// handleAlias defines an alias for each name=value argument and prints the
+// alias named by each other argument. Without arguments, or with -p, it
+// prints every alias as an alias command.
+func (sh *Shell) handleAlias(parts []string, streams stdio) int {
+	args := parts[1:]
+	list := len(args) == 0
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			if arg[i] != 'p' {
+				fmt.Fprintf(streams.err, "alias: -%c: invalid option\n", arg[i])
+				fmt.Fprintln(streams.err, "alias: usage: alias [-p] [name[=value] ... ]")
+				return 2
+			}
+			list = true
+		}
+	}
+
+	if list {
+		for _, name := range sh.aliasNames() {
+			fmt.Fprintln(streams.out, formatAlias(name, sh.aliases[name]))
+		}
+	}
+
+	status := 0
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			value, ok := sh.aliases[name]
+			if !ok {
+				fmt.Fprintf(streams.err, "alias: %s: not found\n", name)
+				status = 1
+				continue
+			}
+			fmt.Fprintln(streams.out, formatAlias(name, value))
+			continue
+		}
+		if !validAliasName(name) {
+			fmt.Fprintf(streams.err, "alias: `%s': invalid alias name\n", name)
+			status = 1
+			continue
+		}
+		sh.aliases[name] = value
+	}
+	return status
+}
+
+// handleUnalias removes the named aliases, or every alias with -a.
+func (sh *Shell) handleUnalias(parts []string, streams stdio) int {
+	args := parts[1:]
+	all := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			if arg[i] != 'a' {
+				fmt.Fprintf(streams.err, "unalias: -%c: invalid option\n", arg[i])
+				fmt.Fprintln(streams.err, "unalias: usage: unalias [-a] name [name ...]")
+				return 2
+			}
+			all = true
+		}
+	}
+
+	if all {
+		clear(sh.aliases)
+		return 0
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(streams.err, "unalias: usage: unalias [-a] name [name ...]")
+		return 2
+	}
+
+	status := 0
+	for _, name := range args {
+		if _, ok := sh.aliases[name]; !ok {
+			fmt.Fprintf(streams.err, "unalias: %s: not found\n", name)
+			status = 1
+			continue
+		}
+		delete(sh.aliases, name)
+	}
+	return status
+}
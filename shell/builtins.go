@@ -0,0 +1,217 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// builtinCommand is a command implemented by the shell itself. Run
+// receives the command's arguments, starting with its name, and the
+// streams set up by its redirections and pipeline, and returns the exit
+// status.
+type builtinCommand interface {
+	Run(sh *Shell, args []string, streams stdio) int
+}
+
+// builtinFunc adapts a function to the builtinCommand interface.
+type builtinFunc func(sh *Shell, args []string, streams stdio) int
+
+// Run calls f.
+func (f builtinFunc) Run(sh *Shell, args []string, streams stdio) int {
+	return f(sh, args, streams)
+}
+
+// builtins maps the name of each builtin command to its implementation.
+// It is filled in by init because several builtins refer back to it.
+var builtins map[string]builtinCommand
+
+func init() {
+	builtins = map[string]builtinCommand{
+		"echo":     builtinFunc((*Shell).handleEcho),
+		"exit":     builtinFunc((*Shell).handleExit),
+		"type":     builtinFunc((*Shell).handleType),
+		"pwd":      builtinFunc((*Shell).handlePwd),
+		"cd":       builtinFunc((*Shell).handleCd),
+		"export":   builtinFunc((*Shell).handleExport),
+		"unset":    builtinFunc((*Shell).handleUnset),
+		"readonly": builtinFunc((*Shell).handleReadonly),
+		"env":      builtinFunc((*Shell).handleEnv),
+		"set":      builtinFunc((*Shell).handleSet),
+		"shopt":    builtinFunc((*Shell).handleShopt),
+		"jobs":     builtinFunc((*Shell).handleJobs),
+		"fg":       builtinFunc((*Shell).handleFg),
+		"bg":       builtinFunc((*Shell).handleBg),
+		"wait":     builtinFunc((*Shell).handleWait),
+		"disown":   builtinFunc((*Shell).handleDisown),
+		"kill":     builtinFunc((*Shell).handleKill),
+		"break":    builtinFunc((*Shell).handleBreak),
+		"continue": builtinFunc((*Shell).handleContinue),
+		":":        builtinFunc((*Shell).handleColon),
+		"return":   builtinFunc((*Shell).handleReturn),
+		"local":    builtinFunc((*Shell).handleLocal),
+		"history":  builtinFunc((*Shell).handleHistory),
+		"complete": builtinFunc((*Shell).handleComplete),
+		"compgen":  builtinFunc((*Shell).handleCompgen),
+		"hash":     builtinFunc((*Shell).handleHash),
+		"source":   builtinFunc((*Shell).handleSource),
+		".":        builtinFunc((*Shell).handleSource),
+		"alias":    builtinFunc((*Shell).handleAlias),
+		"unalias":  builtinFunc((*Shell).handleUnalias),
+	}
+}
+
+// lookupBuiltin returns the builtin called name. Builtin names are matched
+// case-insensitively.
+func lookupBuiltin(name string) (builtinCommand, bool) {
+	b, ok := builtins[strings.ToLower(name)]
+	return b, ok
+}
+
+// builtinNames returns the names of all builtins in sorted order.
+func builtinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleExit exits the shell with the given status, or with the status of
+// the last command when called without an argument. Inside a subshell or
+// pipeline stage only that subshell is left.
+func (sh *Shell) handleExit(parts []string, streams stdio) int {
+	if len(parts) == 1 {
+		panic(exitRequest(sh.lastStatus))
+	}
+
+	status, err := strconv.Atoi(parts[1])
+	if err != nil {
+		fmt.Fprintf(streams.err, "exit: %s: numeric argument required\n", parts[1])
+		panic(exitRequest(2))
+	}
+	panic(exitRequest(status & 0xff))
+}
+
+// handleEcho writes the arguments to stdout.
+func (sh *Shell) handleEcho(parts []string, streams stdio) int {
+	if len(parts) < 2 {
+		fmt.Fprintln(streams.out, "echo: missing argument")
+		return 0
+	}
+
+	if _, err := fmt.Fprintln(streams.out, strings.Join(parts[1:], " ")); err != nil {
+		return writeError("echo", err, streams)
+	}
+	return 0
+}
+
+// writeError reports that the builtin name failed to write its output,
+// for instance to a closed descriptor, and returns the status 1.
+func writeError(name string, err error, streams stdio) int {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	fmt.Fprintf(streams.err, "%s: write error: %v\n", name, err)
+	return 1
+}
+
+// handleType reports whether a command is an alias, a function, a
+// builtin, a command in the hash table or an external executable.
+func (sh *Shell) handleType(parts []string, streams stdio) int {
+	if len(parts) < 2 {
+		return 0
+	}
+
+	target := parts[1]
+
+	if value, ok := sh.aliases[target]; ok {
+		fmt.Fprintf(streams.out, "%s is aliased to `%s'\n", target, value)
+		return 0
+	}
+
+	if fn, ok := sh.funcs[target]; ok {
+		fmt.Fprintf(streams.out, "%s is a function\n%s\n", target, fn.Source)
+		return 0
+	}
+
+	if _, ok := lookupBuiltin(target); ok {
+		fmt.Fprintf(streams.out, "%s is a shell builtin\n", target)
+		return 0
+	}
+
+	if entry, ok := sh.hashTable().Get(target); ok {
+		fmt.Fprintf(streams.out, "%s is hashed (%s)\n", target, entry.Path)
+		return 0
+	}
+
+	// Search PATH for the executable, without hashing it
+	pathEnv, _ := sh.vars.Get("PATH")
+	if strings.Contains(target, "/") {
+		if isExecutable(absPath(sh.dir, target)) {
+			fmt.Fprintf(streams.out, "%s is %s\n", target, target)
+			return 0
+		}
+	} else if execPath, ok := sh.hash.Find(target, pathEnv, sh.dir); ok {
+		fmt.Fprintf(streams.out, "%s is %s\n", target, execPath)
+		return 0
+	}
+
+	fmt.Fprintf(streams.err, "%s: not found\n", target)
+	return 1
+}
+
+// handlePwd prints the current working directory.
+func (sh *Shell) handlePwd(parts []string, streams stdio) int {
+	if _, err := fmt.Fprintln(streams.out, sh.dir); err != nil {
+		return writeError("pwd", err, streams)
+	}
+	return 0
+}
+
+// handleCd changes the shell's working directory and updates PWD and
+// OLDPWD. Supports absolute paths, relative paths, ~ and ~/... for home
+// directory. ".." is resolved by removing the last component of the path,
+// as with bash's logical cd. The directory of the process is left alone.
+func (sh *Shell) handleCd(parts []string, streams stdio) int {
+	if len(parts) < 2 {
+		fmt.Fprintln(streams.err, "cd: missing argument")
+		return 1
+	}
+
+	dir := parts[1]
+
+	// Expand home directory
+	home, _ := sh.vars.Get("HOME")
+	if dir == "~" {
+		dir = home
+	} else if strings.HasPrefix(dir, "~/") {
+		dir = filepath.Join(home, dir[2:])
+	}
+
+	newDir := absPath(sh.dir, dir)
+	info, err := os.Stat(newDir)
+	if err != nil {
+		fmt.Fprintf(streams.err, "cd: %s: No such file or directory\n", dir)
+		return 1
+	}
+	if !info.IsDir() {
+		fmt.Fprintf(streams.err, "cd: %s: Not a directory\n", dir)
+		return 1
+	}
+
+	sh.vars.Set("OLDPWD", sh.dir)
+	sh.setDir(newDir)
+	return 0
+}
+
+// handleColon does nothing and succeeds.
+func (sh *Shell) handleColon(parts []string, streams stdio) int {
+	return 0
+}
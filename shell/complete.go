@@ -0,0 +1,341 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/completer"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// newCompleter returns a completer that looks up variables, functions and
+// the working directory in sh and runs completion functions and commands
+// in it.
+func (sh *Shell) newCompleter() *completer.Completer {
+	return &completer.Completer{
+		Builtins: builtinNames(),
+		Getenv: func(name string) string {
+			value, _ := sh.vars.Get(name)
+			return value
+		},
+		Dir:       func() string { return sh.dir },
+		Variables: sh.vars.Names,
+		Functions: sh.funcNames,
+		Aliases:   sh.aliasNames,
+		Generate:  sh.completionMatches,
+		Hash:      sh.hash,
+	}
+}
+
+// funcNames returns the names of the defined functions, sorted.
+func (sh *Shell) funcNames() []string {
+	names := make([]string, 0, len(sh.funcs))
+	for name := range sh.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completionMatches returns the matches from spec's word list, function and
+// command. The word list is expanded and split like command arguments.
+//
+// As in bash, the function is called with the command name, the word being
+// completed and the word before it, and with COMP_LINE, COMP_POINT, the
+// array COMP_WORDS and the index COMP_CWORD of the current word set. It
+// leaves its matches in the array COMPREPLY. The command gets the same
+// arguments and prints one match per line.
+func (sh *Shell) completionMatches(spec *completer.Spec, req completer.Request) []string {
+	status := sh.lastStatus
+	defer func() { sh.lastStatus = status }()
+
+	word := req.Word()
+	var matches []string
+	if spec.WordList != "" {
+		for _, w := range sh.splitWordList(spec.WordList) {
+			if strings.HasPrefix(w, word) {
+				matches = append(matches, w)
+			}
+		}
+	}
+
+	args := []string{"", word, ""}
+	if len(req.Words) > 1 {
+		args[0], args[2] = req.Words[0], req.Words[len(req.Words)-2]
+	}
+	point := strconv.Itoa(utf8.RuneCountInString(req.Line))
+
+	if spec.Function != "" {
+		fn, ok := sh.funcs[spec.Function]
+		if !ok {
+			fmt.Fprintf(sh.stdio().err, "completion: function `%s' not found\n", spec.Function)
+			return matches
+		}
+		sh.vars.Set("COMP_LINE", req.Line)
+		sh.vars.Set("COMP_POINT", point)
+		sh.vars.SetArray("COMP_WORDS", req.Words)
+		sh.vars.Set("COMP_CWORD", strconv.Itoa(len(req.Words)-1))
+		sh.vars.Unset("COMPREPLY")
+		sh.callCompletionFunction(fn, append([]string{spec.Function}, args...))
+		reply, _ := sh.vars.Array("COMPREPLY")
+		matches = append(matches, reply...)
+	}
+
+	if spec.Command != "" {
+		line := fmt.Sprintf("COMP_LINE=%s COMP_POINT=%s %s", parser.QuoteWord(req.Line), point, spec.Command)
+		for _, arg := range args {
+			line += " " + parser.QuoteWord(arg)
+		}
+		if list, err := parser.Parse(line); err == nil {
+			out, _ := sh.commandSubstitution(list)
+			matches = append(matches, splitLines(out)...)
+		}
+	}
+	return matches
+}
+
+// callCompletionFunction calls the completion function fn with args. A
+// function that runs exit ends the completion, not the shell.
+func (sh *Shell) callCompletionFunction(fn *parser.FuncDef, args []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(exitRequest); !ok {
+				panic(r)
+			}
+		}
+	}()
+	sh.callFunction(fn, args, nil, sh.stdio())
+}
+
+// splitWordList expands the words of a complete -W word list.
+func (sh *Shell) splitWordList(list string) []string {
+	var words []*parser.Word
+	lex := parser.NewLexer(list)
+	for {
+		tok, err := lex.Next()
+		if err != nil || tok.Kind == parser.EOF {
+			break
+		}
+		if tok.Kind == parser.WordTok {
+			words = append(words, tok.Word)
+		}
+	}
+	fields, err := sh.expander.Fields(words)
+	if err != nil {
+		return nil
+	}
+	return fields
+}
+
+// splitLines returns the non-empty lines of s.
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// specArgs holds the parsed arguments of complete or compgen.
+type specArgs struct {
+	spec   completer.Spec
+	set    bool // whether any option describing the spec was given
+	print  bool // -p
+	remove bool // -r
+	names  []string
+}
+
+// actionFlags maps the single-letter options of complete and compgen to
+// their actions.
+var actionFlags = map[byte]completer.Action{
+	'a': completer.ActionAlias,
+	'b': completer.ActionBuiltin,
+	'c': completer.ActionCommand,
+	'd': completer.ActionDirectory,
+	'f': completer.ActionFile,
+	'v': completer.ActionVariable,
+}
+
+// parseSpecArgs parses the options of complete, or of compgen when
+// compgen is set, which does not take -p and -r.
+func parseSpecArgs(name string, args []string, compgen bool) (specArgs, error) {
+	var sa specArgs
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			flag := arg[i]
+			if action, ok := actionFlags[flag]; ok {
+				sa.spec.Actions |= action
+				sa.set = true
+				continue
+			}
+			if !compgen && (flag == 'p' || flag == 'r') {
+				sa.print = sa.print || flag == 'p'
+				sa.remove = sa.remove || flag == 'r'
+				continue
+			}
+			if strings.IndexByte("AoWFCXPS", flag) < 0 {
+				return sa, fmt.Errorf("%s: -%c: invalid option", name, flag)
+			}
+
+			// The option's argument is the rest of this word or the next.
+			value := arg[i+1:]
+			if value == "" {
+				if len(args) == 0 {
+					return sa, fmt.Errorf("%s: -%c: option requires an argument", name, flag)
+				}
+				value, args = args[0], args[1:]
+			}
+			i = len(arg)
+			sa.set = true
+
+			switch flag {
+			case 'A':
+				action, ok := completer.ActionNames[value]
+				if !ok {
+					return sa, fmt.Errorf("%s: %s: invalid action name", name, value)
+				}
+				sa.spec.Actions |= action
+			case 'o':
+				option, ok := completer.OptionNames[value]
+				if !ok {
+					return sa, fmt.Errorf("%s: %s: invalid option name", name, value)
+				}
+				sa.spec.Options |= option
+			case 'W':
+				sa.spec.WordList = value
+			case 'F':
+				sa.spec.Function = value
+			case 'C':
+				sa.spec.Command = value
+			case 'X':
+				sa.spec.Filter = value
+			case 'P':
+				sa.spec.Prefix = value
+			case 'S':
+				sa.spec.Suffix = value
+			}
+		}
+	}
+	sa.names = args
+	return sa, nil
+}
+
+// handleComplete sets how the arguments of the named commands are
+// completed. With -p, or no options, it prints the specs of the named
+// commands, or all of them, as complete commands; -r removes them. The
+// options are those of bash, but -F functions return their matches as
+// completionMatches describes.
+func (sh *Shell) handleComplete(parts []string, streams stdio) int {
+	sa, err := parseSpecArgs("complete", parts[1:], false)
+	if err != nil {
+		fmt.Fprintln(streams.err, err)
+		fmt.Fprintln(streams.err, "complete: usage: complete [-pr] [-abcdfv] [-o option] [-A action] [-W wordlist] [-F function] [-C command] [-X filterpat] [-P prefix] [-S suffix] [name ...]")
+		return 2
+	}
+
+	switch {
+	case sa.remove:
+		if len(sa.names) == 0 {
+			sa.names = sh.completer.SpecNames()
+		}
+		status := 0
+		for _, name := range sa.names {
+			if !sh.completer.RemoveSpec(name) {
+				fmt.Fprintf(streams.err, "complete: %s: no completion specification\n", name)
+				status = 1
+			}
+		}
+		return status
+	case sa.print || !sa.set:
+		if len(sa.names) == 0 {
+			sa.names = sh.completer.SpecNames()
+		}
+		status := 0
+		for _, name := range sa.names {
+			spec, ok := sh.completer.LookupSpec(name)
+			if !ok {
+				fmt.Fprintf(streams.err, "complete: %s: no completion specification\n", name)
+				status = 1
+				continue
+			}
+			fmt.Fprintln(streams.out, formatSpec(spec, name))
+		}
+		return status
+	}
+
+	for _, name := range sa.names {
+		spec := sa.spec
+		sh.completer.SetSpec(name, &spec)
+	}
+	return 0
+}
+
+// handleCompgen prints the matches the options generate for the word
+// given, one per line, and fails if there are none.
+func (sh *Shell) handleCompgen(parts []string, streams stdio) int {
+	sa, err := parseSpecArgs("compgen", parts[1:], true)
+	if err != nil {
+		fmt.Fprintln(streams.err, err)
+		fmt.Fprintln(streams.err, "compgen: usage: compgen [-abcdfv] [-o option] [-A action] [-W wordlist] [-F function] [-C command] [-X filterpat] [-P prefix] [-S suffix] [word]")
+		return 2
+	}
+
+	word := ""
+	if len(sa.names) > 0 {
+		word = sa.names[0]
+	}
+	matches := sh.completer.Candidates(&sa.spec, completer.Request{Line: word, Words: []string{word}})
+	if len(matches) == 0 {
+		return 1
+	}
+
+	// Directories are listed without the "/" added for completion.
+	files := sa.spec.Actions&(completer.ActionFile|completer.ActionDirectory) != 0 ||
+		sa.spec.Options&(completer.OptionDefault|completer.OptionDirNames|completer.OptionPlusDirs) != 0
+	for _, m := range matches {
+		if files && len(m) > 1 {
+			m = strings.TrimSuffix(m, "/")
+		}
+		fmt.Fprintln(streams.out, m)
+	}
+	return 0
+}
+
+// formatSpec returns the complete command that sets up spec for name.
+func formatSpec(spec *completer.Spec, name string) string {
+	args := []string{"complete"}
+	for _, o := range []string{"default", "dirnames", "filenames", "nospace", "plusdirs"} {
+		if spec.Options&completer.OptionNames[o] != 0 {
+			args = append(args, "-o", o)
+		}
+	}
+	for _, flag := range []byte("abcdfv") {
+		if spec.Actions&actionFlags[flag] != 0 {
+			args = append(args, "-"+string(flag))
+		}
+	}
+	if spec.Actions&completer.ActionFunction != 0 {
+		args = append(args, "-A", "function")
+	}
+	for _, opt := range []struct {
+		flag, value string
+	}{
+		{"-P", spec.Prefix}, {"-S", spec.Suffix}, {"-W", spec.WordList},
+		{"-X", spec.Filter}, {"-F", spec.Function}, {"-C", spec.Command},
+	} {
+		if opt.value != "" {
+			args = append(args, opt.flag, parser.QuoteWord(opt.value))
+		}
+	}
+	return strings.Join(append(args, parser.QuoteWord(name)), " ")
+}
@@ -0,0 +1,181 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/expand"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// runIf runs the body of the first branch whose condition succeeds, or the
+// else branch. Without a matching branch the status is 0.
+func (sh *Shell) runIf(cmd *parser.If, streams stdio) int {
+	for i, cond := range cmd.Conds {
+		status := sh.runList(cond, streams)
+		if sh.unwinding() {
+			return status
+		}
+		if status == 0 {
+			return sh.runList(cmd.Bodies[i], streams)
+		}
+	}
+	if cmd.Else != nil {
+		return sh.runList(cmd.Else, streams)
+	}
+	return 0
+}
+
+// runWhile runs a while or until loop. Its status is that of the last
+// body run, or 0 if the body never ran.
+func (sh *Shell) runWhile(cmd *parser.While, streams stdio) int {
+	sh.loopDepth++
+	defer func() { sh.loopDepth-- }()
+
+	status := 0
+	for {
+		cond := sh.runList(cmd.Cond, streams)
+		if sh.unwinding() {
+			if sh.endIteration() {
+				break
+			}
+			continue
+		}
+		if (cond == 0) == cmd.Until {
+			break
+		}
+		status = sh.runList(cmd.Body, streams)
+		if sh.endIteration() {
+			break
+		}
+	}
+	return status
+}
+
+// runFor assigns each expanded word to the loop variable in turn and runs
+// the body. Without "in" the loop runs over the positional parameters.
+func (sh *Shell) runFor(cmd *parser.For, streams stdio) int {
+	words := sh.params
+	if cmd.In {
+		var err error
+		words, err = sh.expander.Fields(cmd.Words)
+		if err != nil {
+			return sh.expansionError(err, streams)
+		}
+	}
+
+	sh.loopDepth++
+	defer func() { sh.loopDepth-- }()
+
+	status := 0
+	for _, word := range words {
+		if err := sh.vars.Set(cmd.Name, word); err != nil {
+			fmt.Fprintln(streams.err, err)
+			return 1
+		}
+		status = sh.runList(cmd.Body, streams)
+		if sh.endIteration() {
+			break
+		}
+	}
+	return status
+}
+
+// runCase runs the body of the first item with a pattern matching the
+// expanded word. Patterns are matched like pathname patterns, with quoted
+// characters matching literally.
+func (sh *Shell) runCase(cmd *parser.Case, streams stdio) int {
+	word, err := sh.expander.Word(cmd.Word)
+	if err != nil {
+		return sh.expansionError(err, streams)
+	}
+
+	for _, item := range cmd.Items {
+		for _, p := range item.Patterns {
+			pattern, err := sh.expander.Pattern(p)
+			if err != nil {
+				return sh.expansionError(err, streams)
+			}
+			if !expand.Match(pattern, word) {
+				continue
+			}
+			if len(item.Body.Items) == 0 {
+				return 0
+			}
+			return sh.runList(item.Body, streams)
+		}
+	}
+	return 0
+}
+
+// unwinding reports whether the commands still to run in the current lists
+// must be skipped: because of a pending break, continue or return, or
+// because the shell was interrupted.
+func (sh *Shell) unwinding() bool {
+	return sh.breaking > 0 || sh.continuing > 0 || sh.returning || sh.interrupted.Load()
+}
+
+// endIteration is called by a loop after each run of its body and reports
+// whether the loop must stop. It consumes one level of a pending break or
+// continue; a continue aimed at this loop lets it go on.
+func (sh *Shell) endIteration() bool {
+	switch {
+	case sh.breaking > 0:
+		sh.breaking--
+		return true
+	case sh.continuing > 1:
+		sh.continuing--
+		return true
+	case sh.continuing == 1:
+		sh.continuing = 0
+	}
+	return sh.returning || sh.interrupted.Load()
+}
+
+// handleBreak leaves the innermost n enclosing loops, by default one.
+func (sh *Shell) handleBreak(parts []string, streams stdio) int {
+	n, ok := sh.loopCount(parts, streams)
+	if !ok {
+		return 1
+	}
+	if n > 0 {
+		sh.breaking = n
+	}
+	return 0
+}
+
+// handleContinue starts the next iteration of the nth enclosing loop, by
+// default the innermost one.
+func (sh *Shell) handleContinue(parts []string, streams stdio) int {
+	n, ok := sh.loopCount(parts, streams)
+	if !ok {
+		return 1
+	}
+	if n > 0 {
+		sh.continuing = n
+	}
+	return 0
+}
+
+// loopCount parses the optional loop count of break and continue, limited
+// to the number of enclosing loops. Outside a loop the count is 0.
+func (sh *Shell) loopCount(parts []string, streams stdio) (int, bool) {
+	n := 1
+	if len(parts) > 1 {
+		var err error
+		n, err = strconv.Atoi(parts[1])
+		if err != nil {
+			fmt.Fprintf(streams.err, "%s: %s: numeric argument required\n", parts[0], parts[1])
+			return 0, false
+		}
+		if n < 1 {
+			fmt.Fprintf(streams.err, "%s: %s: loop count out of range\n", parts[0], parts[1])
+			return 0, false
+		}
+	}
+	if sh.loopDepth == 0 {
+		fmt.Fprintf(streams.err, "%s: only meaningful in a `for', `while', or `until' loop\n", parts[0])
+		return 0, true
+	}
+	return min(n, sh.loopDepth), true
+}
@@ -0,0 +1,94 @@
+package shell
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunControl(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		stdout string
+		stderr string
+		status int
+	}{
+		{name: "if", src: "if true; then echo yes; else echo no; fi", stdout: "yes\n"},
+		{name: "elif", src: "if false; then echo 1; elif true; then echo 2; else echo 3; fi", stdout: "2\n"},
+		{name: "else", src: "if false; then echo 1; elif false; then echo 2; else echo 3; fi", stdout: "3\n"},
+		{name: "if status of body", src: "if true; then (exit 3); fi", status: 3},
+		{name: "if without branch run", src: "if false; then echo no; fi", status: 0},
+		{name: "if condition status not kept", src: "if (exit 2); then :; fi; echo $?", stdout: "0\n"},
+
+		{name: "for", src: "for i in a b c; do echo $i; done", stdout: "a\nb\nc\n"},
+		{name: "for positional", src: "set -- x y; for i; do echo $i; done", stdout: "x\ny\n"},
+		{name: "for status of last body", src: "for i in 1 2; do test $i = 1; done", status: 1},
+		{name: "for without words", src: "false; for i in; do :; done", status: 0},
+		{name: "while", src: "i=; while test \"$i\" != xxx; do i=${i}x; echo $i; done", stdout: "x\nxx\nxxx\n"},
+		{name: "until", src: "i=; until test \"$i\" = xx; do i=${i}x; echo $i; done", stdout: "x\nxx\n"},
+		{name: "while never run", src: "false; while false; do :; done", status: 0},
+		{name: "while status of last body", src: "i=0; while test $i = 0; do i=1; (exit 4); done", status: 4},
+
+		{name: "break", src: "for i in 1 2 3; do echo $i; break; echo no; done; echo $?", stdout: "1\n0\n"},
+		{name: "break 2", src: "for i in 1 2; do for j in a b; do echo $i$j; break 2; done; echo no; done; echo end", stdout: "1a\nend\n"},
+		{name: "break 2 from while", src: "for i in 1 2; do while true; do echo $i; break 2; done; done", stdout: "1\n"},
+		{name: "break beyond loops", src: "for i in 1 2; do for j in a b; do echo $i$j; break 5; done; done; echo end", stdout: "1a\nend\n"},
+		{name: "continue", src: "for i in 1 2 3; do test $i = 2 && continue; echo $i; done", stdout: "1\n3\n"},
+		{name: "continue 2", src: "for i in 1 2; do for j in a b; do echo $i$j; continue 2; echo no; done; echo no; done", stdout: "1a\n2a\n"},
+		{name: "continue 2 in while", src: "i=; while test \"$i\" != xx; do i=${i}x; for j in a b; do echo $i$j; continue 2; done; done", stdout: "xa\nxxa\n"},
+		{name: "break in condition", src: "while break; do echo no; done; echo end", stdout: "end\n"},
+		{
+			name:   "break in function",
+			src:    "f() { break; }; for i in 1 2; do echo $i; f; done",
+			stdout: "1\n2\n",
+			stderr: "break: only meaningful in a `for', `while', or `until' loop\nbreak: only meaningful in a `for', `while', or `until' loop\n",
+		},
+		{
+			name:   "break outside loop",
+			src:    "break; echo $?",
+			stdout: "0\n",
+			stderr: "break: only meaningful in a `for', `while', or `until' loop\n",
+		},
+		{
+			name:   "continue outside loop",
+			src:    "continue; echo after",
+			stdout: "after\n",
+			stderr: "continue: only meaningful in a `for', `while', or `until' loop\n",
+		},
+		{
+			name:   "break 0",
+			src:    "for i in 1 2; do break 0; echo $?; done",
+			stdout: "1\n1\n",
+			stderr: "break: 0: loop count out of range\nbreak: 0: loop count out of range\n",
+		},
+
+		{name: "case", src: "case abc in a*) echo a;; *) echo other;; esac", stdout: "a\n"},
+		{name: "case alternatives", src: "case y in x|y|z) echo xyz;; esac", stdout: "xyz\n"},
+		{name: "case default", src: "case q in a) echo a;; *) echo default;; esac", stdout: "default\n"},
+		{name: "case first match only", src: "case a in a) echo one;; a) echo two;; esac", stdout: "one\n"},
+		{name: "case no fallthrough", src: "case a in a) echo one;; *) echo two;; esac", stdout: "one\n"},
+		{name: "case brackets", src: "case b2 in [a-c][0-9]) echo range;; esac", stdout: "range\n"},
+		{name: "case question mark", src: "case ab in ?) echo one;; ??) echo two;; esac", stdout: "two\n"},
+		{name: "case quoted pattern", src: "case abc in '*') echo star;; *) echo any;; esac", stdout: "any\n"},
+		{name: "case pattern from variable", src: "p='a*'; case abc in $p) echo glob;; esac", stdout: "glob\n"},
+		{name: "case quoted variable", src: "p='a*'; case abc in \"$p\") echo glob;; *) echo literal;; esac", stdout: "literal\n"},
+		{name: "case word expanded", src: "w=hello; case $w in hel*) echo hi;; esac", stdout: "hi\n"},
+		{name: "case no match", src: "false; case x in y) echo y;; esac", status: 0},
+		{name: "case status of body", src: "case a in a) (exit 4);; esac", status: 4},
+		{name: "case empty body", src: "false; case a in a) ;; esac", status: 0},
+		{name: "case in loop", src: "for w in a b c; do case $w in b) continue;; esac; echo $w; done", stdout: "a\nc\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, stderr := newTestShell(t)
+			status, err := sh.Run(context.Background(), tt.src)
+			if err != nil {
+				t.Fatalf("Run(%q) error: %v", tt.src, err)
+			}
+			if status != tt.status || stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Errorf("Run(%q) = %d, %q, %q; want %d, %q, %q", tt.src, status, stdout, stderr, tt.status, tt.stdout, tt.stderr)
+			}
+		})
+	}
+}
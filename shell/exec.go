@@ -0,0 +1,521 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/expand"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/redirect"
+	"github.com/codecrafters-io/shell-starter-go/internal/vars"
+)
+
+// stdio holds the standard streams a command reads from and writes to,
+// along with any other descriptors opened by redirections and the job its
+// processes join.
+type stdio struct {
+	in  io.Reader
+	out io.Writer
+	err io.Writer
+	// extra holds descriptors 3 and above.
+	extra redirect.Table
+	job   *job
+}
+
+// table returns the descriptor table made up of the streams.
+func (s stdio) table() redirect.Table {
+	t := s.extra.Clone()
+	for fd, stream := range []any{s.in, s.out, unlocated(s.err)} {
+		if _, closed := stream.(redirect.Closed); !closed && stream != nil {
+			t[fd] = stream
+		}
+	}
+	return t
+}
+
+// stdioFrom returns the streams of a descriptor table for job j.
+func stdioFrom(t redirect.Table, j *job) stdio {
+	s := stdio{in: t.Reader(0), out: t.Writer(1), err: t.Writer(2), extra: redirect.Table{}, job: j}
+	for fd, stream := range t {
+		if fd > 2 {
+			s.extra[fd] = stream
+		}
+	}
+	return s
+}
+
+// exitRequest is raised with panic by the exit builtin and recovered by the
+// nearest enclosing subshell, or by runTopLevel which ends the shell.
+type exitRequest int
+
+// runTopLevel executes a parsed input line in the main shell environment.
+func (sh *Shell) runTopLevel(list *parser.List, streams stdio) {
+	defer func() {
+		if r := recover(); r != nil {
+			status, ok := r.(exitRequest)
+			if !ok {
+				panic(r)
+			}
+			sh.lastStatus = int(status)
+			sh.exited = true
+		}
+	}()
+
+	sh.runList(list, streams)
+}
+
+// runSubshell runs fn in a copy of the shell environment whose commands
+// belong to job j: an exit inside fn only ends fn, and changes to
+// variables and the working directory are discarded.
+func (sh *Shell) runSubshell(j *job, fn func(sub *Shell) int) int {
+	return runCopy(sh.subshell(), j, fn)
+}
+
+// runCopy runs fn in sub, a copy of the shell made with subshell, as part
+// of job j, the way runSubshell does.
+func runCopy(sub *Shell, j *job, fn func(sub *Shell) int) (status int) {
+	defer func() {
+		if r := recover(); r != nil {
+			exit, ok := r.(exitRequest)
+			if !ok {
+				panic(r)
+			}
+			status = int(exit)
+		}
+	}()
+
+	sub.job = j
+	return fn(sub)
+}
+
+// commandSubstitution runs body in a subshell and returns everything it
+// wrote to standard output. It implements expand.Expander.CmdSubst.
+func (sh *Shell) commandSubstitution(body *parser.List) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	// Read concurrently so that large outputs cannot fill the pipe and
+	// block the command.
+	var output bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		output.ReadFrom(r)
+		r.Close()
+		close(done)
+	}()
+
+	sh.substStatus = sh.runSubshell(sh.job, func(sub *Shell) int {
+		streams := sub.stdio()
+		streams.out, streams.job = w, sh.job
+		return sub.runList(body, streams)
+	})
+	w.Close()
+	<-done
+
+	return output.String(), nil
+}
+
+// runList executes each and-or list in order and returns the status of the
+// last one. Lists terminated by "&" are started as background jobs. Once
+// the shell has been interrupted, or break or continue has run, the
+// remaining lists are skipped.
+func (sh *Shell) runList(list *parser.List, streams stdio) int {
+	status := sh.lastStatus
+	for _, andOr := range list.Items {
+		if sh.unwinding() {
+			break
+		}
+		if andOr.Background {
+			sh.runBackground(andOr.Source, streams, func(sub *Shell, streams stdio) int {
+				return sub.runAndOr(andOr, streams)
+			})
+			status = 0
+			sh.lastStatus = status
+			continue
+		}
+		status = sh.runAndOr(andOr, streams)
+	}
+	return status
+}
+
+// runAndOr executes a chain of pipelines, honouring the short-circuit
+// semantics of "&&" and "||".
+func (sh *Shell) runAndOr(andOr *parser.AndOr, streams stdio) int {
+	status := sh.runPipeline(andOr.Pipelines[0], streams)
+	for i, op := range andOr.Ops {
+		if sh.unwinding() {
+			break
+		}
+		if (op == "&&") == (status == 0) {
+			status = sh.runPipeline(andOr.Pipelines[i+1], streams)
+		}
+	}
+	return status
+}
+
+// runPipeline runs a pipeline and returns the exit status of its last
+// stage, inverted by "!". A single command runs directly in the current
+// shell environment; several run as described for runStages. A pipeline
+// that is not already part of a job becomes a foreground job; one of
+// several commands does so even inside a job run in the shell, so that it
+// can be stopped as a whole.
+func (sh *Shell) runPipeline(pipeline *parser.Pipeline, streams stdio) int {
+	run := func(streams stdio) int {
+		if len(pipeline.Commands) == 1 {
+			return sh.runCommand(pipeline.Commands[0], streams)
+		}
+		return sh.runStages(pipeline.Commands, streams)
+	}
+
+	var status int
+	switch {
+	case (streams.job == nil || streams.job.inShell) && len(pipeline.Commands) > 1:
+		status = sh.runStoppable(pipeline.Source, streams, run)
+	case streams.job == nil:
+		status = sh.runForeground(pipeline.Source, streams, run)
+	default:
+		status = run(streams)
+	}
+
+	if pipeline.Negated {
+		status = boolStatus(status != 0)
+	}
+	sh.lastStatus = status
+	return status
+}
+
+// runStages runs every stage concurrently in a subshell of its own,
+// connecting the stdout of each stage to the stdin of the next through an
+// OS pipe. It returns once all stages have finished, with the exit status
+// of the last stage.
+func (sh *Shell) runStages(commands []parser.Command, streams stdio) int {
+	var wg sync.WaitGroup
+	stdin := streams.in
+	statuses := make([]int, len(commands))
+
+	// Copy the shell for every stage before any of them starts, since once
+	// one has started the job can stop and the shell move on.
+	subs := make([]*Shell, len(commands))
+	for i := range subs {
+		subs[i] = sh.subshell()
+	}
+
+	for i, command := range commands {
+		stage := stdio{in: stdin, out: streams.out, err: streams.err, extra: streams.extra, job: streams.job}
+
+		var pipeWriter *os.File
+		if i < len(commands)-1 {
+			pipeReader, writer, err := os.Pipe()
+			if err != nil {
+				fmt.Fprintf(streams.err, "pipe: %v\n", err)
+				statuses[len(statuses)-1] = 1
+				break
+			}
+			pipeWriter = writer
+			stage.out = writer
+			stdin = pipeReader
+		}
+
+		wg.Add(1)
+		go func(i int, command parser.Command, stage stdio, pipeWriter *os.File) {
+			defer wg.Done()
+
+			// Each stage behaves like a subshell: exit must not end the shell.
+			statuses[i] = runCopy(subs[i], stage.job, func(sub *Shell) int {
+				return sub.runCommand(command, stage)
+			})
+
+			// Closing our ends signals EOF downstream and EPIPE upstream.
+			if pipeWriter != nil {
+				pipeWriter.Close()
+			}
+			if i > 0 {
+				stage.in.(*os.File).Close()
+			}
+		}(i, command, stage, pipeWriter)
+	}
+
+	wg.Wait()
+	return statuses[len(statuses)-1]
+}
+
+// runCommand executes a single pipeline stage and returns its status.
+func (sh *Shell) runCommand(command parser.Command, streams stdio) int {
+	streams = sh.locate(command, streams)
+	switch cmd := command.(type) {
+	case *parser.SimpleCommand:
+		return sh.runSimpleCommand(cmd, streams)
+	case *parser.Subshell:
+		return sh.withRedirects(cmd.Redirs, streams, func(streams stdio) int {
+			sub := sh.subshell()
+			run := func(streams stdio) int {
+				return runCopy(sub, streams.job, func(sub *Shell) int {
+					return sub.runList(cmd.Body, streams)
+				})
+			}
+			// Inside a job run in the shell the subshell becomes a job of
+			// its own, named after that job, so that it can be stopped as
+			// a whole.
+			if streams.job != nil && streams.job.inShell {
+				return sh.runStoppable(streams.job.command, streams, run)
+			}
+			return run(streams)
+		})
+	case *parser.Group:
+		return sh.withRedirects(cmd.Redirs, streams, func(streams stdio) int {
+			return sh.runList(cmd.Body, streams)
+		})
+	case *parser.If:
+		return sh.withRedirects(cmd.Redirs, streams, func(streams stdio) int {
+			return sh.runIf(cmd, streams)
+		})
+	case *parser.While:
+		return sh.withRedirects(cmd.Redirs, streams, func(streams stdio) int {
+			return sh.runWhile(cmd, streams)
+		})
+	case *parser.For:
+		return sh.withRedirects(cmd.Redirs, streams, func(streams stdio) int {
+			return sh.runFor(cmd, streams)
+		})
+	case *parser.Case:
+		return sh.withRedirects(cmd.Redirs, streams, func(streams stdio) int {
+			return sh.runCase(cmd, streams)
+		})
+	case *parser.FuncDef:
+		sh.funcs[cmd.Name] = cmd
+		return 0
+	}
+	panic(fmt.Sprintf("unknown command type %T", command))
+}
+
+// runSimpleCommand performs assignments and dispatches a simple command to
+// a function, a builtin or an external executable, returning its exit
+// status.
+func (sh *Shell) runSimpleCommand(cmd *parser.SimpleCommand, streams stdio) int {
+	sh.substStatus = 0
+	args, err := sh.expander.Fields(cmd.Args)
+	if err != nil {
+		return sh.expansionError(err, streams)
+	}
+
+	// Without a command name, assignments change the shell itself, each
+	// one seeing those to its left, and the status is that of the last
+	// command substitution.
+	if len(args) == 0 {
+		for _, assign := range cmd.Assigns {
+			var err error
+			if assign.Array {
+				var values []string
+				if values, err = sh.expander.Fields(assign.Elems); err != nil {
+					return sh.expansionError(err, streams)
+				}
+				err = sh.vars.SetArray(assign.Name, values)
+			} else {
+				var value string
+				if value, err = sh.expander.Word(assign.Value); err != nil {
+					return sh.expansionError(err, streams)
+				}
+				err = sh.vars.Set(assign.Name, value)
+			}
+			if err != nil {
+				fmt.Fprintln(streams.err, err)
+				return 1
+			}
+		}
+		status := sh.substStatus
+		return sh.withRedirects(cmd.Redirs, streams, func(stdio) int {
+			return status
+		})
+	}
+
+	assigns := make([]assignment, len(cmd.Assigns))
+	for i, assign := range cmd.Assigns {
+		value, err := sh.expander.Word(assign.Value)
+		if err != nil {
+			return sh.expansionError(err, streams)
+		}
+		assigns[i] = assignment{name: assign.Name, value: value}
+	}
+
+	return sh.withRedirects(cmd.Redirs, streams, func(streams stdio) int {
+		if fn, ok := sh.funcs[args[0]]; ok {
+			return sh.callFunction(fn, args, assigns, streams)
+		}
+		builtin, ok := lookupBuiltin(args[0])
+		if !ok {
+			return sh.executeExternal(args, sh.environ(assigns), streams)
+		}
+
+		var status int
+		err := sh.withAssignments(assigns, func() {
+			status = builtin.Run(sh, args, streams)
+		})
+		if err != nil {
+			fmt.Fprintln(streams.err, err)
+			return 1
+		}
+		return status
+	})
+}
+
+// expansionError reports err, an error expanding a word, and returns the
+// status 1. A fatal error such as that of ${NAME:?} ends the shell unless
+// it is interactive.
+func (sh *Shell) expansionError(err error, streams stdio) int {
+	fmt.Fprintln(streams.err, err)
+	var expandErr *expand.Error
+	if errors.As(err, &expandErr) && expandErr.Fatal && !sh.interactive {
+		panic(exitRequest(1))
+	}
+	return 1
+}
+
+// withRedirects applies redirs from left to right on top of streams, runs
+// fn with the result and closes any opened files afterwards.
+func (sh *Shell) withRedirects(redirs []*parser.Redirect, streams stdio, fn func(stdio) int) int {
+	if len(redirs) == 0 {
+		return fn(streams)
+	}
+
+	var list []redirect.Redirection
+	for _, r := range redirs {
+		var target string
+		var err error
+		switch {
+		case r.Heredoc != nil:
+			target, err = sh.expander.Word(r.Heredoc)
+		case r.Op == "<<<":
+			target, err = sh.expander.Word(r.Target)
+		default:
+			target, err = sh.expandRedirectTarget(r.Target)
+		}
+		if err != nil {
+			return sh.expansionError(err, streams)
+		}
+		redirections, err := redirect.New(r.Fd, r.Op, target)
+		if err != nil {
+			fmt.Fprintln(streams.err, err)
+			return 1
+		}
+		list = append(list, redirections...)
+	}
+
+	table, files, err := streams.table().Apply(list, sh.dir, sh.noclobber)
+	if err != nil {
+		fmt.Fprintln(streams.err, err)
+		return 1
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	return fn(stdioFrom(table, streams.job))
+}
+
+// expandRedirectTarget expands the file name of a redirection, which must
+// produce exactly one field.
+func (sh *Shell) expandRedirectTarget(word *parser.Word) (string, error) {
+	fields, err := sh.expander.Fields([]*parser.Word{word})
+	if err != nil {
+		return "", err
+	}
+	if len(fields) != 1 {
+		return "", fmt.Errorf("%s: ambiguous redirect", word.Value())
+	}
+	return fields[0], nil
+}
+
+// boolStatus converts a condition into an exit status.
+func boolStatus(ok bool) int {
+	if ok {
+		return 0
+	}
+	return 1
+}
+
+// executeExternal runs an external command found in PATH with the given
+// streams and environment as part of the streams' job and returns its exit
+// status. As in POSIX shells, a command that cannot be found yields 127 and
+// one that cannot be executed yields 126.
+func (sh *Shell) executeExternal(parts []string, env []string, streams stdio) int {
+	commandName := parts[0]
+
+	pathEnv := ""
+	for _, entry := range env {
+		if strings.HasPrefix(entry, "PATH=") {
+			pathEnv = entry[len("PATH="):]
+		}
+	}
+
+	executable, err := sh.lookPath(commandName, pathEnv)
+	if err != nil {
+		fmt.Fprintf(streams.err, "%s: command not found\n", commandName)
+		return 127
+	}
+
+	files, err := newChildFiles(streams)
+	if err != nil {
+		fmt.Fprintf(streams.err, "%s: %v\n", commandName, err)
+		return 126
+	}
+
+	// Use the original name as argv[0], not the full path.
+	argv := append([]string{commandName}, parts[1:]...)
+	attr := &os.ProcAttr{Dir: sh.dir, Env: env, Files: files.files}
+	proc, err := sh.startProcess(streams.job, absPath(sh.dir, executable), argv, attr)
+	files.closeChildEnds()
+	if errors.Is(err, syscall.ENOEXEC) {
+		files.wait()
+		return sh.runScriptFile(executable, parts, env, streams)
+	}
+	if err != nil {
+		files.wait()
+		fmt.Fprintf(streams.err, "%s: %v\n", commandName, err)
+		return 126
+	}
+
+	status, stopped := waitProcess(streams.job, proc)
+	if stopped {
+		return sh.stopProcess(streams.job, proc, syscall.Signal(status), strings.Join(parts, " "), files, streams.err)
+	}
+	files.wait()
+	return status
+}
+
+// runScriptFile runs a script without a "#!" line in a subshell, as other
+// shells do, with the rest of parts as its positional parameters and env
+// as its exported variables.
+func (sh *Shell) runScriptFile(path string, parts []string, env []string, streams stdio) int {
+	file, err := os.Open(absPath(sh.dir, path))
+	if err != nil {
+		fmt.Fprintf(streams.err, "%s: %v\n", parts[0], err)
+		return 126
+	}
+	defer file.Close()
+
+	return sh.runSubshell(streams.job, func(sub *Shell) int {
+		sub.vars = vars.FromEnviron(env)
+		sub.vars.Set("PWD", sub.dir)
+		sub.Name, sub.params = parts[0], parts[1:]
+		sub.funcs = make(map[string]*parser.FuncDef)
+		sub.aliases = make(map[string]string)
+		sub.funcDepth, sub.sourceDepth, sub.loopDepth = 0, 0, 0
+		sub.source = sourceFile{}
+		status, err := sub.runScript(bufio.NewReader(file), streams)
+		if err != nil {
+			fmt.Fprintf(streams.err, "%s: %v\n", sub.Name, err)
+		}
+		return status
+	})
+}
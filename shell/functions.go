@@ -0,0 +1,102 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/vars"
+)
+
+// maxFuncDepth limits how deeply function calls may nest, so that runaway
+// recursion fails with an error instead of exhausting memory.
+const maxFuncDepth = 1000
+
+// callFunction runs fn with args[1:] as its positional parameters and the
+// prefix assignments exported for the duration of the call. Variables
+// declared with local inside fn are restored when it returns.
+func (sh *Shell) callFunction(fn *parser.FuncDef, args []string, assigns []assignment, streams stdio) int {
+	if sh.funcDepth >= maxFuncDepth {
+		fmt.Fprintf(streams.err, "%s: maximum function nesting level exceeded (%d)\n", args[0], maxFuncDepth)
+		return 1
+	}
+
+	params, loopDepth := sh.params, sh.loopDepth
+	sh.params, sh.loopDepth = args[1:], 0
+	sh.funcDepth++
+	defer func() {
+		sh.params, sh.loopDepth = params, loopDepth
+		sh.funcDepth--
+	}()
+
+	var status int
+	err := sh.withAssignments(assigns, func() {
+		sh.vars.PushScope()
+		defer sh.vars.PopScope()
+
+		status = sh.runCommand(fn.Body, streams)
+		if sh.returning {
+			sh.returning = false
+			status = sh.returnStatus
+		}
+	})
+	if err != nil {
+		fmt.Fprintln(streams.err, err)
+		return 1
+	}
+	return status
+}
+
+// handleReturn leaves the current function or sourced file with status n,
+// or with the status of the last command.
+func (sh *Shell) handleReturn(parts []string, streams stdio) int {
+	if sh.funcDepth == 0 && sh.sourceDepth == 0 {
+		fmt.Fprintln(streams.err, "return: can only `return' from a function or sourced script")
+		return 1
+	}
+
+	status := sh.lastStatus
+	if len(parts) > 1 {
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			fmt.Fprintf(streams.err, "return: %s: numeric argument required\n", parts[1])
+			n = 2
+		}
+		status = n & 0xff
+	}
+	sh.returning = true
+	sh.returnStatus = status
+	return status
+}
+
+// handleLocal declares variables local to the current function, optionally
+// assigning them. A local variable without a value starts out unset.
+func (sh *Shell) handleLocal(parts []string, streams stdio) int {
+	if sh.funcDepth == 0 {
+		fmt.Fprintln(streams.err, "local: can only be used in a function")
+		return 1
+	}
+
+	status := 0
+	for _, arg := range parts[1:] {
+		name, value, hasValue := splitNameValue(arg)
+		if !vars.IsName(name) {
+			fmt.Fprintf(streams.err, "local: `%s': not a valid identifier\n", arg)
+			status = 1
+			continue
+		}
+
+		sh.vars.Local(name)
+		var err error
+		if hasValue {
+			err = sh.vars.Set(name, value)
+		} else {
+			err = sh.vars.Unset(name)
+		}
+		if err != nil {
+			fmt.Fprintf(streams.err, "local: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
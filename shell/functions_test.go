@@ -0,0 +1,91 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestRunFunctions(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		stdout string
+		stderr string
+		status int
+	}{
+		{name: "define and call", src: "f() { echo called; }; f", stdout: "called\n"},
+		{name: "function keyword", src: "function f { echo kw; }; f", stdout: "kw\n"},
+		{name: "status of last command", src: "f() { (exit 5); }; f", status: 5},
+		{name: "positional parameters", src: "f() { echo \"$#:$1:$2\"; }; set -- a b c; f x y; echo \"$#:$1\"", stdout: "2:x:y\n3:a\n"},
+		{name: "no arguments", src: "f() { echo \"$#\"; }; set -- a; f", stdout: "0\n"},
+		{name: "globals shared", src: "f() { echo $x; x=in; }; x=out; f; echo $x", stdout: "out\nin\n"},
+		{name: "prefix assignment", src: "f() { echo $v; }; v=1 f; echo \"[$v]\"", stdout: "1\n[]\n"},
+		{name: "type", src: "f() { echo hi; }; type f", stdout: "f is a function\nf() { echo hi; }\n"},
+
+		{name: "return", src: "f() { return 3; echo no; }; f; echo $?", stdout: "3\n"},
+		{name: "return last status", src: "f() { false; return; }; f; echo $?", stdout: "1\n"},
+		{name: "return wraps", src: "f() { return 257; }; f", status: 1},
+		{name: "return from loop", src: "f() { for i in 1 2; do while true; do return 4; done; done; echo no; }; f; echo $?", stdout: "4\n"},
+		{name: "return from inner function", src: "g() { return 1; echo no; }; f() { g; echo after $?; }; f", stdout: "after 1\n"},
+		{name: "return in subshell", src: "f() { (return 2); echo after $?; }; f", stdout: "after 2\n"},
+		{
+			name:   "return non-numeric",
+			src:    "f() { return x; echo no; }; f",
+			stderr: "return: x: numeric argument required\n",
+			status: 2,
+		},
+		{
+			name:   "return outside function",
+			src:    "return 3; echo $?",
+			stdout: "1\n",
+			stderr: "return: can only `return' from a function or sourced script\n",
+		},
+
+		{name: "local shadows", src: "x=global; f() { local x=inner; echo $x; }; f; echo $x", stdout: "inner\nglobal\n"},
+		{name: "local starts unset", src: "x=global; f() { local x; echo \"[${x-unset}]\"; }; f", stdout: "[unset]\n"},
+		{name: "local restored after assignment", src: "x=orig; f() { local x; x=changed; echo $x; }; f; echo $x", stdout: "changed\norig\n"},
+		{name: "local unset before", src: "f() { local x=in; }; f; echo \"[${x-unset}]\"", stdout: "[unset]\n"},
+		{name: "local seen by callees", src: "g() { echo $x; x=g; }; f() { local x=f; g; echo $x; }; x=top; f; echo $x", stdout: "f\ng\ntop\n"},
+		{name: "local nested", src: "g() { local x=g; echo $x; }; f() { local x=f; g; echo $x; }; x=top; f; echo $x", stdout: "g\nf\ntop\n"},
+		{name: "local restored on return", src: "f() { local x=in; return 1; }; x=out; f; echo $x", stdout: "out\n"},
+		{
+			name:   "local outside function",
+			src:    "local x=1; echo $?",
+			stdout: "1\n",
+			stderr: "local: can only be used in a function\n",
+		},
+		{
+			name:   "local invalid name",
+			src:    "f() { local 1x=2 y=3; echo $? $y; }; f",
+			stdout: "1 3\n",
+			stderr: "local: `1x=2': not a valid identifier\n",
+		},
+
+		{name: "recursion", src: "f() { if test \"$1\" != xxxxx; then f \"x$1\"; else echo \"$1\"; fi; }; f", stdout: "xxxxx\n"},
+		{
+			name:   "recursion limit",
+			src:    "f() { f; }; f; echo $?",
+			stdout: "1\n",
+			stderr: fmt.Sprintf("f: maximum function nesting level exceeded (%d)\n", maxFuncDepth),
+		},
+		{
+			name:   "recursion limit leaves shell usable",
+			src:    "f() { f; }; f 2>/dev/null; g() { echo $1; }; g ok",
+			stdout: "ok\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, stderr := newTestShell(t)
+			status, err := sh.Run(context.Background(), tt.src)
+			if err != nil {
+				t.Fatalf("Run(%q) error: %v", tt.src, err)
+			}
+			if status != tt.status || stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Errorf("Run(%q) = %d, %q, %q; want %d, %q, %q", tt.src, status, stdout, stderr, tt.status, tt.stdout, tt.stderr)
+			}
+		})
+	}
+}
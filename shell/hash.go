@@ -0,0 +1,120 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// handleHash manages the command hash table. Without arguments it lists
+// the remembered commands and how often each was used; with names it looks
+// them up in PATH and remembers them. -r forgets every command, -p path
+// remembers path for the names, -d forgets the names, -t prints where they
+// are, and -l lists the table as hash commands.
+func (sh *Shell) handleHash(parts []string, streams stdio) int {
+	args := parts[1:]
+	var path string
+	var cleared, pinned, remove, print, reusable bool
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			switch arg[i] {
+			case 'r':
+				sh.hashTable().Clear()
+				cleared = true
+			case 'd':
+				remove = true
+			case 't':
+				print = true
+			case 'l':
+				reusable = true
+			case 'p':
+				path = arg[i+1:]
+				if path == "" {
+					if len(args) == 0 {
+						fmt.Fprintln(streams.err, "hash: -p: option requires an argument")
+						return 2
+					}
+					path, args = args[0], args[1:]
+				}
+				pinned = true
+				i = len(arg)
+			default:
+				fmt.Fprintf(streams.err, "hash: -%c: invalid option\n", arg[i])
+				fmt.Fprintln(streams.err, "hash: usage: hash [-lr] [-p pathname] [-dt] [name ...]")
+				return 2
+			}
+		}
+	}
+
+	table := sh.hashTable()
+	if len(args) == 0 {
+		if cleared || pinned || remove || print {
+			return 0
+		}
+		return sh.listHash(reusable, streams)
+	}
+
+	status := 0
+	pathEnv, _ := sh.vars.Get("PATH")
+	for _, name := range args {
+		switch {
+		case pinned:
+			table.Add(name, path)
+		case remove:
+			if !table.Remove(name) {
+				fmt.Fprintf(streams.err, "hash: %s: not found\n", name)
+				status = 1
+			}
+		case print:
+			entry, ok := table.Get(name)
+			if !ok {
+				fmt.Fprintf(streams.err, "hash: %s: not found\n", name)
+				status = 1
+			} else if len(args) > 1 {
+				fmt.Fprintf(streams.out, "%s\t%s\n", name, entry.Path)
+			} else {
+				fmt.Fprintln(streams.out, entry.Path)
+			}
+		default:
+			// Functions, builtins and paths are not hashed.
+			if _, ok := sh.funcs[name]; ok || strings.Contains(name, "/") {
+				continue
+			}
+			if _, ok := lookupBuiltin(name); ok {
+				continue
+			}
+			if _, err := sh.lookPath(name, pathEnv); err != nil {
+				fmt.Fprintf(streams.err, "hash: %s: not found\n", name)
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+// listHash prints the hash table with the number of times each command
+// was used, or as hash -p commands when reusable is set.
+func (sh *Shell) listHash(reusable bool, streams stdio) int {
+	entries := sh.hashTable().Entries()
+	if len(entries) == 0 {
+		fmt.Fprintln(streams.out, "hash: hash table empty")
+		return 0
+	}
+	if !reusable {
+		fmt.Fprintln(streams.out, "hits\tcommand")
+	}
+	for _, e := range entries {
+		if reusable {
+			fmt.Fprintf(streams.out, "hash -p %s %s\n", parser.QuoteWord(e.Path), parser.QuoteWord(e.Name))
+		} else {
+			fmt.Fprintf(streams.out, "%4d\t%s\n", e.Hits, e.Path)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/history"
+)
+
+// defaultHistSize is the number of entries kept when HISTSIZE is unset or
+// not a number.
+const defaultHistSize = 500
+
+// histSize returns the history size limit given by HISTSIZE.
+func (sh *Shell) histSize() int {
+	return sizeVar(sh, "HISTSIZE", defaultHistSize)
+}
+
+// histFileSize returns the history file's line limit given by
+// HISTFILESIZE, which defaults to the history size.
+func (sh *Shell) histFileSize() int {
+	return sizeVar(sh, "HISTFILESIZE", sh.histSize())
+}
+
+// sizeVar returns the numeric value of the variable name, or def if it is
+// unset or not a number. Negative values mean no limit.
+func sizeVar(sh *Shell, name string, def int) int {
+	value, ok := sh.vars.Get(name)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// historyFile returns the path of the history file, or "" if the history
+// is not saved.
+func (sh *Shell) historyFile() string {
+	path, _ := sh.vars.Get("HISTFILE")
+	return path
+}
+
+// loadHistory sets HISTFILE to ~/.myshell_history unless it is already
+// set and reads the entries saved by earlier sessions.
+func (sh *Shell) loadHistory(stderr io.Writer) {
+	if _, ok := sh.vars.Get("HISTFILE"); !ok {
+		if home, ok := sh.vars.Get("HOME"); ok {
+			sh.vars.Set("HISTFILE", filepath.Join(home, ".myshell_history"))
+		}
+	}
+
+	sh.history.SetSize(sh.histSize())
+	if path := sh.historyFile(); path != "" {
+		if err := sh.history.ReadFile(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(stderr, "history: %s: %v\n", path, err)
+		}
+	}
+}
+
+// saveHistory appends the entries added in this session to the history
+// file.
+func (sh *Shell) saveHistory(stderr io.Writer) {
+	path := sh.historyFile()
+	if path == "" {
+		return
+	}
+	if err := sh.history.AppendFile(path, sh.histFileSize()); err != nil {
+		fmt.Fprintf(stderr, "history: %s: %v\n", path, err)
+	}
+}
+
+// addHistory records a line entered interactively, honouring HISTSIZE and
+// HISTCONTROL, and reports whether it was added.
+func (sh *Shell) addHistory(line string) bool {
+	control, _ := sh.vars.Get("HISTCONTROL")
+	sh.history.SetSize(sh.histSize())
+	return sh.history.Add(line, history.ParseControl(control))
+}
+
+// handleHistory lists the history, or the last n entries. -c clears it,
+// -d n deletes entry n, and -a, -r and -w append the new entries to the
+// history file, read the file into the history, and write the history to
+// the file. The file may be given as an argument instead of HISTFILE.
+func (sh *Shell) handleHistory(parts []string, streams stdio) int {
+	args := parts[1:]
+	var op byte
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			switch arg[i] {
+			case 'c':
+				sh.history.Clear()
+				sh.historyChanged = true
+			case 'd':
+				if len(args) == 0 {
+					fmt.Fprintln(streams.err, "history: -d: option requires an argument")
+					return 2
+				}
+				n, err := strconv.Atoi(args[0])
+				if err == nil {
+					err = sh.history.Delete(n)
+				} else {
+					err = history.ErrOutOfRange
+				}
+				if err != nil {
+					fmt.Fprintf(streams.err, "history: %s: %v\n", args[0], err)
+					return 1
+				}
+				args = args[1:]
+				sh.historyChanged = true
+			case 'a', 'r', 'w':
+				if op != 0 && op != arg[i] {
+					fmt.Fprintln(streams.err, "history: cannot use more than one of -anrw")
+					return 1
+				}
+				op = arg[i]
+			default:
+				fmt.Fprintf(streams.err, "history: -%c: invalid option\n", arg[i])
+				fmt.Fprintln(streams.err, "history: usage: history [-c] [-d offset] [n] or history -anrw [filename]")
+				return 2
+			}
+		}
+	}
+
+	if op != 0 {
+		return sh.historyFileOp(op, args, streams)
+	}
+	// -c and -d print nothing.
+	if len(args) == 0 && len(parts) > 1 {
+		return 0
+	}
+	return sh.listHistory(args, streams)
+}
+
+// historyFileOp performs one of the file operations -a, -r and -w.
+func (sh *Shell) historyFileOp(op byte, args []string, streams stdio) int {
+	name := sh.historyFile()
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if name == "" {
+		return 0
+	}
+	path := absPath(sh.dir, name)
+
+	var err error
+	switch op {
+	case 'a':
+		err = sh.history.AppendFile(path, sh.histFileSize())
+	case 'r':
+		err = sh.history.ReadFile(path)
+		sh.historyChanged = true
+	case 'w':
+		err = sh.history.WriteFile(path, sh.histFileSize())
+	}
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		fmt.Fprintf(streams.err, "history: %s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// listHistory prints the history with entry numbers, or the last n
+// entries when args holds n.
+func (sh *Shell) listHistory(args []string, streams stdio) int {
+	entries := sh.history.Entries()
+	start := 0
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			fmt.Fprintf(streams.err, "history: %s: numeric argument required\n", args[0])
+			return 1
+		}
+		start = max(0, len(entries)-n)
+	}
+	for i := start; i < len(entries); i++ {
+		fmt.Fprintf(streams.out, "%5d  %s\n", sh.history.Number(i), entries[i])
+	}
+	return 0
+}
@@ -0,0 +1,197 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/chzyer/readline"
+	"github.com/codecrafters-io/shell-starter-go/internal/history"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// Interact runs the interactive read-eval loop on the terminal the process
+// reads from, with job control, until end of input or exit. It returns the
+// shell's exit status, at once if a startup file has already run exit.
+func (sh *Shell) Interact() int {
+	if err := sh.init(); err != nil {
+		fmt.Fprintf(sh.stdio().err, "%s: %v\n", sh.Name, err)
+		return 1
+	}
+	if sh.exited {
+		return sh.lastStatus
+	}
+
+	config := &readline.Config{
+		Prompt:       "$ ",
+		AutoComplete: sh.completer,
+		// The shell keeps the history itself and hands readline each
+		// entry, so that HISTCONTROL and the history builtin apply to
+		// what the arrow keys recall.
+		DisableAutoSaveHistory: true,
+		HistoryLimit:           math.MaxInt32,
+		// Ctrl-Z at the prompt would make readline stop the shell itself.
+		FuncFilterInputRune: func(r rune) (rune, bool) {
+			return r, r != readline.CharCtrlZ
+		},
+	}
+
+	rl, err := readline.NewEx(config)
+	if err != nil {
+		fmt.Fprintf(sh.stdio().err, "Failed to initialize readline: %v\n", err)
+		return 1
+	}
+	defer rl.Close()
+
+	// Ctrl-C is meant for the foreground job, never the shell itself; it
+	// only stops the command line being run. Catching SIGINT rather than
+	// ignoring it lets children still be interrupted.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			sh.interrupted.Store(true)
+		}
+	}()
+	sh.initJobControl()
+
+	streams := sh.stdio()
+	sh.interactive = true
+	sh.histExpand = true
+	sh.loadHistory(streams.err)
+	syncHistory(rl, sh.history)
+	defer sh.saveHistory(streams.err)
+
+	for !sh.exited {
+		sh.reportJobs(streams.err)
+		sh.interrupted.Store(false)
+		sh.runPromptCommand(streams)
+		if sh.exited {
+			break
+		}
+		input, list, err := sh.readCommand(rl, streams.err)
+		if input != "" && sh.addHistory(input) {
+			rl.SaveHistory(input)
+		}
+		if err != nil {
+			if err == io.EOF {
+				return 0
+			}
+			if err == readline.ErrInterrupt {
+				// Ctrl-C discards the line being edited.
+				sh.lastStatus = 128 + int(syscall.SIGINT)
+				continue
+			}
+			var syntaxErr *parser.Error
+			if errors.As(err, &syntaxErr) {
+				fmt.Fprintln(streams.err, err)
+				sh.lastStatus = 2
+				continue
+			}
+			var expandErr *historyError
+			if errors.As(err, &expandErr) {
+				fmt.Fprintln(streams.err, err)
+				continue
+			}
+			return 1
+		}
+
+		sh.interrupted.Store(false)
+		sh.runTopLevel(list, streams)
+		if sh.interrupted.Load() && !sh.exited {
+			sh.lastStatus = 128 + int(syscall.SIGINT)
+		}
+		if sh.historyChanged {
+			syncHistory(rl, sh.history)
+			sh.historyChanged = false
+		}
+	}
+	return sh.lastStatus
+}
+
+// syncHistory replaces the history readline recalls with the arrow keys by
+// the entries of h.
+func syncHistory(rl *readline.Instance, h *history.History) {
+	rl.ResetHistory()
+	for _, entry := range h.Entries() {
+		rl.SaveHistory(entry)
+	}
+}
+
+// historyError is a failed history expansion, which discards the line.
+type historyError struct {
+	err error
+}
+
+func (e *historyError) Error() string {
+	return e.err.Error()
+}
+
+// readCommand reads and parses one complete command, returning its text
+// along with the result. While the input ends inside a construct such as
+// an open quote or a here-document, further lines are read with the
+// continuation prompt PS2. Each line is subject to history expansion.
+func (sh *Shell) readCommand(rl *readline.Instance, stderr io.Writer) (string, *parser.List, error) {
+	sh.setPrompt(rl, "PS1", defaultPS1)
+	input, err := sh.readLine(rl, stderr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for {
+		list, err := sh.parse(input)
+		if !parser.IsIncomplete(err) {
+			return input, list, err
+		}
+
+		sh.setPrompt(rl, "PS2", defaultPS2)
+		line, readErr := sh.readLine(rl, stderr)
+		var expandErr *historyError
+		if errors.As(readErr, &expandErr) {
+			return "", nil, readErr
+		}
+		if readErr != nil {
+			// Report what was left open before giving up on the input,
+			// unless the user abandoned it with Ctrl-C.
+			if readErr != readline.ErrInterrupt {
+				fmt.Fprintln(stderr, err)
+			}
+			return input, nil, readErr
+		}
+		input += "\n" + line
+	}
+}
+
+// setPrompt makes the prompt variable name, or def if it is unset, the
+// prompt for the next line, printing any part of it readline cannot show.
+func (sh *Shell) setPrompt(rl *readline.Instance, name, def string) {
+	before, prompt := sh.prompt(name, def)
+	if before != "" {
+		fmt.Fprint(rl.Stdout(), before)
+	}
+	rl.SetPrompt(prompt)
+	sh.completer.Prompt = prompt
+}
+
+// readLine reads one line and, with histexpand set, performs history
+// expansion on it. An expanded line is echoed before it is used.
+func (sh *Shell) readLine(rl *readline.Instance, stderr io.Writer) (string, error) {
+	line, err := rl.Readline()
+	if err != nil || !sh.histExpand {
+		return line, err
+	}
+
+	expanded, changed, err := sh.history.Expand(line)
+	if err != nil {
+		return "", &historyError{err}
+	}
+	if changed {
+		fmt.Fprintln(stderr, expanded)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,810 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// job is a foreground pipeline, or an and-or list run with "&", together
+// with the processes it has started. With job control all of a job's
+// processes share one process group, so the job can be stopped, resumed
+// and given the terminal as a unit.
+//
+// A job whose commands run in the shell itself, rather than in copies of
+// it, cannot be stopped as a whole, since the shell cannot stop itself:
+// each of its processes that stops becomes a stopped job of its own, and
+// the shell carries on with the next command, as bash does.
+type job struct {
+	number  int // position in the job table, or 0 if not in it
+	id      int // identifies the job in $!, kill and wait; see firstJobID
+	command string
+
+	mu         sync.Mutex
+	pgid       int
+	procs      []*process
+	foreground bool
+	// stopped is set once every running process of the job has stopped,
+	// and stopSignal records the signal that stopped the last of them.
+	stopped    bool
+	stopSignal syscall.Signal
+	// notified is set once the current state has been reported.
+	notified bool
+	// interrupted is set when SIGINT killed one of the processes.
+	interrupted bool
+	// halt is the interrupted flag of the shell running a background
+	// job, and haltSignal the signal kill set it with.
+	halt       *atomic.Bool
+	haltSignal syscall.Signal
+
+	status int
+	// inShell is set for a foreground job run in the shell itself.
+	inShell bool
+
+	// stop receives a value whenever the job stops.
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newJob(command string, foreground bool) *job {
+	return &job{
+		command:    command,
+		foreground: foreground,
+		stop:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// addProcess records a process started outside the job's process group.
+func (j *job) addProcess(p *process) {
+	j.mu.Lock()
+	j.procs = append(j.procs, p)
+	j.mu.Unlock()
+}
+
+func (j *job) processStopped(p *process, sig syscall.Signal) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	p.stopped = true
+	for _, proc := range j.procs {
+		if !proc.done && !proc.stopped {
+			return
+		}
+	}
+	j.stopped = true
+	j.stopSignal = sig
+	j.notified = false
+	select {
+	case j.stop <- struct{}{}:
+	default:
+	}
+}
+
+func (j *job) processExited(p *process, interrupted bool) {
+	j.mu.Lock()
+	p.done = true
+	if interrupted {
+		j.interrupted = true
+	}
+	j.mu.Unlock()
+}
+
+// finish records the status of a job whose commands have all completed.
+func (j *job) finish(status int) {
+	j.mu.Lock()
+	j.status = status
+	j.notified = false
+	j.mu.Unlock()
+	close(j.done)
+}
+
+// isDone reports whether the job has completed.
+func (j *job) isDone() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *job) isStopped() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stopped && !j.isDone()
+}
+
+// resume continues a stopped job in the foreground or background.
+func (j *job) resume(foreground bool) {
+	j.mu.Lock()
+	j.foreground = foreground
+	j.stopped = false
+	j.notified = false
+	for _, p := range j.procs {
+		p.stopped = false
+	}
+	// A stop reported before the job is resumed no longer applies.
+	select {
+	case <-j.stop:
+	default:
+	}
+	j.mu.Unlock()
+	j.signal(syscall.SIGCONT)
+}
+
+// signal sends sig to the job's process group, or to each of its live
+// processes when they have no group of their own.
+func (j *job) signal(sig syscall.Signal) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.pgid != 0 {
+		syscall.Kill(-j.pgid, sig)
+		return
+	}
+	for _, p := range j.procs {
+		if !p.done {
+			syscall.Kill(p.pid, sig)
+		}
+	}
+}
+
+// kill sends sig to the job's processes. A signal that ends processes also
+// ends the commands a background job runs in the shell, and continues a
+// stopped job so that it can act on the signal.
+func (j *job) kill(sig syscall.Signal) {
+	j.signal(sig)
+	if !terminates(sig) {
+		return
+	}
+	j.mu.Lock()
+	stopped := j.stopped
+	if j.halt != nil {
+		j.haltSignal = sig
+		j.halt.Store(true)
+	}
+	j.mu.Unlock()
+	if stopped {
+		j.signal(syscall.SIGCONT)
+	}
+}
+
+// leader returns the pid of the job's process group, or of its first
+// process.
+func (j *job) leader() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.pgid != 0 {
+		return j.pgid
+	}
+	if len(j.procs) > 0 {
+		return j.procs[0].pid
+	}
+	return 0
+}
+
+// hasPid reports whether pid is the job's ID, its process group or one of
+// its processes.
+func (j *job) hasPid(pid int) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if pid == j.id || pid == j.pgid {
+		return true
+	}
+	for _, p := range j.procs {
+		if p.pid == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// state describes the job as the jobs builtin shows it.
+func (j *job) state() string {
+	if j.isDone() {
+		if j.status == 0 {
+			return "Done"
+		}
+		return fmt.Sprintf("Exit %d", j.status)
+	}
+	if j.isStopped() {
+		return "Stopped"
+	}
+	return "Running"
+}
+
+// jobTable holds the jobs the shell knows about. It is shared by the shell
+// and its subshells. The most recently started, stopped or resumed job is
+// the current job (%+) and the one before it the previous job (%-).
+type jobTable struct {
+	mu   sync.Mutex
+	jobs []*job
+	// recent orders the jobs from least to most recently used.
+	recent []*job
+	// ids counts the job IDs handed out.
+	ids int
+}
+
+// firstJobID is the ID of the first job. A background job may run only
+// builtins and so have no process ID, so $! and the kill and wait builtins
+// refer to jobs by an ID instead. IDs start above the largest process ID
+// any supported system uses, so they can never name another process.
+const firstJobID = 1<<22 + 1
+
+// add gives j the lowest free job number and an ID if it has none, and
+// makes it the current job.
+func (t *jobTable) add(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if j.id == 0 {
+		j.id = firstJobID + t.ids
+		t.ids++
+	}
+
+	j.number = 1
+	for _, other := range t.jobs {
+		if other.number >= j.number {
+			j.number = other.number + 1
+		}
+	}
+	t.jobs = append(t.jobs, j)
+	t.recent = append(t.recent, j)
+}
+
+// touch makes j the current job, adding it to the table if needed.
+func (t *jobTable) touch(j *job) {
+	if j.number == 0 {
+		t.add(j)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recent = append(removeJob(t.recent, j), j)
+}
+
+func (t *jobTable) remove(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.jobs = removeJob(t.jobs, j)
+	t.recent = removeJob(t.recent, j)
+}
+
+func removeJob(jobs []*job, j *job) []*job {
+	for i, other := range jobs {
+		if other == j {
+			return append(jobs[:i:i], jobs[i+1:]...)
+		}
+	}
+	return jobs
+}
+
+// list returns the jobs in order of their numbers.
+func (t *jobTable) list() []*job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*job(nil), t.jobs...)
+}
+
+// mark returns '+' for the current job, '-' for the previous one and ' '
+// otherwise.
+func (t *jobTable) mark(j *job) byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.recent)
+	switch {
+	case n > 0 && t.recent[n-1] == j:
+		return '+'
+	case n > 1 && t.recent[n-2] == j:
+		return '-'
+	}
+	return ' '
+}
+
+// find resolves a job specification: %n, %+ or %%, %-, %string for the job
+// whose command starts with string and %?string for the one containing it.
+// A bare number is taken as a job number.
+func (t *jobTable) find(spec string) (*job, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name := strings.TrimPrefix(spec, "%")
+	switch name {
+	case "", "+", "%":
+		if len(t.recent) > 0 {
+			return t.recent[len(t.recent)-1], nil
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	case "-":
+		if len(t.recent) > 1 {
+			return t.recent[len(t.recent)-2], nil
+		}
+		if len(t.recent) > 0 {
+			return t.recent[0], nil
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	if n, err := strconv.Atoi(name); err == nil {
+		for _, j := range t.jobs {
+			if j.number == n {
+				return j, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	var match *job
+	for _, j := range t.jobs {
+		var ok bool
+		if sub, found := strings.CutPrefix(name, "?"); found {
+			ok = strings.Contains(j.command, sub)
+		} else {
+			ok = strings.HasPrefix(j.command, name)
+		}
+		if !ok {
+			continue
+		}
+		if match != nil {
+			return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+		}
+		match = j
+	}
+	if match == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return match, nil
+}
+
+// format renders a job as the jobs builtin and notifications show it.
+func (t *jobTable) format(j *job, long bool) string {
+	state := j.state()
+	command := j.command
+	if state == "Running" {
+		command += " &"
+	}
+	if long {
+		return fmt.Sprintf("[%d]%c %d %-24s%s", j.number, t.mark(j), j.leader(), state, command)
+	}
+	return fmt.Sprintf("[%d]%c  %-24s%s", j.number, t.mark(j), state, command)
+}
+
+// initJobControl enables job control when the shell reads from a terminal:
+// it waits until it is in the foreground, moves into its own process
+// group and takes the terminal. The job control signals are caught rather
+// than ignored so that children still get their default behaviour.
+func (sh *Shell) initJobControl() {
+	fd := int(os.Stdin.Fd())
+	for {
+		pgrp, err := tcgetpgrp(fd)
+		if err != nil {
+			return
+		}
+		if pgrp == syscall.Getpgrp() {
+			break
+		}
+		syscall.Kill(0, syscall.SIGTTIN)
+	}
+
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU)
+
+	pid := os.Getpid()
+	syscall.Setpgid(0, 0)
+	if err := tcsetpgrp(fd, pid); err != nil {
+		return
+	}
+	sh.terminal = fd
+	sh.pgid = pid
+}
+
+// takeTerminal returns the terminal to the shell after a foreground job.
+func (sh *Shell) takeTerminal() {
+	if sh.terminal >= 0 {
+		tcsetpgrp(sh.terminal, sh.pgid)
+	}
+}
+
+// runForeground runs fn in the shell itself as a new foreground job whose
+// processes get the terminal. A process that stops becomes a stopped job
+// of its own (see stopProcess) and fn carries on.
+func (sh *Shell) runForeground(command string, streams stdio, fn func(stdio) int) int {
+	j := newJob(command, true)
+	j.inShell = true
+	streams.job = j
+	defer sh.takeTerminal()
+	stop := context.AfterFunc(sh.ctx, func() { j.signal(syscall.SIGKILL) })
+	defer stop()
+
+	status := fn(streams)
+	j.mu.Lock()
+	interrupted := j.interrupted
+	j.mu.Unlock()
+	if interrupted {
+		fmt.Fprintln(streams.err)
+		sh.interrupted.Store(true)
+	}
+	return status
+}
+
+// runStoppable runs fn as a new foreground job that can be stopped and
+// resumed as a whole. fn runs in a goroutine that carries on after the job
+// stops, so it must leave the shell alone and run commands only in
+// subshells. If the job stops it is added to the job table and control
+// returns to the shell with status 128 plus the stop signal.
+func (sh *Shell) runStoppable(command string, streams stdio, fn func(stdio) int) int {
+	j := newJob(command, true)
+	streams.job = j
+	go func() {
+		j.finish(fn(streams))
+	}()
+	return sh.waitForeground(j, streams.err)
+}
+
+// stopProcess makes p, a stopped process of the job j run in the shell
+// itself, a stopped job of its own named command, reports it and returns
+// its status. The job is waited for in the background, after which the
+// child's output is finished copying with files.
+func (sh *Shell) stopProcess(j *job, p *process, sig syscall.Signal, command string, files *childFiles, stderr io.Writer) int {
+	stopped := newJob(command, false)
+	stopped.procs = []*process{p}
+	stopped.stopped = true
+	stopped.stopSignal = sig
+	stopped.notified = true
+	p.stopped = true
+
+	// Later processes of j start a process group of their own.
+	j.mu.Lock()
+	stopped.pgid = j.pgid
+	j.pgid = 0
+	j.procs = nil
+	j.mu.Unlock()
+
+	sh.jobs.add(stopped)
+	go func() {
+		status, _ := waitProcess(stopped, p)
+		files.wait()
+		stopped.finish(status)
+	}()
+
+	sh.takeTerminal()
+	fmt.Fprintln(stderr)
+	fmt.Fprintln(stderr, sh.jobs.format(stopped, false))
+	return 128 + int(sig)
+}
+
+// waitForeground waits until j completes or stops. If Ctrl-C killed the
+// job, the shell is marked interrupted so the rest of the command line is
+// abandoned, as when the shell itself is interrupted. If the context of
+// Run is cancelled the job is killed.
+func (sh *Shell) waitForeground(j *job, stderr io.Writer) int {
+	defer sh.takeTerminal()
+	cancelled := sh.ctx.Done()
+	for {
+		select {
+		case <-cancelled:
+			cancelled = nil
+			j.signal(syscall.SIGKILL)
+		case <-j.done:
+			if j.number != 0 {
+				sh.jobs.remove(j)
+			}
+			if j.interrupted {
+				fmt.Fprintln(stderr)
+				sh.interrupted.Store(true)
+			}
+			return j.status
+		case <-j.stop:
+			if !j.isStopped() {
+				continue
+			}
+			sh.jobs.touch(j)
+			j.mu.Lock()
+			j.foreground = false
+			j.notified = true
+			sig := j.stopSignal
+			j.mu.Unlock()
+			fmt.Fprintln(stderr)
+			fmt.Fprintln(stderr, sh.jobs.format(j, false))
+			return 128 + int(sig)
+		}
+	}
+}
+
+// runBackground starts fn in a subshell as a background job and returns
+// without waiting for it. Without job control the job reads from the null
+// device rather than competing with the shell for its input.
+func (sh *Shell) runBackground(command string, streams stdio, fn func(sub *Shell, streams stdio) int) {
+	j := newJob(command, false)
+	streams.job = j
+	sh.jobs.add(j)
+
+	var devNull *os.File
+	if sh.terminal < 0 {
+		if f, err := os.Open(os.DevNull); err == nil {
+			devNull = f
+			streams.in = f
+		}
+	}
+
+	// The job outlives the command line and the Run that started it, so
+	// neither interrupting those nor cancelling the context stops it; only
+	// kill does.
+	sub := sh.subshell()
+	j.halt = &atomic.Bool{}
+	sub.interrupted = j.halt
+	sub.ctx = context.Background()
+	go func() {
+		status := sub.runSubshell(j, func(sub *Shell) int {
+			return fn(sub, streams)
+		})
+		if devNull != nil {
+			devNull.Close()
+		}
+		j.mu.Lock()
+		if j.haltSignal != 0 {
+			status = 128 + int(j.haltSignal)
+		}
+		j.mu.Unlock()
+		j.finish(status)
+	}()
+
+	sh.lastBackground = j.id
+	if sh.terminal >= 0 {
+		fmt.Fprintf(streams.err, "[%d] %d\n", j.number, j.id)
+	}
+}
+
+// reportJobs prints the jobs that have finished or stopped since they were
+// last reported and removes the finished ones from the table. The
+// interactive shell calls it before each prompt.
+func (sh *Shell) reportJobs(w io.Writer) {
+	for _, j := range sh.jobs.list() {
+		j.mu.Lock()
+		notified := j.notified
+		j.mu.Unlock()
+		done := j.isDone()
+		if notified || !done && !j.isStopped() {
+			continue
+		}
+
+		fmt.Fprintln(w, sh.jobs.format(j, false))
+		if done {
+			sh.jobs.remove(j)
+			continue
+		}
+		j.mu.Lock()
+		j.notified = true
+		j.mu.Unlock()
+	}
+}
+
+// handleJobs lists the jobs, or the ones named by job specs. With -l the
+// process group is included and with -p only the process group is shown.
+func (sh *Shell) handleJobs(args []string, streams stdio) int {
+	long, pids := false, false
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'l':
+				long = true
+			case 'p':
+				pids = true
+			default:
+				fmt.Fprintf(streams.err, "jobs: -%c: invalid option\n", flag)
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+
+	jobs := sh.jobs.list()
+	if len(args) > 0 {
+		jobs = nil
+		for _, spec := range args {
+			j, err := sh.jobs.find(spec)
+			if err != nil {
+				fmt.Fprintf(streams.err, "jobs: %v\n", err)
+				return 1
+			}
+			jobs = append(jobs, j)
+		}
+	}
+
+	for _, j := range jobs {
+		if pids {
+			fmt.Fprintln(streams.out, j.leader())
+			continue
+		}
+		fmt.Fprintln(streams.out, sh.jobs.format(j, long))
+		if j.isDone() {
+			sh.jobs.remove(j)
+		} else {
+			j.mu.Lock()
+			j.notified = true
+			j.mu.Unlock()
+		}
+	}
+	return 0
+}
+
+// findJob resolves the optional job spec argument of fg and bg.
+func (sh *Shell) findJob(name string, args []string, streams stdio) *job {
+	if sh.terminal < 0 {
+		fmt.Fprintf(streams.err, "%s: no job control\n", name)
+		return nil
+	}
+	spec := "%+"
+	if len(args) > 1 {
+		spec = args[1]
+	}
+	j, err := sh.jobs.find(spec)
+	if err != nil {
+		if len(args) == 1 {
+			err = fmt.Errorf("current: no such job")
+		}
+		fmt.Fprintf(streams.err, "%s: %v\n", name, err)
+		return nil
+	}
+	return j
+}
+
+// handleFg resumes a job in the foreground and waits for it.
+func (sh *Shell) handleFg(args []string, streams stdio) int {
+	j := sh.findJob("fg", args, streams)
+	if j == nil {
+		return 1
+	}
+	if j.isDone() {
+		fmt.Fprintf(streams.err, "fg: job has terminated\n")
+		sh.jobs.remove(j)
+		return 1
+	}
+
+	fmt.Fprintln(streams.out, j.command)
+	sh.jobs.touch(j)
+	if pgid := j.leader(); pgid != 0 {
+		tcsetpgrp(sh.terminal, pgid)
+	}
+	j.resume(true)
+	return sh.waitForeground(j, streams.err)
+}
+
+// handleBg resumes a stopped job in the background.
+func (sh *Shell) handleBg(args []string, streams stdio) int {
+	j := sh.findJob("bg", args, streams)
+	if j == nil {
+		return 1
+	}
+	if j.isDone() {
+		fmt.Fprintf(streams.err, "bg: job has terminated\n")
+		return 1
+	}
+	if !j.isStopped() {
+		fmt.Fprintf(streams.err, "bg: job %d already in background\n", j.number)
+		return 0
+	}
+
+	sh.jobs.touch(j)
+	j.resume(false)
+	fmt.Fprintf(streams.out, "[%d]%c %s &\n", j.number, sh.jobs.mark(j), j.command)
+	return 0
+}
+
+// handleWait waits for the named jobs, job IDs or process IDs, or for
+// every job, and returns the status of the last one waited for. Finished
+// jobs are removed from the table. A stopped job counts as finished
+// waiting. Cancelling the context of Run interrupts the wait, leaving the
+// jobs running, with the status of an interrupt.
+func (sh *Shell) handleWait(args []string, streams stdio) int {
+	var jobs []*job
+	if len(args) == 1 {
+		jobs = sh.jobs.list()
+	}
+
+	status := 0
+	for _, arg := range args[1:] {
+		var j *job
+		var err error
+		if strings.HasPrefix(arg, "%") {
+			j, err = sh.jobs.find(arg)
+		} else if pid, convErr := strconv.Atoi(arg); convErr != nil {
+			err = fmt.Errorf("`%s': not a pid or valid job spec", arg)
+		} else {
+			for _, candidate := range sh.jobs.list() {
+				if candidate.hasPid(pid) {
+					j = candidate
+				}
+			}
+			if j == nil {
+				err = fmt.Errorf("pid %d is not a child of this shell", pid)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(streams.err, "wait: %v\n", err)
+			status = 127
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	for _, j := range jobs {
+		if j.isStopped() {
+			j.mu.Lock()
+			status = 128 + int(j.stopSignal)
+			j.mu.Unlock()
+			continue
+		}
+		select {
+		case <-j.done:
+			status = j.status
+			sh.jobs.remove(j)
+		case <-j.stop:
+			j.mu.Lock()
+			status = 128 + int(j.stopSignal)
+			j.mu.Unlock()
+		case <-sh.ctx.Done():
+			return 128 + int(syscall.SIGINT)
+		}
+		if len(args) == 1 {
+			status = 0
+		}
+	}
+	return status
+}
+
+// handleDisown removes jobs from the table so the shell no longer reports
+// or waits for them. Without arguments the current job is removed; -a
+// removes every job and -r every running one.
+func (sh *Shell) handleDisown(args []string, streams stdio) int {
+	all, running := false, false
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'a':
+				all = true
+			case 'r':
+				running = true
+			default:
+				fmt.Fprintf(streams.err, "disown: -%c: invalid option\n", flag)
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+
+	if all || running {
+		for _, j := range sh.jobs.list() {
+			if !running || j.state() == "Running" {
+				sh.jobs.remove(j)
+			}
+		}
+		return 0
+	}
+
+	if len(args) == 0 {
+		args = []string{"%+"}
+	}
+	status := 0
+	for _, spec := range args {
+		j, err := sh.jobs.find(spec)
+		if err != nil {
+			if spec == "%+" {
+				err = fmt.Errorf("current: no such job")
+			}
+			fmt.Fprintf(streams.err, "disown: %v\n", err)
+			status = 1
+			continue
+		}
+		sh.jobs.remove(j)
+	}
+	return status
+}
@@ -0,0 +1,205 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// interactEnv is set in the environment of the test binary when it is
+// started again to run an interactive shell on a pseudo-terminal.
+const interactEnv = "MYSHELL_TEST_INTERACT"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(interactEnv) != "" {
+		sh := &Shell{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr, Name: "myshell"}
+		os.Exit(sh.Interact())
+	}
+	os.Exit(m.Run())
+}
+
+// terminal is an interactive shell running on a pseudo-terminal, with job
+// control, in a copy of the test binary.
+type terminal struct {
+	t      *testing.T
+	master *os.File
+	cmd    *exec.Cmd
+
+	mu     sync.Mutex
+	output bytes.Buffer
+	// seen is how much of output earlier calls to expect have consumed.
+	seen int
+}
+
+// ioctl performs an ioctl whose argument is a pointer.
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// startTerminal opens a pseudo-terminal and starts an interactive shell on
+// it in dir as the leader of a new session.
+func startTerminal(t *testing.T) *terminal {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	var n uint32
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		t.Fatal(err)
+	}
+	// readline needs a width to lay out the line.
+	size := [4]uint16{24, 200, 0, 0}
+	if err := ioctl(master, syscall.TIOCSWINSZ, unsafe.Pointer(&size)); err != nil {
+		t.Fatal(err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	home := t.TempDir()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = []string{interactEnv + "=1", "PATH=" + os.Getenv("PATH"), "HOME=" + home, "TERM=dumb"}
+	cmd.Dir = home
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	term := &terminal{t: t, master: master, cmd: cmd}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			term.mu.Lock()
+			term.output.Write(buf[:n])
+			term.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		master.Close()
+		term.mu.Lock()
+		defer term.mu.Unlock()
+		if strings.Contains(term.output.String(), "DATA RACE") {
+			t.Errorf("the shell raced:\n%s", term.output.String())
+		}
+	})
+	term.expect("$ ")
+	return term
+}
+
+// send types s at the terminal.
+func (term *terminal) send(s string) {
+	term.t.Helper()
+	if _, err := term.master.Write([]byte(s)); err != nil {
+		term.t.Fatal(err)
+	}
+}
+
+// run types the command line and waits for want to be printed.
+func (term *terminal) run(line, want string) {
+	term.t.Helper()
+	term.send(line + "\r")
+	term.expect(want)
+}
+
+// expect waits until the output after what earlier calls consumed
+// contains want, and consumes the output up to the end of it.
+func (term *terminal) expect(want string) {
+	term.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		term.mu.Lock()
+		rest := term.output.String()[term.seen:]
+		if i := strings.Index(rest, want); i >= 0 {
+			term.seen += i + len(want)
+			term.mu.Unlock()
+			return
+		}
+		term.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	term.mu.Lock()
+	defer term.mu.Unlock()
+	term.t.Fatalf("timed out waiting for %q; output since last match:\n%s", want, term.output.String()[term.seen:])
+}
+
+func TestJobControl(t *testing.T) {
+	term := startTerminal(t)
+
+	// A stopped command becomes a job and returns 128 plus SIGTSTP.
+	term.send("sleep 2\r")
+	time.Sleep(300 * time.Millisecond)
+	term.send("\x1a")
+	term.expect("[1]+  Stopped                 sleep 2")
+	term.run("echo status=$?", "status=148")
+	term.run("jobs", "[1]+  Stopped                 sleep 2")
+
+	// bg resumes it in the background and fg waits for it to finish.
+	term.run("bg", "[1]+ sleep 2 &")
+	term.run("jobs", "[1]+  Running                 sleep 2 &")
+	term.run("fg", "sleep 2")
+	term.run("echo status=$?", "status=0")
+	term.run("jobs; echo none", "none")
+	term.run("fg", "fg: current: no such job")
+}
+
+func TestJobControlShellCommands(t *testing.T) {
+	term := startTerminal(t)
+
+	// Only the process is stopped; the shell goes on with the rest of the
+	// group at once, in the shell itself.
+	term.send("x=0; { sleep 2; x=1; cd /; echo after=$?; }\r")
+	time.Sleep(300 * time.Millisecond)
+	term.send("\x1a")
+	term.expect("Stopped                 sleep 2")
+	term.expect("after=0")
+	term.run("echo x=$x; pwd", "x=1\r\n/")
+	term.run("fg", "sleep 2")
+	term.run("echo x=$x; pwd", "x=1\r\n/")
+}
+
+func TestJobControlSubshells(t *testing.T) {
+	term := startTerminal(t)
+
+	// A pipeline and a subshell are stopped and resumed as a whole, and
+	// change nothing in the shell.
+	term.send("x=0; (sleep 1; x=1; echo sub=$x) | cat\r")
+	time.Sleep(300 * time.Millisecond)
+	term.send("\x1a")
+	term.expect("[1]+  Stopped                 (sleep 1; x=1; echo sub=$x) | cat")
+	term.run("echo status=$? x=$x", "status=148 x=0")
+	term.run("fg", "sub=1")
+	term.run("echo status=$? x=$x", "status=0 x=0")
+
+	term.send("(sleep 1; cd /; echo sub)\r")
+	time.Sleep(300 * time.Millisecond)
+	term.send("\x1a")
+	term.expect("Stopped")
+	term.run("bg", "&")
+	term.expect("sub")
+	term.run("pwd", term.cmd.Dir)
+}
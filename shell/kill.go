@@ -0,0 +1,182 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// signals maps the names kill accepts, without the SIG prefix, to signals.
+var signals = map[string]syscall.Signal{
+	"HUP":    syscall.SIGHUP,
+	"INT":    syscall.SIGINT,
+	"QUIT":   syscall.SIGQUIT,
+	"ILL":    syscall.SIGILL,
+	"TRAP":   syscall.SIGTRAP,
+	"ABRT":   syscall.SIGABRT,
+	"BUS":    syscall.SIGBUS,
+	"FPE":    syscall.SIGFPE,
+	"KILL":   syscall.SIGKILL,
+	"USR1":   syscall.SIGUSR1,
+	"SEGV":   syscall.SIGSEGV,
+	"USR2":   syscall.SIGUSR2,
+	"PIPE":   syscall.SIGPIPE,
+	"ALRM":   syscall.SIGALRM,
+	"TERM":   syscall.SIGTERM,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"STOP":   syscall.SIGSTOP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+	"VTALRM": syscall.SIGVTALRM,
+	"PROF":   syscall.SIGPROF,
+	"WINCH":  syscall.SIGWINCH,
+	"IO":     syscall.SIGIO,
+	"SYS":    syscall.SIGSYS,
+}
+
+// parseSignal resolves a signal number or name, with or without the SIG
+// prefix and in any case.
+func parseSignal(spec string) (syscall.Signal, bool) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		return syscall.Signal(n), n >= 0
+	}
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(spec), "SIG")]
+	return sig, ok
+}
+
+// signalName returns the name of sig without the SIG prefix.
+func signalName(sig syscall.Signal) (string, bool) {
+	for name, s := range signals {
+		if s == sig {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// terminates reports whether the default action of sig ends a process,
+// rather than stopping or continuing it or doing nothing.
+func terminates(sig syscall.Signal) bool {
+	switch sig {
+	case 0, syscall.SIGCHLD, syscall.SIGCONT, syscall.SIGSTOP, syscall.SIGTSTP,
+		syscall.SIGTTIN, syscall.SIGTTOU, syscall.SIGURG, syscall.SIGWINCH:
+		return false
+	}
+	return true
+}
+
+// handleKill sends a signal, SIGTERM unless -s name, -n number or -name
+// says otherwise, to each process ID or job. Jobs are named by job spec or
+// by the ID $! gives them. "kill -l" lists the signal names, or names the
+// signals of the given numbers or exit statuses.
+func (sh *Shell) handleKill(args []string, streams stdio) int {
+	args = args[1:]
+	if len(args) > 0 && args[0] == "-l" {
+		return listSignals(args[1:], streams)
+	}
+
+	sig := syscall.SIGTERM
+	if len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && args[0] != "--" {
+		spec := args[0][1:]
+		if spec == "s" || spec == "n" {
+			if len(args) < 2 {
+				fmt.Fprintf(streams.err, "kill: -%s: option requires an argument\n", spec)
+				return 2
+			}
+			args = args[1:]
+			spec = args[0]
+		}
+		var ok bool
+		if sig, ok = parseSignal(spec); !ok {
+			fmt.Fprintf(streams.err, "kill: %s: invalid signal specification\n", spec)
+			return 1
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(streams.err, "kill: usage: kill [-s sigspec | -n signum | -sigspec] pid | jobspec ... or kill -l [sigspec]")
+		return 2
+	}
+
+	status := 0
+	for _, arg := range args {
+		if err := sh.kill(arg, sig); err != nil {
+			fmt.Fprintf(streams.err, "kill: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// kill sends sig to the job or process arg names.
+func (sh *Shell) kill(arg string, sig syscall.Signal) error {
+	if strings.HasPrefix(arg, "%") {
+		j, err := sh.jobs.find(arg)
+		if err != nil {
+			return err
+		}
+		j.kill(sig)
+		return nil
+	}
+
+	pid, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("%s: arguments must be process or job IDs", arg)
+	}
+	for _, j := range sh.jobs.list() {
+		if j.id == pid {
+			j.kill(sig)
+			return nil
+		}
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("(%d) - %v", pid, err)
+	}
+	return nil
+}
+
+// listSignals prints the names of every signal for kill -l, ordered by
+// number, or those of the signal numbers or exit statuses in args.
+func listSignals(args []string, streams stdio) int {
+	if len(args) == 0 {
+		names := make([]string, 0, len(signals))
+		for name := range signals {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return signals[names[i]] < signals[names[j]] })
+		fmt.Fprintln(streams.out, strings.Join(names, " "))
+		return 0
+	}
+
+	status := 0
+	for _, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			if sig, ok := parseSignal(arg); ok {
+				fmt.Fprintln(streams.out, int(sig))
+				continue
+			}
+		} else {
+			if n > 128 {
+				n -= 128
+			}
+			if name, ok := signalName(syscall.Signal(n)); ok {
+				fmt.Fprintln(streams.out, name)
+				continue
+			}
+		}
+		fmt.Fprintf(streams.err, "kill: %s: invalid signal specification\n", arg)
+		status = 1
+	}
+	return status
+}
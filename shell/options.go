@@ -0,0 +1,179 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// setOptions returns the options changed with "set -o name" by name.
+func (sh *Shell) setOptions() map[string]*bool {
+	return map[string]*bool{
+		"histexpand": &sh.histExpand,
+		"noclobber":  &sh.noclobber,
+		"noglob":     &sh.expander.Glob.NoGlob,
+	}
+}
+
+// shoptOptions returns the options changed with "shopt -s name" by name.
+func (sh *Shell) shoptOptions() map[string]*bool {
+	return map[string]*bool{
+		"dotglob":  &sh.expander.Glob.DotGlob,
+		"failglob": &sh.expander.Glob.FailGlob,
+		"globstar": &sh.expander.Glob.GlobStar,
+		"nullglob": &sh.expander.Glob.NullGlob,
+	}
+}
+
+// sortedOptions returns the option names of options in order.
+func sortedOptions(options map[string]*bool) []string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// setFlags maps the single-letter forms of set options to their names.
+var setFlags = map[string]string{
+	"C": "noclobber",
+	"H": "histexpand",
+	"f": "noglob",
+}
+
+// handleSet lists all shell variables, arrays as NAME=(...), or changes
+// shell options with -o name, +o name and the single-letter flags such as
+// -f and +f. "set -o" and "set +o" alone print the options. The arguments
+// after "--", or from the first one that is not an option, become the
+// positional parameters.
+func (sh *Shell) handleSet(parts []string, streams stdio) int {
+	if len(parts) == 1 {
+		for _, name := range sh.vars.Names() {
+			v, _ := sh.vars.Lookup(name)
+			if v.Array == nil {
+				fmt.Fprintf(streams.out, "%s=%s\n", name, parser.QuoteWord(v.Value))
+				continue
+			}
+			elems := make([]string, len(v.Array))
+			for i, elem := range v.Array {
+				elems[i] = parser.QuoteWord(elem)
+			}
+			fmt.Fprintf(streams.out, "%s=(%s)\n", name, strings.Join(elems, " "))
+		}
+		return 0
+	}
+
+	options := sh.setOptions()
+	for i := 1; i < len(parts); i++ {
+		arg := parts[i]
+		switch {
+		case arg == "--":
+			sh.params = parts[i+1:]
+			return 0
+		case arg == "" || arg[0] != '-' && arg[0] != '+':
+			sh.params = parts[i:]
+			return 0
+		case len(arg) > 1 && (arg[0] == '-' || arg[0] == '+') && setFlags[arg[1:]] != "":
+			*options[setFlags[arg[1:]]] = arg[0] == '-'
+		case arg == "-o" || arg == "+o":
+			if i+1 == len(parts) {
+				for _, name := range sortedOptions(options) {
+					if arg == "-o" {
+						fmt.Fprintf(streams.out, "%-15s\t%s\n", name, onOff(*options[name]))
+					} else if *options[name] {
+						fmt.Fprintf(streams.out, "set -o %s\n", name)
+					} else {
+						fmt.Fprintf(streams.out, "set +o %s\n", name)
+					}
+				}
+				return 0
+			}
+			i++
+			option, ok := options[parts[i]]
+			if !ok {
+				fmt.Fprintf(streams.err, "set: %s: invalid option name\n", parts[i])
+				return 2
+			}
+			*option = arg == "-o"
+		default:
+			fmt.Fprintf(streams.err, "set: %s: invalid option\n", arg)
+			return 2
+		}
+	}
+	return 0
+}
+
+// handleShopt sets (-s) or unsets (-u) shell options, or prints them. With
+// -q nothing is printed and the status reports whether all named options
+// are set.
+func (sh *Shell) handleShopt(parts []string, streams stdio) int {
+	options := sh.shoptOptions()
+	set, unset, quiet := false, false, false
+
+	args := parts[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 's':
+				set = true
+			case 'u':
+				unset = true
+			case 'q':
+				quiet = true
+			default:
+				fmt.Fprintf(streams.err, "shopt: -%c: invalid option\n", flag)
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+	if set && unset {
+		fmt.Fprintln(streams.err, "shopt: cannot set and unset shell options simultaneously")
+		return 1
+	}
+
+	for _, name := range args {
+		if _, ok := options[name]; !ok {
+			fmt.Fprintf(streams.err, "shopt: %s: invalid shell option name\n", name)
+			return 1
+		}
+	}
+
+	if set || unset {
+		for _, name := range args {
+			*options[name] = set
+		}
+		if len(args) > 0 {
+			return 0
+		}
+	}
+
+	names := args
+	if len(names) == 0 {
+		names = sortedOptions(options)
+	}
+	status := 0
+	for _, name := range names {
+		on := *options[name]
+		if (set && !on) || (unset && on) {
+			continue
+		}
+		if !on {
+			status = 1
+		}
+		if !quiet {
+			fmt.Fprintf(streams.out, "%-15s\t%s\n", name, onOff(on))
+		}
+	}
+	return status
+}
@@ -0,0 +1,188 @@
+package shell
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/redirect"
+)
+
+// process is a child process started by the shell.
+type process struct {
+	pid     int
+	stopped bool
+	done    bool
+}
+
+// startProcess starts the program at path as part of job j, which may be
+// nil for processes outside any job. With job control the process joins
+// the job's process group, the first process creating it, and a
+// foreground job's process takes the terminal before the program runs.
+func (sh *Shell) startProcess(j *job, path string, argv []string, attr *os.ProcAttr) (*process, error) {
+	if j == nil || sh.terminal < 0 {
+		proc, err := os.StartProcess(path, argv, attr)
+		if err != nil {
+			return nil, err
+		}
+		p := &process{pid: proc.Pid}
+		proc.Release()
+		if j != nil {
+			j.addProcess(p)
+		}
+		return p, nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	sys := &syscall.SysProcAttr{Setpgid: true, Pgid: j.pgid, Foreground: j.foreground, Ctty: sh.terminal}
+	attr.Sys = sys
+	proc, err := os.StartProcess(path, argv, attr)
+	if errors.Is(err, syscall.EPERM) && j.pgid != 0 {
+		// Every earlier member of the group has exited and been reaped,
+		// so the group is gone; start a new one.
+		sys.Pgid = 0
+		proc, err = os.StartProcess(path, argv, attr)
+		j.pgid = 0
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &process{pid: proc.Pid}
+	proc.Release()
+	if j.pgid == 0 {
+		j.pgid = p.pid
+	}
+	j.procs = append(j.procs, p)
+	return p, nil
+}
+
+// waitProcess waits for p to exit and returns its exit status, or 128 plus
+// the signal number if a signal killed it. Each time p stops, j is told so
+// that a foreground wait can return; waiting then resumes until p exits.
+// For a job run in the shell itself waitProcess instead returns as soon as
+// p stops, with the stop signal and stopped set.
+func waitProcess(j *job, p *process) (status int, stopped bool) {
+	for {
+		var ws syscall.WaitStatus
+		_, err := syscall.Wait4(p.pid, &ws, syscall.WUNTRACED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 1, false
+		}
+
+		if ws.Stopped() {
+			if j != nil && j.inShell {
+				return int(ws.StopSignal()), true
+			}
+			if j != nil {
+				j.processStopped(p, ws.StopSignal())
+			}
+			continue
+		}
+
+		if j != nil {
+			j.processExited(p, ws.Signaled() && ws.Signal() == syscall.SIGINT)
+		}
+		if ws.Signaled() {
+			return 128 + int(ws.Signal()), false
+		}
+		return ws.ExitStatus(), false
+	}
+}
+
+// childFiles is the descriptor table of a child process. Streams that are
+// not files are connected to the child through pipes.
+type childFiles struct {
+	files []*os.File
+	// childEnds are pipe ends only the child uses; the parent closes them
+	// once the child has started.
+	childEnds []*os.File
+	// copies tracks the goroutines copying the child's output.
+	copies sync.WaitGroup
+	// feed copies standard input to the child when it is not a file.
+	feed *feeder
+}
+
+// newChildFiles builds the descriptor table for a child from streams.
+// Closed descriptors and streams that are not files above 2 are left
+// closed in the child.
+func newChildFiles(streams stdio) (*childFiles, error) {
+	c := &childFiles{}
+	fds := streams.extra.Fds()
+	size := 3
+	if len(fds) > 0 && fds[len(fds)-1] >= size {
+		size = fds[len(fds)-1] + 1
+	}
+	c.files = make([]*os.File, size)
+
+	for fd, stream := range []any{streams.in, streams.out, unlocated(streams.err)} {
+		file, err := c.connect(fd, stream)
+		if err != nil {
+			c.closeChildEnds()
+			c.wait()
+			return nil, err
+		}
+		c.files[fd] = file
+	}
+	for _, fd := range fds {
+		if file, ok := streams.extra[fd].(*os.File); ok {
+			c.files[fd] = file
+		}
+	}
+	return c, nil
+}
+
+// connect returns the file the child should use for stream.
+func (c *childFiles) connect(fd int, stream any) (*os.File, error) {
+	switch s := stream.(type) {
+	case *os.File:
+		return s, nil
+	case redirect.Closed, nil:
+		return nil, nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	if fd == 0 {
+		in, ok := stream.(*input)
+		if !ok {
+			in = &input{r: stream.(io.Reader)}
+		}
+		c.feed = startFeeder(in, r, w)
+		return r, nil
+	}
+
+	c.childEnds = append(c.childEnds, w)
+	c.copies.Add(1)
+	go func() {
+		defer c.copies.Done()
+		io.Copy(stream.(io.Writer), r)
+		r.Close()
+	}()
+	return w, nil
+}
+
+func (c *childFiles) closeChildEnds() {
+	for _, f := range c.childEnds {
+		f.Close()
+	}
+	c.childEnds = nil
+}
+
+// wait stops feeding the child its input and waits until its output has
+// been copied. It must be called once the child has exited.
+func (c *childFiles) wait() {
+	if c.feed != nil {
+		c.feed.finish()
+	}
+	c.copies.Wait()
+}
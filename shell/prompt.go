@@ -0,0 +1,246 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// Default prompts, used when PS1 and PS2 are unset.
+const (
+	defaultPS1 = "$ "
+	defaultPS2 = "> "
+)
+
+// Markers for the start and end of a \[...\] section of a prompt, which
+// takes no room on the screen.
+const (
+	promptIgnoreStart = '\001'
+	promptIgnoreEnd   = '\002'
+)
+
+// prompt returns the value of the prompt variable name, or def if it is
+// unset, with its escapes decoded and then its parameter expansions and
+// command substitutions performed, as bash does. The result is split into
+// the text readline shows as the prompt, which may hold colour sequences
+// but no newline, and the text to print before it: any lines before the
+// last one and the terminal sequences other than colours in \[...\].
+func (sh *Shell) prompt(name, def string) (before, prompt string) {
+	ps, ok := sh.vars.Get(name)
+	if !ok {
+		ps = def
+	}
+
+	text := sh.decodePrompt(ps)
+	if word, err := parser.ParseText(text); err == nil {
+		status := sh.lastStatus
+		if expanded, err := sh.expander.Word(word); err == nil {
+			text = expanded
+		}
+		sh.lastStatus = status
+	}
+
+	var pre, line strings.Builder
+	ignoring := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == promptIgnoreStart:
+			ignoring = true
+		case c == promptIgnoreEnd:
+			ignoring = false
+		case c == '\n':
+			pre.WriteString(line.String())
+			pre.WriteByte('\n')
+			line.Reset()
+		case c == '\033' && ignoring:
+			// readline leaves colour sequences out of the prompt's
+			// width; anything else is printed ahead of the prompt.
+			end := colourEnd(text[i:])
+			if end > 0 {
+				line.WriteString(text[i : i+end])
+			} else {
+				end = ignoredEnd(text[i:])
+				pre.WriteString(text[i : i+end])
+			}
+			i += end - 1
+		case ignoring:
+			pre.WriteByte(c)
+		default:
+			line.WriteByte(c)
+		}
+	}
+	// readline cannot cope with a prompt ending in a bare escape.
+	return pre.String(), strings.TrimSuffix(line.String(), "\033")
+}
+
+// colourEnd returns the length of the SGR (colour) sequence at the start
+// of s, or 0 if s does not start with one.
+func colourEnd(s string) int {
+	if !strings.HasPrefix(s, "\033[") {
+		return 0
+	}
+	for i := 2; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == 'm':
+			return i + 1
+		case c != ';' && (c < '0' || c > '9'):
+			return 0
+		}
+	}
+	return 0
+}
+
+// ignoredEnd returns the length of the text at the start of s that runs
+// to the end of its \[...\] section.
+func ignoredEnd(s string) int {
+	if i := strings.IndexByte(s, promptIgnoreEnd); i >= 0 {
+		return i
+	}
+	return len(s)
+}
+
+// decodePrompt replaces the backslash escapes of bash prompts in ps. The
+// text substituted for them is escaped so that the expansion that follows
+// leaves it alone. \[ and \] are turned into the ignore markers.
+func (sh *Shell) decodePrompt(ps string) string {
+	var b strings.Builder
+	for i := 0; i < len(ps); i++ {
+		c := ps[i]
+		if c != '\\' || i+1 == len(ps) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch e := ps[i]; e {
+		case 'a':
+			b.WriteByte('\a')
+		case 'e':
+			b.WriteByte('\033')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case '[':
+			b.WriteByte(promptIgnoreStart)
+		case ']':
+			b.WriteByte(promptIgnoreEnd)
+		case '\\':
+			b.WriteString(`\\`)
+		case '$':
+			if os.Geteuid() == 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteString(`\$`)
+			}
+		case 'u':
+			b.WriteString(quotePromptText(sh.userName()))
+		case 'h', 'H':
+			host, _ := os.Hostname()
+			if i := strings.IndexByte(host, '.'); e == 'h' && i >= 0 {
+				host = host[:i]
+			}
+			b.WriteString(quotePromptText(host))
+		case 'w':
+			b.WriteString(quotePromptText(sh.tildeDir()))
+		case 'W':
+			dir := sh.tildeDir()
+			if dir != "~" && dir != "/" {
+				dir = filepath.Base(dir)
+			}
+			b.WriteString(quotePromptText(dir))
+		case 's':
+			b.WriteString(quotePromptText(filepath.Base(sh.Name)))
+		case 'j':
+			b.WriteString(strconv.Itoa(len(sh.jobs.list())))
+		case '?':
+			b.WriteString(strconv.Itoa(sh.lastStatus))
+		case '!':
+			b.WriteString(strconv.Itoa(sh.history.Number(sh.history.Len())))
+		case 't':
+			b.WriteString(time.Now().Format("15:04:05"))
+		case 'T':
+			b.WriteString(time.Now().Format("03:04:05"))
+		case '@':
+			b.WriteString(time.Now().Format("03:04 PM"))
+		case 'A':
+			b.WriteString(time.Now().Format("15:04"))
+		case 'd':
+			b.WriteString(time.Now().Format("Mon Jan 02"))
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i + 1
+			for end < len(ps) && end < i+3 && ps[end] >= '0' && ps[end] <= '7' {
+				end++
+			}
+			n, _ := strconv.ParseUint(ps[i:end], 8, 8)
+			b.WriteString(quotePromptText(string([]byte{byte(n)})))
+			i = end - 1
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(e)
+		}
+	}
+	return b.String()
+}
+
+// quotePromptText escapes the characters that expansion of a prompt would
+// otherwise act on.
+func quotePromptText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '$' || r == '`' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// userName returns the name of the user running the shell.
+func (sh *Shell) userName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	name, _ := sh.vars.Get("USER")
+	return name
+}
+
+// tildeDir returns the working directory with the home directory replaced
+// by "~".
+func (sh *Shell) tildeDir() string {
+	home, _ := sh.vars.Get("HOME")
+	home = strings.TrimSuffix(home, "/")
+	switch {
+	case home == "":
+	case sh.dir == home:
+		return "~"
+	case strings.HasPrefix(sh.dir, home+"/"):
+		return "~" + sh.dir[len(home):]
+	}
+	return sh.dir
+}
+
+// runPromptCommand runs PROMPT_COMMAND, if set, before the primary prompt
+// is shown. It leaves $? as the last command set it.
+func (sh *Shell) runPromptCommand(streams stdio) {
+	src, _ := sh.vars.Get("PROMPT_COMMAND")
+	if strings.TrimSpace(src) == "" {
+		return
+	}
+	list, err := sh.parse(src)
+	if err != nil {
+		fmt.Fprintf(streams.err, "PROMPT_COMMAND: %v\n", err)
+		return
+	}
+	status := sh.lastStatus
+	sh.runTopLevel(list, streams)
+	if !sh.exited {
+		sh.lastStatus = status
+	}
+}
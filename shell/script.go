@@ -0,0 +1,130 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// Run runs the commands in src, as "myshell -c src" would, and returns the
+// status of the last command run. A syntax error stops src with status 2
+// and is returned together with its line number. Cancelling ctx
+// interrupts the commands being run and makes Run return ctx.Err(). Once
+// the exit builtin has run, Run does nothing and returns the exit status.
+func (sh *Shell) Run(ctx context.Context, src string) (int, error) {
+	return sh.RunReader(ctx, strings.NewReader(src))
+}
+
+// RunReader is like Run but reads the commands from r as they are needed,
+// as when running a script. Commands can therefore consume the input that
+// follows them.
+func (sh *Shell) RunReader(ctx context.Context, r io.Reader) (int, error) {
+	if err := sh.init(); err != nil {
+		return 1, err
+	}
+	if sh.exited {
+		return sh.lastStatus, nil
+	}
+
+	sh.ctx = ctx
+	sh.interrupted.Store(false)
+	stop := context.AfterFunc(ctx, func() { sh.interrupted.Store(true) })
+	defer func() {
+		stop()
+		sh.ctx = context.Background()
+	}()
+
+	status, err := sh.runScript(r, sh.stdio())
+	if err == nil {
+		err = ctx.Err()
+	}
+	return status, err
+}
+
+// Exited reports whether the exit builtin has ended the shell.
+func (sh *Shell) Exited() bool {
+	return sh.exited
+}
+
+// runScript reads commands from r and runs each one as soon as it has been
+// read completely, so a command spanning several lines, such as one with a
+// here-document, is read in full first. It returns the status of the last
+// command; a syntax error ends the script with status 2 and is returned
+// with its line number.
+func (sh *Shell) runScript(r io.Reader, streams stdio) (int, error) {
+	return sh.readCommands(r, func(list *parser.List) {
+		sh.runTopLevel(list, streams)
+	})
+}
+
+// readCommands reads the commands in r as runScript does and passes each
+// one to run. It stops early once the shell has exited or a command has
+// been interrupted or run return.
+func (sh *Shell) readCommands(r io.Reader, run func(*parser.List)) (int, error) {
+	var src strings.Builder
+	line, start := 0, 1
+
+	for {
+		text, readErr := readLine(r)
+		if text == "" && readErr != nil {
+			if src.Len() == 0 {
+				return sh.lastStatus, nil
+			}
+			// The input ended in the middle of a command.
+			_, err := sh.parse(src.String())
+			return 2, syntaxError(err, start)
+		}
+		line++
+		src.WriteString(text)
+
+		list, err := sh.parse(src.String())
+		if parser.IsIncomplete(err) && readErr == nil {
+			continue
+		}
+		if err != nil {
+			return 2, syntaxError(err, start)
+		}
+
+		sh.source.start = start
+		run(list)
+		if readErr != nil || sh.exited || sh.returning || sh.interrupted.Load() {
+			return sh.lastStatus, nil
+		}
+		src.Reset()
+		start = line + 1
+	}
+}
+
+// syntaxError adds the line number to a syntax error in a script; start is
+// the line on which the failing command began.
+func syntaxError(err error, start int) error {
+	var syntaxErr *parser.Error
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("line %d: %w", start+syntaxErr.Pos.Line-1, err)
+	}
+	return err
+}
+
+// readLine reads up to and including the next newline. It reads a byte at
+// a time so that the input after the line is left to the commands run
+// from it.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			line = append(line, buf[0])
+			if buf[0] == '\n' {
+				return string(line), nil
+			}
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
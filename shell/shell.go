@@ -0,0 +1,362 @@
+// Package shell implements the myshell command interpreter in a form that
+// Go programs can embed.
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/completer"
+	"github.com/codecrafters-io/shell-starter-go/internal/expand"
+	"github.com/codecrafters-io/shell-starter-go/internal/history"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/pathcache"
+	"github.com/codecrafters-io/shell-starter-go/internal/vars"
+)
+
+// Shell is a shell interpreter. The exported fields configure it and are
+// read when it first runs commands; later changes to its variables, its
+// working directory or its positional parameters are kept inside the
+// Shell, so that successive calls to Run share one environment. The zero
+// value is ready to use. A Shell must not be used concurrently.
+type Shell struct {
+	// Stdin, Stdout and Stderr are the standard streams of the commands
+	// run. If any of them is nil the null device is used instead. Input
+	// that a command does not read from Stdin is left for the commands
+	// after it.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Env holds the initial variables in "key=value" form, all of them
+	// exported. If Env is nil the process environment is used.
+	Env []string
+	// Dir is the initial working directory. If Dir is empty the process's
+	// working directory is used. The cd builtin changes the directory of
+	// the Shell only, never that of the process.
+	Dir string
+	// Name is $0 and Args holds the initial positional parameters.
+	Name string
+	Args []string
+
+	vars *vars.Store
+	// dir is the current working directory.
+	dir        string
+	params     []string
+	lastStatus int
+	// substStatus is the status of the last command substitution, which
+	// becomes the status of a command consisting only of assignments.
+	substStatus int
+	expander    *expand.Expander
+	// noclobber stops ">" from truncating existing files (set -C).
+	noclobber bool
+	// histExpand enables history expansion of interactive input (set -H).
+	histExpand bool
+	// exited is set once the exit builtin has ended the shell.
+	exited bool
+	// interactive is set in the shell run by Interact, but not in its
+	// subshells.
+	interactive bool
+	// ctx is the context of the current call to Run; cancelling it
+	// interrupts the commands being run.
+	ctx context.Context
+	// devNull stands in for nil standard streams.
+	devNull *os.File
+	// stdin is Stdin when it is not a file, and stdout and stderr are
+	// Stdout and Stderr made safe for concurrent use when they are not;
+	// all are shared with subshells.
+	stdin          *input
+	stdout, stderr io.Writer
+
+	jobs *jobTable
+	// job is the job a subshell's commands belong to. It is nil in the
+	// main shell, where each pipeline becomes a job of its own.
+	job *job
+	// terminal is the controlling terminal's descriptor when job control
+	// is enabled, and -1 otherwise; pgid is then the shell's process group.
+	terminal int
+	pgid     int
+	// lastBackground is the ID of the last background job ($!).
+	lastBackground int
+	// breaking and continuing count the loops a pending break or continue
+	// has yet to leave; loopDepth is the number of loops being run.
+	breaking, continuing, loopDepth int
+
+	// funcs holds the defined functions by name.
+	funcs map[string]*parser.FuncDef
+	// aliases holds the value of each alias by name.
+	aliases map[string]string
+	// funcDepth is the number of function calls being run and sourceDepth
+	// the number of files being sourced. returning is set by the return
+	// builtin until the function call or sourced file ends with
+	// returnStatus.
+	funcDepth    int
+	sourceDepth  int
+	returning    bool
+	returnStatus int
+	// source is the file being run by the source builtin or as a startup
+	// file, if any, whose commands report errors with its name and their
+	// line.
+	source sourceFile
+	// history holds the commands entered interactively; historyChanged is
+	// set when the history builtin changes it other than by adding to it.
+	history        *history.History
+	historyChanged bool
+	// hash is the command hash table, shared with subshells and the
+	// completer.
+	hash *pathcache.Cache
+	// completer does tab completion and holds the specs set up by the
+	// complete builtin.
+	completer *completer.Completer
+	// interrupted is set once Ctrl-C has reached the shell or killed a
+	// foreground job, and is shared with subshells; command lists stop
+	// running until the main loop clears it for the next line.
+	interrupted *atomic.Bool
+}
+
+// init sets up the shell's state from its exported fields the first time
+// it runs commands.
+func (sh *Shell) init() error {
+	if sh.vars != nil {
+		return nil
+	}
+
+	env := sh.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	dir := sh.Dir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		dir = wd
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", dir)
+	}
+
+	sh.devNull, err = os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if _, ok := sh.Stdin.(*os.File); !ok && sh.Stdin != nil {
+		sh.stdin = &input{r: sh.Stdin}
+	}
+	writes := &sync.Mutex{}
+	if _, ok := sh.Stdout.(*os.File); !ok && sh.Stdout != nil {
+		sh.stdout = syncWriter{writes, sh.Stdout}
+	}
+	if _, ok := sh.Stderr.(*os.File); !ok && sh.Stderr != nil {
+		sh.stderr = syncWriter{writes, sh.Stderr}
+	}
+	sh.vars = vars.FromEnviron(env)
+	sh.params = sh.Args
+	sh.jobs = &jobTable{}
+	sh.funcs = make(map[string]*parser.FuncDef)
+	sh.aliases = make(map[string]string)
+	sh.history = history.New(defaultHistSize)
+	sh.hash = pathcache.New()
+	sh.completer = sh.newCompleter()
+	sh.terminal = -1
+	sh.interrupted = &atomic.Bool{}
+	sh.ctx = context.Background()
+	sh.expander = &expand.Expander{Env: sh, CmdSubst: sh.commandSubstitution, Positional: sh.positional, Array: sh.array}
+	sh.setDir(dir)
+	return nil
+}
+
+// setDir makes dir, an absolute path, the working directory and records
+// it in PWD.
+func (sh *Shell) setDir(dir string) {
+	sh.dir = dir
+	sh.expander.Glob.Dir = dir
+	sh.vars.Set("PWD", dir)
+}
+
+// stdio returns the shell's standard streams.
+func (sh *Shell) stdio() stdio {
+	s := stdio{in: sh.Stdin, out: sh.Stdout, err: sh.Stderr}
+	if sh.stdin != nil {
+		s.in = sh.stdin
+	}
+	if sh.stdout != nil {
+		s.out = sh.stdout
+	}
+	if sh.stderr != nil {
+		s.err = sh.stderr
+	}
+	if s.in == nil {
+		s.in = sh.devNull
+	}
+	if s.out == nil {
+		s.out = sh.devNull
+	}
+	if s.err == nil {
+		s.err = sh.devNull
+	}
+	return s
+}
+
+// subshell returns a copy of sh with its own variables.
+func (sh *Shell) subshell() *Shell {
+	sub := &Shell{
+		Stdin:          sh.Stdin,
+		Stdout:         sh.Stdout,
+		Stderr:         sh.Stderr,
+		Name:           sh.Name,
+		vars:           sh.vars.Clone(),
+		dir:            sh.dir,
+		params:         sh.params,
+		lastStatus:     sh.lastStatus,
+		noclobber:      sh.noclobber,
+		histExpand:     sh.histExpand,
+		ctx:            sh.ctx,
+		devNull:        sh.devNull,
+		stdin:          sh.stdin,
+		stdout:         sh.stdout,
+		stderr:         sh.stderr,
+		jobs:           sh.jobs,
+		job:            sh.job,
+		terminal:       sh.terminal,
+		pgid:           sh.pgid,
+		lastBackground: sh.lastBackground,
+		interrupted:    sh.interrupted,
+		loopDepth:      sh.loopDepth,
+		funcs:          make(map[string]*parser.FuncDef, len(sh.funcs)),
+		aliases:        make(map[string]string, len(sh.aliases)),
+		funcDepth:      sh.funcDepth,
+		sourceDepth:    sh.sourceDepth,
+		source:         sh.source,
+		history:        sh.history,
+		hash:           sh.hash,
+	}
+	for name, fn := range sh.funcs {
+		sub.funcs[name] = fn
+	}
+	for name, value := range sh.aliases {
+		sub.aliases[name] = value
+	}
+	sub.completer = sub.newCompleter()
+	for _, name := range sh.completer.SpecNames() {
+		spec, _ := sh.completer.LookupSpec(name)
+		sub.completer.SetSpec(name, spec)
+	}
+	sub.expander = &expand.Expander{
+		Env:        sub,
+		CmdSubst:   sub.commandSubstitution,
+		Positional: sub.positional,
+		Array:      sub.array,
+		Glob:       sh.expander.Glob,
+	}
+	return sub
+}
+
+// Get returns the value of a shell variable or special parameter. It
+// implements expand.Env.
+func (sh *Shell) Get(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(sh.lastStatus), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "!":
+		if sh.lastBackground == 0 {
+			return "", false
+		}
+		return strconv.Itoa(sh.lastBackground), true
+	case "0":
+		return sh.Name, true
+	case "#":
+		return strconv.Itoa(len(sh.params)), true
+	case "@":
+		return strings.Join(sh.params, " "), true
+	case "*":
+		sep := " "
+		if ifs, ok := sh.vars.Get("IFS"); ok {
+			sep = ifs[:min(1, len(ifs))]
+		}
+		return strings.Join(sh.params, sep), true
+	}
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		if n > len(sh.params) {
+			return "", false
+		}
+		return sh.params[n-1], true
+	}
+	return sh.vars.Get(name)
+}
+
+// positional returns the positional parameters. It implements
+// expand.Expander.Positional.
+func (sh *Shell) positional() []string {
+	return sh.params
+}
+
+// array returns the elements of an array variable. It implements
+// expand.Expander.Array.
+func (sh *Shell) array(name string) ([]string, bool) {
+	return sh.vars.Array(name)
+}
+
+// Set assigns a shell variable. It implements expand.Env.
+func (sh *Shell) Set(name, value string) error {
+	return sh.vars.Set(name, value)
+}
+
+// errNotFound is returned by lookPath when no executable matches.
+var errNotFound = errors.New("command not found")
+
+// lookPath resolves a command name to an executable in the directories of
+// pathEnv through the command hash table, which remembers it. Names
+// containing a slash are used as they are. Relative paths are taken
+// relative to the working directory.
+func (sh *Shell) lookPath(name, pathEnv string) (string, error) {
+	if strings.Contains(name, "/") {
+		if isExecutable(absPath(sh.dir, name)) {
+			return name, nil
+		}
+		return "", errNotFound
+	}
+
+	if path, ok := sh.hash.Lookup(name, pathEnv, sh.dir); ok {
+		return path, nil
+	}
+	return "", errNotFound
+}
+
+// hashTable returns the command hash table, first forgetting the commands
+// found with a PATH other than the current one.
+func (sh *Shell) hashTable() *pathcache.Cache {
+	pathEnv, _ := sh.vars.Get("PATH")
+	sh.hash.SetPath(pathEnv)
+	return sh.hash
+}
+
+// absPath returns path made absolute relative to dir.
+func absPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// isExecutable reports whether path is a regular file with an execute bit.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
@@ -0,0 +1,569 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestShell returns a shell writing to the returned buffers, with a
+// minimal environment and a temporary working directory.
+func newTestShell(t *testing.T) (*Shell, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	sh := &Shell{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Env:    []string{"PATH=" + os.Getenv("PATH"), "HOME=/home/test"},
+		Dir:    t.TempDir(),
+		Name:   "myshell",
+	}
+	return sh, &stdout, &stderr
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		stdout string
+		status int
+	}{
+		{name: "echo", src: "echo hello world", stdout: "hello world\n"},
+		{name: "status", src: "false", status: 1},
+		{name: "variables", src: "x=1\necho $x $HOME", stdout: "1 /home/test\n"},
+		{name: "arrays", src: "a=(x 'y z'\n  w); echo ${#a[@]} \"${a[1]}\" $a; for e in \"${a[@]}\"; do echo \"[$e]\"; done", stdout: "3 y z x\n[x]\n[y z]\n[w]\n"},
+		{name: "array assignment replaces", src: "a=(x y); a=(z); echo \"${a[*]}\"; a=q; set | grep '^a='", stdout: "z\na=(q)\n"},
+		{name: "assignments in order", src: "x=1 y=$x; echo \"$y\"", stdout: "1\n"},
+		{name: "assignment status", src: "x=$(exit 3) y=$x; echo $?", stdout: "3\n"},
+		{name: "pipeline", src: "echo abc | tr a-z A-Z", stdout: "ABC\n"},
+		{name: "function", src: "f() { echo \"$# $1\"; return 3; }; f a b", stdout: "2 a\n", status: 3},
+		{name: "exit stops the script", src: "echo a; exit 4; echo b", stdout: "a\n", status: 4},
+		{name: "exit in subshell", src: "(exit 5); echo $?", stdout: "5\n"},
+		{name: "command substitution", src: "echo $(echo inner)", stdout: "inner\n"},
+		{name: "compgen word list", src: `x="stop status"; compgen -W '$x start' -- sta`, stdout: "status\nstart\n"},
+		{name: "compgen no match", src: "compgen -W 'a b' c", status: 1},
+		{name: "compgen function", src: "_f() { COMPREPLY=\"$1:$2\"; }; compgen -F _f x", stdout: ":x\n"},
+		{name: "compgen function matches", src: "_f() { COMPREPLY=(\"${2}1\" \"${2} 2\"); }; compgen -F _f x", stdout: "x1\nx 2\n"},
+		{name: "compgen function bash style", src: "_f() { local cur=${COMP_WORDS[COMP_CWORD]}; COMPREPLY=( $(compgen -W 'start stop status' -- \"$cur\") ); }; compgen -F _f sta", stdout: "start\nstatus\n"},
+		{name: "compgen function exits", src: "_f() { COMPREPLY=x; exit 3; }; compgen -F _f y; echo after", stdout: "x\nafter\n"},
+		{name: "complete print", src: "complete -o nospace -W 'a b' foo; complete -d cd; complete -p", stdout: "complete -d cd\ncomplete -o nospace -W 'a b' foo\n"},
+		{name: "background job ID", src: ": & : & echo $!; wait $!", stdout: "4194306\n"},
+		{name: "kill builtin job", src: "while :; do :; done & kill $!; wait $!; echo $?", stdout: "143\n"},
+		{name: "kill job spec", src: "sleep 5 & kill -s KILL %1; wait %1; echo $?", stdout: "137\n"},
+		{name: "kill process", src: "kill -0 $$ && kill -n 0 -- $$; echo $?", stdout: "0\n"},
+		{name: "kill -l", src: "kill -l 143 TERM", stdout: "TERM\n15\n"},
+		{name: "kill bad argument", src: "kill x", status: 1},
+		{name: "kill bad signal", src: "kill -NOPE 1", status: 1},
+		{name: "hash", src: "hash; hash -p /bin/echo e; hash -t e; hash -l; hash -r; hash", stdout: "hash: hash table empty\n/bin/echo\nhash -p /bin/echo e\nhash: hash table empty\n"},
+		{name: "hash -l reusable", src: "hash -p /bin/echo e; hash -l > h; hash -r; . ./h; hash -t e", stdout: "/bin/echo\n"},
+		{name: "hash remembers commands", src: "ls >/dev/null; ls >/dev/null; hash | grep -c '^   2\t.*/ls$'", stdout: "1\n"},
+		{name: "hash missing command", src: "hash nope", status: 1},
+		{name: "type hashed", src: "hash -p /bin/echo e; type e", stdout: "e is hashed (/bin/echo)\n"},
+		{name: "complete remove", src: "complete -d cd; complete -r cd; complete -p cd", status: 1},
+		{name: "alias", src: "alias say='echo said'\nsay hi", stdout: "said hi\n"},
+		{name: "alias on same line", src: "alias say='echo said'; say hi", status: 127},
+		{name: "alias list", src: "alias b='x y' a=\"it's\"; alias; alias b", stdout: "alias a='it'\\''s'\nalias b='x y'\nalias b='x y'\n"},
+		{name: "alias missing", src: "alias nope", status: 1},
+		{name: "alias invalid name", src: "alias a/b=c", status: 1},
+		{name: "alias recursive", src: "alias tr='tr a-z'\necho abc | tr A-Z", stdout: "ABC\n"},
+		{name: "alias trailing space", src: "alias e='echo ' say=said\ne say hi; e e", stdout: "said hi\necho\n"},
+		{name: "alias in function", src: "alias say='echo said'\nf() { say hi; }\nunalias say\nf", stdout: "said hi\n"},
+		{name: "unalias", src: "alias say='echo said'\nunalias say\nsay hi", status: 127},
+		{name: "unalias all", src: "alias a=b c=d; unalias -a; alias", stdout: ""},
+		{name: "unalias missing", src: "unalias nope", status: 1},
+		{name: "type alias", src: "alias ll='ls -la'; type ll", stdout: "ll is aliased to `ls -la'\n"},
+		{name: "compgen alias", src: "alias ll=ls la=ls; compgen -a l", stdout: "la\nll\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, stderr := newTestShell(t)
+			status, err := sh.Run(context.Background(), tt.src)
+			if err != nil {
+				t.Fatalf("Run(%q) error: %v", tt.src, err)
+			}
+			if status != tt.status || stdout.String() != tt.stdout {
+				t.Errorf("Run(%q) = %d, %q, want %d, %q (stderr %q)", tt.src, status, stdout, tt.status, tt.stdout, stderr)
+			}
+		})
+	}
+}
+
+func TestRunKeepsState(t *testing.T) {
+	sh, stdout, _ := newTestShell(t)
+	ctx := context.Background()
+	for _, src := range []string{"x=kept", "g() { echo $x; }", "g"} {
+		if _, err := sh.Run(ctx, src); err != nil {
+			t.Fatalf("Run(%q) error: %v", src, err)
+		}
+	}
+	if stdout.String() != "kept\n" {
+		t.Errorf("output = %q, want %q", stdout, "kept\n")
+	}
+
+	sh.Run(ctx, "exit 7")
+	if !sh.Exited() {
+		t.Error("Exited() = false after exit")
+	}
+	if status, _ := sh.Run(ctx, "echo more"); status != 7 || stdout.String() != "kept\n" {
+		t.Errorf("Run after exit = %d, output %q; want 7 and nothing run", status, stdout)
+	}
+}
+
+func TestRunDir(t *testing.T) {
+	sh, stdout, _ := newTestShell(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(sh.Dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	src := "cd sub && pwd && echo hi > f && ls && echo $PWD\n/bin/pwd"
+	if _, err := sh.Run(context.Background(), src); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(sh.Dir, "sub")
+	want := sub + "\nf\n" + sub + "\n" + sub + "\n"
+	if stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout, want)
+	}
+	if _, err := os.Stat(filepath.Join(sub, "f")); err != nil {
+		t.Errorf("redirection did not use the shell's directory: %v", err)
+	}
+	if now, _ := os.Getwd(); now != wd {
+		t.Errorf("process directory changed from %s to %s", wd, now)
+	}
+}
+
+func TestRunDirGlob(t *testing.T) {
+	sh, stdout, stderr := newTestShell(t)
+	for name, data := range map[string]string{"a.txt": "", "sub/b.txt": "b\n", "sub/c.txt": ""} {
+		path := filepath.Join(sh.Dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Patterns and redirections follow cd although the process's working
+	// directory stays where it was.
+	src := "echo *\ncd sub\necho *.txt ../*.txt\ncat < b.txt >> c.txt\ncat c.txt"
+	if _, err := sh.Run(context.Background(), src); err != nil {
+		t.Fatal(err)
+	}
+	want := "a.txt sub\nb.txt c.txt ../a.txt\nb\n"
+	if stdout.String() != want {
+		t.Errorf("output = %q, want %q (stderr %q)", stdout, want, stderr)
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	sh, stdout, _ := newTestShell(t)
+	sh.Stdin = strings.NewReader("line\n")
+	if _, err := sh.Run(context.Background(), "cat"); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "line\n" {
+		t.Errorf("output = %q, want %q", stdout, "line\n")
+	}
+}
+
+func TestRunStdinLeftUnread(t *testing.T) {
+	// A command only uses up the input it reads; the rest is left to the
+	// commands after it, in this call to Run or the next.
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "not read", src: "/bin/true; cat", want: "one\ntwo\n"},
+		{name: "partly read", src: "head -c 4 >/dev/null; cat", want: "two\n"},
+		{name: "pipeline", src: "/bin/true | /bin/true; cat", want: "one\ntwo\n"},
+		{name: "next call", src: "/bin/true", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, _ := newTestShell(t)
+			sh.Stdin = strings.NewReader("one\ntwo\n")
+			if _, err := sh.Run(context.Background(), tt.src); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("Run(%q) output = %q, want %q", tt.src, stdout, tt.want)
+			}
+			if tt.want != "" {
+				return
+			}
+			if _, err := sh.Run(context.Background(), "cat"); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != "one\ntwo\n" {
+				t.Errorf("next Run output = %q, want %q", stdout, "one\ntwo\n")
+			}
+		})
+	}
+}
+
+func TestRunExpansionErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		src         string
+		interactive bool
+		stdout      string
+		stderr      string
+		status      int
+		exited      bool
+	}{
+		{name: "error if unset exits", src: "echo \"${x:?oops}\"; echo after", stderr: "x: oops\n", status: 1, exited: true},
+		{name: "error in assignment exits", src: "y=${x:?}; echo after", stderr: "x: parameter null or not set\n", status: 1, exited: true},
+		{name: "error in function exits", src: "f() { : ${x:?}; echo no; }; f; echo after", stderr: "x: parameter null or not set\n", status: 1, exited: true},
+		{name: "error in redirection exits", src: "echo hi >${x:?}; echo after", stderr: "x: parameter null or not set\n", status: 1, exited: true},
+		{name: "error in subshell exits subshell", src: "(echo ${x:?}; echo no); echo after $?", stdout: "after 1\n", stderr: "x: parameter null or not set\n"},
+		{name: "error if unset when set", src: "x=1; echo ${x:?oops}; echo after", stdout: "1\nafter\n"},
+		{name: "interactive goes on", src: "echo ${x:?oops}; echo after $?", interactive: true, stdout: "after 1\n", stderr: "x: oops\n"},
+		{name: "assign default", src: ": ${x:=v}; echo $x", stdout: "v\n"},
+		{name: "assign positional", src: "echo ${1:=x}; echo after $? \"[$1]\"", stdout: "after 1 []\n", stderr: "$1: cannot assign in this way\n"},
+		{name: "assign special", src: "echo ${?:=x}; echo after", stdout: "0\nafter\n"},
+		{name: "assign set positional", src: "set -- a; echo ${1:=x}", stdout: "a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, stderr := newTestShell(t)
+			sh.interactive = tt.interactive
+			status, err := sh.Run(context.Background(), tt.src)
+			if err != nil {
+				t.Fatalf("Run(%q) error: %v", tt.src, err)
+			}
+			if status != tt.status || stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Errorf("Run(%q) = %d, %q, %q; want %d, %q, %q", tt.src, status, stdout, stderr, tt.status, tt.stdout, tt.stderr)
+			}
+			if sh.Exited() != tt.exited {
+				t.Errorf("Exited() = %v, want %v", sh.Exited(), tt.exited)
+			}
+		})
+	}
+}
+
+func TestRunRedirectErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		stdout string
+		stderr string
+	}{
+		{name: "echo to closed stdout", src: "echo hi >&-; echo $?", stdout: "1\n", stderr: "echo: write error: bad file descriptor\n"},
+		{name: "pwd to closed stdout", src: "pwd >&-; echo $?", stdout: "1\n", stderr: "pwd: write error: bad file descriptor\n"},
+		{name: "output to empty name", src: "echo hi > \"\"; echo $?", stdout: "1\n", stderr: ": no such file or directory\n"},
+		{name: "input from empty name", src: "cat < ''; echo $?", stdout: "1\n", stderr: ": no such file or directory\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, stderr := newTestShell(t)
+			if _, err := sh.Run(context.Background(), tt.src); err != nil {
+				t.Fatalf("Run(%q) error: %v", tt.src, err)
+			}
+			if stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Errorf("Run(%q) = %q, %q; want %q, %q", tt.src, stdout, stderr, tt.stdout, tt.stderr)
+			}
+		})
+	}
+}
+
+func TestRunSyntaxError(t *testing.T) {
+	sh, stdout, _ := newTestShell(t)
+	status, err := sh.Run(context.Background(), "echo a\necho b |")
+	if status != 2 || err == nil || err.Error() != "line 2: syntax error: unexpected end of file" {
+		t.Errorf("Run = %d, %v; want 2 and a syntax error on line 2", status, err)
+	}
+	if stdout.String() != "a\n" {
+		t.Errorf("output = %q, want the first line to have run", stdout)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	sh, _, _ := newTestShell(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := sh.Run(ctx, "sleep 10; echo not reached")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run took %v after cancellation", elapsed)
+	}
+
+	// A new context runs commands again.
+	if status, err := sh.Run(context.Background(), "true"); status != 0 || err != nil {
+		t.Errorf("Run after cancellation = %d, %v", status, err)
+	}
+}
+
+func TestCompletionFunction(t *testing.T) {
+	sh, _, _ := newTestShell(t)
+	src := `_svc() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+	COMPREPLY=( $(compgen -W "$prev-start $prev-stop" -- "$cur") )
+}
+complete -F _svc svc
+_quit() { exit 3; }
+complete -F _quit quit`
+	if status, err := sh.Run(context.Background(), src); status != 0 || err != nil {
+		t.Fatalf("Run = %d, %v", status, err)
+	}
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{line: "svc web web-sta", expected: "rt "},
+		{line: "svc db db-sto", expected: "p "},
+		{line: "quit ", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			line := []rune(tt.line)
+			newLine, _ := sh.completer.Do(line, len(line))
+			var got string
+			if len(newLine) == 1 {
+				got = string(newLine[0])
+			}
+			if got != tt.expected {
+				t.Errorf("Do(%q) = %q, want %q", tt.line, got, tt.expected)
+			}
+		})
+	}
+	if status, err := sh.Run(context.Background(), "echo still running"); status != 0 || err != nil {
+		t.Errorf("Run after completion = %d, %v", status, err)
+	}
+}
+
+func TestRunCancelWait(t *testing.T) {
+	sh, _, _ := newTestShell(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := sh.Run(ctx, "sleep 3 & wait; echo not reached"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Run took %v after cancellation", elapsed)
+	}
+	sh.Run(context.Background(), "kill %1")
+}
+
+func TestRunCancelLeavesBackgroundJobs(t *testing.T) {
+	sh, stdout, _ := newTestShell(t)
+	if _, err := sh.Run(context.Background(), "for i in a b c; do sleep 0.2; echo $i; done &"); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := sh.Run(ctx, "sleep 10"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// Let the loop reach its next iteration before another Run starts.
+	time.Sleep(300 * time.Millisecond)
+
+	status, err := sh.Run(context.Background(), "wait %1")
+	if status != 0 || err != nil || stdout.String() != "a\nb\nc\n" {
+		t.Errorf("background job after cancellation = %d, %v, %q; want 0, <nil>, %q", status, err, stdout, "a\nb\nc\n")
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	sh, _, _ := newTestShell(t)
+	dir := filepath.Join(sh.Dir, "a$b")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	sh.Dir = dir
+	if _, err := sh.Run(context.Background(), "x=val; false"); err != nil {
+		t.Fatal(err)
+	}
+	dollar := "$"
+	if os.Geteuid() == 0 {
+		dollar = "#"
+	}
+
+	tests := []struct {
+		name   string
+		ps1    string
+		before string
+		prompt string
+	}{
+		{name: "plain", ps1: "> ", prompt: "> "},
+		{name: "escapes", ps1: `\W \? \j \$ `, prompt: "a$b 1 0 " + dollar + " "},
+		{name: "home", ps1: `\w`, prompt: dir},
+		{name: "expansion", ps1: `$x \\ \101 $(echo sub)`, prompt: `val \ A sub`},
+		{name: "colour", ps1: `\[\e[1;32m\]ok\[\e[0m\] `, prompt: "\033[1;32mok\033[0m "},
+		{name: "title", ps1: `\[\e]0;title\a\]$ `, before: "\033]0;title\a", prompt: "$ "},
+		{name: "multiline", ps1: `top\n> `, before: "top\n", prompt: "> "},
+		{name: "unknown escape", ps1: `\q`, prompt: `\q`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh.vars.Set("PS1", tt.ps1)
+			before, prompt := sh.prompt("PS1", defaultPS1)
+			if before != tt.before || prompt != tt.prompt {
+				t.Errorf("prompt(%q) = %q, %q; want %q, %q", tt.ps1, before, prompt, tt.before, tt.prompt)
+			}
+			if sh.lastStatus != 1 {
+				t.Errorf("prompt changed $? to %d", sh.lastStatus)
+			}
+		})
+	}
+
+	sh.vars.Unset("PS2")
+	if _, prompt := sh.prompt("PS2", defaultPS2); prompt != "> " {
+		t.Errorf("default PS2 = %q", prompt)
+	}
+}
+
+func TestPromptCommand(t *testing.T) {
+	sh, stdout, _ := newTestShell(t)
+	if _, err := sh.Run(context.Background(), "PROMPT_COMMAND='echo hook; false'; (exit 3)"); err != nil {
+		t.Fatal(err)
+	}
+	sh.runPromptCommand(sh.stdio())
+	if stdout.String() != "hook\n" || sh.lastStatus != 3 {
+		t.Errorf("runPromptCommand printed %q and left $? = %d, want hook and 3", stdout.String(), sh.lastStatus)
+	}
+}
+
+func TestRunStartupFiles(t *testing.T) {
+	home := t.TempDir()
+	files := map[string]string{
+		"profile":    "echo system",
+		".profile":   "echo profile",
+		".myshellrc": "echo rc\nif then\necho unreachable",
+		"custom":     "echo custom",
+		"posix":      "echo posix",
+		"exiting":    "exit 4\necho unreachable",
+		"returning":  "echo before\nreturn\necho after",
+		"failing":    "nosuchcmd\nf() {\n  cd /nonexistent\n}\necho raw >&2; f\nsh -c 'echo child >&2'",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(home, name), []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	systemProfile = filepath.Join(home, "profile")
+	defer func() { systemProfile = "/etc/profile" }()
+
+	tests := []struct {
+		name   string
+		opts   Startup
+		stdout string
+		stderr string
+	}{
+		{name: "login", opts: Startup{Login: true}, stdout: "system\nprofile\n"},
+		{name: "interactive", opts: Startup{Interactive: true}, stdout: "rc\n", stderr: ".myshellrc: line 2: syntax error near unexpected token `then'\n"},
+		{name: "interactive login", opts: Startup{Login: true, Interactive: true, RCFile: "custom"}, stdout: "system\nprofile\ncustom\n"},
+		{name: "no profile", opts: Startup{Login: true, NoProfile: true}},
+		{name: "no rc", opts: Startup{Interactive: true, NoRC: true}},
+		{name: "posix", opts: Startup{Interactive: true, POSIX: true}, stdout: "posix\n"},
+		{name: "missing rc file", opts: Startup{Interactive: true, RCFile: "missing"}},
+		{name: "exit", opts: Startup{Interactive: true, RCFile: "exiting"}},
+		{name: "return", opts: Startup{Login: true, Interactive: true, RCFile: "returning"}, stdout: "system\nprofile\nbefore\n"},
+		{
+			name: "runtime errors",
+			opts: Startup{Interactive: true, RCFile: "failing"},
+			stderr: "failing: line 1: nosuchcmd: command not found\n" +
+				"raw\nfailing: line 5: cd: /nonexistent: No such file or directory\nchild\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, stderr := newTestShell(t)
+			sh.Dir = home
+			sh.Env = []string{"HOME=" + home, "ENV=$HOME/posix", "PATH=" + os.Getenv("PATH")}
+			sh.RunStartupFiles(context.Background(), tt.opts)
+			gotErr := strings.ReplaceAll(stderr.String(), home+"/", "")
+			if stdout.String() != tt.stdout || gotErr != tt.stderr {
+				t.Errorf("stdout %q, stderr %q; want %q, %q", stdout.String(), gotErr, tt.stdout, tt.stderr)
+			}
+			if tt.name == "exit" && (!sh.Exited() || sh.lastStatus != 4) {
+				t.Errorf("exit in a startup file left exited=%v, status %d", sh.Exited(), sh.lastStatus)
+			}
+		})
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"env.sh":        "x=1\nf() { echo f; }\ncd sub",
+		"args.sh":       "echo \"$# $*\"",
+		"return.sh":     "echo a\nreturn 3\necho b",
+		"bad.sh":        "echo a\nif then",
+		"errors.sh":     "echo a\n\nfor d in /nonexistent; do\n  cd $d\ndone\n. ./errors2.sh",
+		"errors2.sh":    "x=$(nosuchcmd)",
+		"bin/onpath.sh": "echo on path",
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.Mkdir(filepath.Join(dir, "bin"), 0755)
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		src    string
+		stdout string
+		stderr string
+		status int
+	}{
+		{name: "keeps state", src: "source ./env.sh; echo $x; f; pwd", stdout: "1\nf\n" + filepath.Join(dir, "sub") + "\n"},
+		{name: "arguments", src: "set -- a b c; . ./args.sh x y; echo $#", stdout: "2 x y\n3\n"},
+		{name: "keeps arguments", src: "set -- a b c; . ./args.sh", stdout: "3 a b c\n"},
+		{name: "return", src: ". ./return.sh; echo $?", stdout: "a\n3\n"},
+		{name: "return in function", src: "f() { . ./return.sh; echo in f; }; f", stdout: "a\nin f\n"},
+		{name: "path", src: "PATH=bin; . onpath.sh", stdout: "on path\n"},
+		{name: "working directory", src: "PATH=bin; . args.sh", stdout: "0 \n"},
+		{name: "status", src: "echo 'false' > status.sh; . ./status.sh", status: 1},
+		{name: "missing file", src: ". ./missing.sh", stderr: ".: ./missing.sh: file not found\n", status: 1},
+		{name: "no argument", src: "source", stderr: "source: filename argument required\nsource: usage: source filename [arguments]\n", status: 2},
+		{name: "syntax error", src: ". ./bad.sh", stdout: "a\n", stderr: "./bad.sh: line 2: syntax error near unexpected token `then'\n", status: 2},
+		{
+			name: "runtime errors", src: ". ./errors.sh; cd /nonexistent", stdout: "a\n", status: 1,
+			stderr: "./errors.sh: line 4: cd: /nonexistent: No such file or directory\n" +
+				"./errors2.sh: line 1: nosuchcmd: command not found\n" +
+				"cd: /nonexistent: No such file or directory\n",
+		},
+		{name: "return outside", src: "return", stderr: "return: can only `return' from a function or sourced script\n", status: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh, stdout, stderr := newTestShell(t)
+			sh.Dir = dir
+			status, err := sh.Run(context.Background(), tt.src)
+			if err != nil {
+				t.Fatalf("Run(%q) error: %v", tt.src, err)
+			}
+			if status != tt.status || stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+				t.Errorf("Run(%q) = %d, %q, %q; want %d, %q, %q", tt.src, status, stdout, stderr, tt.status, tt.stdout, tt.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// handleSource runs the commands in a file in the current shell, so that
+// the variables, functions and working directory they set are kept. A
+// name without a slash is looked up in PATH and then in the working
+// directory. Any further arguments become the positional parameters while
+// the file runs. return ends the file with its status; otherwise the
+// status is that of the last command in the file.
+func (sh *Shell) handleSource(parts []string, streams stdio) int {
+	name := parts[0]
+	if len(parts) < 2 {
+		fmt.Fprintf(streams.err, "%s: filename argument required\n", name)
+		fmt.Fprintf(streams.err, "%s: usage: %s filename [arguments]\n", name, name)
+		return 2
+	}
+
+	path := sh.findSourceFile(parts[1])
+	file, err := os.Open(absPath(sh.dir, path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(streams.err, "%s: %s: file not found\n", name, parts[1])
+			return 1
+		}
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		fmt.Fprintf(streams.err, "%s: %s: %v\n", name, parts[1], err)
+		return 1
+	}
+	defer file.Close()
+
+	if len(parts) > 2 {
+		params := sh.params
+		sh.params = parts[2:]
+		defer func() { sh.params = params }()
+	}
+
+	sh.sourceDepth++
+	source := sh.source
+	sh.source = sourceFile{name: path, funcDepth: sh.funcDepth}
+	defer func() {
+		sh.sourceDepth--
+		sh.source = source
+	}()
+	status, err := sh.readCommands(bufio.NewReader(file), func(list *parser.List) {
+		sh.runList(list, streams)
+	})
+	if err != nil {
+		fmt.Fprintf(streams.err, "%s: %v\n", path, err)
+	}
+	if sh.returning {
+		sh.returning = false
+		status = sh.returnStatus
+	}
+	return status
+}
+
+// findSourceFile returns the file the source builtin reads for name: the
+// first regular file called name in PATH, or name itself.
+func (sh *Shell) findSourceFile(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	pathEnv, _ := sh.vars.Get("PATH")
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			dir = "."
+		}
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(absPath(sh.dir, path)); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return name
+}
+
+// sourceFile is a file of commands being run by the source builtin or as a
+// startup file.
+type sourceFile struct {
+	name string
+	// start is the line of the file the commands being run begin on, and
+	// line that of the command being run.
+	start, line int
+	// funcDepth is the depth of function calls the file runs at. The
+	// commands of the functions it calls keep the line of the call.
+	funcDepth int
+}
+
+// locate records the line of command when it comes from the file being
+// sourced, and returns streams with the standard error prefixed with the
+// file's name and the line, as errors in sourced files are reported.
+func (sh *Shell) locate(command parser.Command, streams stdio) stdio {
+	streams.err = unlocated(streams.err)
+	if sh.source.name == "" {
+		return streams
+	}
+	if sh.funcDepth == sh.source.funcDepth {
+		sh.source.line = sh.source.start + command.Pos().Line - 1
+	}
+	prefix := fmt.Sprintf("%s: line %d: ", sh.source.name, sh.source.line)
+	streams.err = &locatedWriter{w: streams.err, prefix: prefix}
+	return streams
+}
+
+// locatedWriter prefixes each line written to w, the standard error of a
+// command from a sourced file, with the command's place in the file.
+type locatedWriter struct {
+	w       io.Writer
+	prefix  string
+	midLine bool
+}
+
+func (l *locatedWriter) Write(p []byte) (int, error) {
+	var buf []byte
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !l.midLine {
+			buf = append(buf, l.prefix...)
+		}
+		buf = append(buf, line...)
+		l.midLine = line[len(line)-1] != '\n'
+	}
+	if _, err := l.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// unlocated returns the writer w prefixes, if it is a locatedWriter, so
+// that other commands and child processes get the standard error itself.
+func unlocated(w io.Writer) io.Writer {
+	if l, ok := w.(*locatedWriter); ok {
+		return l.w
+	}
+	return w
+}
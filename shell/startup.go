@@ -0,0 +1,119 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// Startup says which startup files RunStartupFiles reads.
+type Startup struct {
+	// Login shells read /etc/profile and then ~/.profile.
+	Login bool
+	// Interactive shells read ~/.myshellrc, or the file named by ENV in
+	// POSIX mode, after the login files.
+	Interactive bool
+	POSIX       bool
+	NoProfile   bool   // skip the login files
+	NoRC        bool   // skip the interactive file
+	RCFile      string // read instead of ~/.myshellrc
+}
+
+// systemProfile is the profile read by every login shell.
+var systemProfile = "/etc/profile"
+
+// RunStartupFiles runs the startup files opts asks for in the shell, as
+// if they were sourced. Missing files are skipped. An error in a file is
+// reported with its name and line number and ends that file only, so the
+// shell still starts. The exit builtin in a startup file ends the shell.
+func (sh *Shell) RunStartupFiles(ctx context.Context, opts Startup) {
+	if err := sh.init(); err != nil {
+		fmt.Fprintf(sh.stdio().err, "%s: %v\n", sh.Name, err)
+		return
+	}
+	sh.interactive = opts.Interactive
+
+	home, _ := sh.vars.Get("HOME")
+	var files []string
+	if opts.Login && !opts.NoProfile {
+		files = append(files, systemProfile)
+		if home != "" {
+			files = append(files, filepath.Join(home, ".profile"))
+		}
+	}
+	if opts.Interactive && !opts.NoRC {
+		switch {
+		case opts.RCFile != "":
+			files = append(files, opts.RCFile)
+		case opts.POSIX:
+			if env := sh.expandEnvFile(); env != "" {
+				files = append(files, env)
+			}
+		case home != "":
+			files = append(files, filepath.Join(home, ".myshellrc"))
+		}
+	}
+
+	for _, path := range files {
+		if sh.exited {
+			return
+		}
+		sh.runStartupFile(ctx, path)
+	}
+}
+
+// expandEnvFile returns the value of ENV after parameter expansion, which
+// names the startup file of interactive shells in POSIX mode.
+func (sh *Shell) expandEnvFile() string {
+	env, _ := sh.vars.Get("ENV")
+	if env == "" {
+		return ""
+	}
+	word, err := parser.ParseText(env)
+	if err != nil {
+		return env
+	}
+	path, err := sh.expander.Word(word)
+	if err != nil {
+		return env
+	}
+	return path
+}
+
+// runStartupFile runs the commands in the file at path, unless it does not
+// exist.
+func (sh *Shell) runStartupFile(ctx context.Context, path string) {
+	stderr := sh.stdio().err
+	file, err := os.Open(absPath(sh.dir, path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		fmt.Fprintf(stderr, "%s: %s: %v\n", sh.Name, path, err)
+		return
+	}
+	defer file.Close()
+
+	// Startup files are sourced, so return ends just the file.
+	sh.sourceDepth++
+	source := sh.source
+	sh.source = sourceFile{name: path, funcDepth: sh.funcDepth}
+	defer func() {
+		sh.sourceDepth--
+		sh.source = source
+		sh.returning = false
+	}()
+	if _, err := sh.RunReader(ctx, bufio.NewReader(file)); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+	}
+}
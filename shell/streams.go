@@ -0,0 +1,152 @@
+package shell
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// errStopped is returned by a read given up on before any input arrived.
+var errStopped = errors.New("read stopped")
+
+// input is a standard input that is not a file, shared by the commands
+// that read it in turn. Input read from it but not used, such as what a
+// child process left in its pipe, is put back for the next reader. Only
+// one read of the underlying reader is in progress at a time, and a
+// reader that gives up on it leaves its result to the next.
+type input struct {
+	r io.Reader
+
+	mu sync.Mutex
+	// buf holds input already read from r and not consumed; err is the
+	// error of the last read of r, returned once buf is empty.
+	buf []byte
+	err error
+	// reading is closed when the read of r in progress ends. It is nil
+	// when there is none.
+	reading chan struct{}
+}
+
+// Read implements io.Reader.
+func (in *input) Read(p []byte) (int, error) {
+	return in.read(p, nil)
+}
+
+// read is like Read but returns errStopped once stop is closed if no
+// input has arrived by then.
+func (in *input) read(p []byte, stop <-chan struct{}) (int, error) {
+	in.mu.Lock()
+	for len(in.buf) == 0 && in.err == nil {
+		if in.reading == nil {
+			in.reading = make(chan struct{})
+			go in.fill(max(len(p), 1))
+		}
+		reading := in.reading
+		in.mu.Unlock()
+		select {
+		case <-reading:
+		case <-stop:
+			return 0, errStopped
+		}
+		in.mu.Lock()
+	}
+	defer in.mu.Unlock()
+
+	if len(in.buf) == 0 {
+		err := in.err
+		in.err = nil
+		return 0, err
+	}
+	n := copy(p, in.buf)
+	in.buf = in.buf[n:]
+	return n, nil
+}
+
+// fill reads up to size bytes of r into the buffer.
+func (in *input) fill(size int) {
+	buf := make([]byte, size)
+	n, err := in.r.Read(buf)
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.buf = append(in.buf, buf[:n]...)
+	in.err = err
+	close(in.reading)
+	in.reading = nil
+}
+
+// unread puts p back in front of the input still to be read.
+func (in *input) unread(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.buf = append(append([]byte(nil), p...), in.buf...)
+}
+
+// feeder copies input into the pipe that is a child's standard input for
+// as long as the child runs.
+type feeder struct {
+	in   *input
+	r, w *os.File
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startFeeder starts copying in into the pipe r, w. The parent keeps r
+// open so that what the child does not read can be taken back.
+func startFeeder(in *input, r, w *os.File) *feeder {
+	f := &feeder{in: in, r: r, w: w, stop: make(chan struct{}), done: make(chan struct{})}
+	go f.run()
+	return f
+}
+
+func (f *feeder) run() {
+	defer close(f.done)
+	defer f.w.Close()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.in.read(buf, f.stop)
+		if n > 0 {
+			written, werr := f.w.Write(buf[:n])
+			if werr != nil {
+				f.in.unread(buf[written:n])
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// finish stops the copying once the child has exited and puts back what
+// it left unread.
+func (f *feeder) finish() {
+	close(f.stop)
+	f.w.SetWriteDeadline(time.Now())
+	<-f.done
+
+	left, _ := io.ReadAll(f.r)
+	f.r.Close()
+	f.in.unread(left)
+}
+
+// syncWriter serializes writes to a standard output or error that is not a
+// file, which commands running at once, like the stages of a pipeline,
+// write to concurrently. The writers of a shell share one mutex, as
+// Stdout and Stderr are often the same writer.
+type syncWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (s syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,38 @@
+package shell
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// tcsetpgrp makes pgid the foreground process group of the terminal fd.
+// The shell is usually in the background when it takes the terminal back,
+// so SIGTTOU is blocked on the calling thread while the ioctl runs;
+// otherwise the kernel would stop the shell.
+func tcsetpgrp(fd, pgid int) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	block := uint64(1) << (uint(syscall.SIGTTOU) - 1)
+	var old uint64
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_RT_SIGPROCMASK, 0 /* SIG_BLOCK */, uintptr(unsafe.Pointer(&block)), uintptr(unsafe.Pointer(&old)), 8, 0, 0); errno != 0 {
+		return errno
+	}
+	defer syscall.RawSyscall6(syscall.SYS_RT_SIGPROCMASK, 2 /* SIG_SETMASK */, uintptr(unsafe.Pointer(&old)), 0, 8, 0, 0)
+
+	pgrp := int32(pgid)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&pgrp))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// tcgetpgrp returns the foreground process group of the terminal fd.
+func tcgetpgrp(fd int) (int, error) {
+	var pgrp int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp))); errno != 0 {
+		return 0, errno
+	}
+	return int(pgrp), nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package shell
+
+import "errors"
+
+var errNoJobControl = errors.New("job control is not supported on this platform")
+
+// tcsetpgrp is only implemented on Linux; elsewhere job control is off.
+func tcsetpgrp(fd, pgid int) error {
+	return errNoJobControl
+}
+
+func tcgetpgrp(fd int) (int, error) {
+	return 0, errNoJobControl
+}
@@ -0,0 +1,205 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/vars"
+)
+
+// assignment is an expanded NAME=value prefix of a simple command.
+type assignment struct {
+	name  string
+	value string
+}
+
+// environ returns the environment for a child process: the exported
+// variables overridden by the command's prefix assignments.
+func (sh *Shell) environ(assigns []assignment) []string {
+	if len(assigns) == 0 {
+		return sh.vars.Environ()
+	}
+
+	store := sh.vars.Clone()
+	for _, assign := range assigns {
+		store.Set(assign.name, assign.value)
+		store.Export(assign.name)
+	}
+	return store.Environ()
+}
+
+// withAssignments runs fn with the prefix assignments applied and exported,
+// restoring the previous variables afterwards.
+func (sh *Shell) withAssignments(assigns []assignment, fn func()) error {
+	if len(assigns) == 0 {
+		fn()
+		return nil
+	}
+
+	sh.vars.PushScope()
+	defer sh.vars.PopScope()
+
+	for _, assign := range assigns {
+		sh.vars.Local(assign.name)
+		if err := sh.vars.Set(assign.name, assign.value); err != nil {
+			return err
+		}
+		sh.vars.Export(assign.name)
+	}
+	fn()
+	return nil
+}
+
+// splitNameValue splits a NAME[=value] builtin argument.
+func splitNameValue(arg string) (name, value string, hasValue bool) {
+	return strings.Cut(arg, "=")
+}
+
+// handleExport marks variables for export, optionally assigning them.
+// Without arguments, or with -p, it lists the exported variables. With -n
+// the export mark is removed instead.
+func (sh *Shell) handleExport(parts []string, streams stdio) int {
+	args := parts[1:]
+	unexport := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-p":
+		case "-n":
+			unexport = true
+		default:
+			fmt.Fprintf(streams.err, "export: %s: invalid option\n", args[0])
+			return 2
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		for _, name := range sh.vars.Names() {
+			if v, _ := sh.vars.Lookup(name); v.Exported {
+				fmt.Fprintf(streams.out, "export %s=%s\n", name, parser.QuoteWord(v.Value))
+			}
+		}
+		return 0
+	}
+
+	status := 0
+	for _, arg := range args {
+		name, value, hasValue := splitNameValue(arg)
+		if !vars.IsName(name) {
+			fmt.Fprintf(streams.err, "export: `%s': not a valid identifier\n", arg)
+			status = 1
+			continue
+		}
+		if hasValue {
+			if err := sh.vars.Set(name, value); err != nil {
+				fmt.Fprintf(streams.err, "export: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		if unexport {
+			sh.vars.Unexport(name)
+		} else {
+			sh.vars.Export(name)
+		}
+	}
+	return status
+}
+
+// handleUnset removes variables, or functions with -f. Readonly variables
+// cannot be unset.
+func (sh *Shell) handleUnset(parts []string, streams stdio) int {
+	args := parts[1:]
+	functions := false
+	if len(args) > 0 && (args[0] == "-v" || args[0] == "-f") {
+		functions = args[0] == "-f"
+		args = args[1:]
+	}
+
+	status := 0
+	for _, name := range args {
+		if functions {
+			delete(sh.funcs, name)
+			continue
+		}
+		if !vars.IsName(name) {
+			fmt.Fprintf(streams.err, "unset: `%s': not a valid identifier\n", name)
+			status = 1
+			continue
+		}
+		if err := sh.vars.Unset(name); err != nil {
+			fmt.Fprintf(streams.err, "unset: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// handleReadonly marks variables readonly, optionally assigning them first.
+// Without arguments, or with -p, it lists the readonly variables.
+func (sh *Shell) handleReadonly(parts []string, streams stdio) int {
+	args := parts[1:]
+	if len(args) > 0 && args[0] == "-p" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		for _, name := range sh.vars.Names() {
+			if v, _ := sh.vars.Lookup(name); v.ReadOnly {
+				fmt.Fprintf(streams.out, "readonly %s=%s\n", name, parser.QuoteWord(v.Value))
+			}
+		}
+		return 0
+	}
+
+	status := 0
+	for _, arg := range args {
+		name, value, hasValue := splitNameValue(arg)
+		if !vars.IsName(name) {
+			fmt.Fprintf(streams.err, "readonly: `%s': not a valid identifier\n", arg)
+			status = 1
+			continue
+		}
+		if hasValue {
+			if err := sh.vars.Set(name, value); err != nil {
+				fmt.Fprintf(streams.err, "readonly: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		sh.vars.SetReadOnly(name)
+	}
+	return status
+}
+
+// handleEnv prints the exported environment, or runs a command in a
+// modified one: env [-i] [-u NAME] [NAME=value]... [command [arg]...].
+func (sh *Shell) handleEnv(parts []string, streams stdio) int {
+	store := sh.vars.Clone()
+	args := parts[1:]
+
+	for len(args) > 0 {
+		if args[0] == "-i" {
+			store = vars.New()
+		} else if args[0] == "-u" && len(args) > 1 {
+			store.Unset(args[1])
+			args = args[1:]
+		} else if name, value, ok := splitNameValue(args[0]); ok && vars.IsName(name) {
+			store.Set(name, value)
+			store.Export(name)
+		} else {
+			break
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		for _, entry := range store.Environ() {
+			fmt.Fprintln(streams.out, entry)
+		}
+		return 0
+	}
+
+	return sh.executeExternal(args, store.Environ(), streams)
+}